@@ -0,0 +1,84 @@
+// Package apperr defines the typed errors returned by handlers and
+// middlewares, and the central Echo error handler rendering them.
+package apperr
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error is a domain error carrying its HTTP status, a stable machine-readable
+// code and a message for the client. Err, the underlying cause, is logged but
+// never sent to the client.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors by code, so that errors.Is(err, someSentinel) holds for
+// copies returned by WithDetails or Wrap.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetails returns a copy of the error with structured details.
+func (e *Error) WithDetails(details interface{}) *Error {
+	copy := *e
+	copy.Details = details
+	return &copy
+}
+
+// Wrap returns a copy of the error recording err as its cause.
+func (e *Error) Wrap(err error) *Error {
+	copy := *e
+	copy.Err = err
+	return &copy
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(code, message string) *Error {
+	return New(http.StatusBadRequest, code, message)
+}
+
+func Unauthorized(code, message string) *Error {
+	return New(http.StatusUnauthorized, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(http.StatusForbidden, code, message)
+}
+
+func NotFound(code, message string) *Error {
+	return New(http.StatusNotFound, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(http.StatusConflict, code, message)
+}
+
+func TooManyRequests(code, message string) *Error {
+	return New(http.StatusTooManyRequests, code, message)
+}
+
+// Internal reports a server-side failure; err is logged, not exposed.
+func Internal(code, message string, err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: code, Message: message, Err: err}
+}
@@ -0,0 +1,108 @@
+package apperr
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"spacebook/i18n"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Body is the uniform JSON error envelope.
+type Body struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// From converts any error into an *Error: domain errors are returned as is,
+// Echo errors keep their status and anything else becomes a 500.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fromEcho(httpErr)
+	}
+
+	return Internal("internal_error", "Erreur interne du serveur", err)
+}
+
+func fromEcho(err *echo.HTTPError) *Error {
+	code := "http_error"
+	switch err.Code {
+	case http.StatusBadRequest:
+		code = "bad_request"
+	case http.StatusUnauthorized:
+		code = "unauthorized"
+	case http.StatusForbidden:
+		code = "forbidden"
+	case http.StatusNotFound:
+		code = "route_not_found"
+	case http.StatusMethodNotAllowed:
+		code = "method_not_allowed"
+	case http.StatusRequestEntityTooLarge:
+		code = "payload_too_large"
+	case http.StatusTooManyRequests:
+		code = "too_many_requests"
+	case http.StatusServiceUnavailable:
+		code = "service_unavailable"
+	}
+
+	message := http.StatusText(err.Code)
+	if m, ok := err.Message.(string); ok && m != "" {
+		message = m
+	}
+
+	return &Error{Status: err.Code, Code: code, Message: message, Err: err.Internal}
+}
+
+// Write renders err as the error envelope. It is the Echo HTTPErrorHandler.
+func Write(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	appErr := From(err)
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+
+	if appErr.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(c.Request().Context(), "request failed",
+			"code", appErr.Code,
+			"error", err.Error(),
+			"method", c.Request().Method,
+			"path", c.Request().URL.Path,
+			"request_id", requestID,
+		)
+	}
+
+	// Known codes are rendered in the caller's language; the message given at
+	// construction is the fallback for codes missing from the catalog.
+	message := appErr.Message
+	if i18n.Has(appErr.Code) {
+		message = i18n.Message(c, appErr.Code, i18n.ParamsFrom(appErr.Details))
+	}
+
+	body := Body{
+		Code:      appErr.Code,
+		Message:   message,
+		Details:   appErr.Details,
+		RequestID: requestID,
+	}
+
+	var writeErr error
+	if c.Request().Method == http.MethodHead {
+		writeErr = c.NoContent(appErr.Status)
+	} else {
+		writeErr = c.JSON(appErr.Status, body)
+	}
+	if writeErr != nil {
+		slog.ErrorContext(c.Request().Context(), "writing error response", "error", writeErr)
+	}
+}
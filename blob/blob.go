@@ -0,0 +1,53 @@
+// Package blob stores uploaded files (resource photos) behind a pluggable
+// backend. Files are addressed by keys made of slash-separated segments.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob: not found")
+	ErrInvalidKey = errors.New("blob: invalid key")
+)
+
+// Store keeps files.
+type Store interface {
+	// Put writes the content of r under key, replacing any previous file.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns the file stored under key, ErrNotFound if there is none.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key; a missing file is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+}
+
+var current Store
+
+// Use sets the store used by the application.
+func Use(store Store) {
+	current = store
+}
+
+// Current returns the store used by the application, nil until Use is
+// called.
+func Current() Store {
+	return current
+}
+
+// validKey refuses empty segments and relative references, so that keys
+// cannot escape the store.
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, `\`+"\x00") {
+			return false
+		}
+	}
+	return true
+}
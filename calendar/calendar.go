@@ -0,0 +1,141 @@
+// Package calendar writes iCalendar files (RFC 5545) so that reservations
+// can be added to calendar applications.
+package calendar
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of iCalendar files.
+const ContentType = "text/calendar; charset=utf-8"
+
+const (
+	prodID = "-//SpaceBook//SpaceBook//FR"
+	// Lines are folded after 75 octets.
+	maxLineLength = 75
+	timeLayout    = "20060102T150405Z"
+)
+
+// Event statuses.
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// Participation statuses of attendees.
+const (
+	NeedsAction = "NEEDS-ACTION"
+	Accepted    = "ACCEPTED"
+	Declined    = "DECLINED"
+)
+
+// Person is the organizer or an attendee of an event.
+type Person struct {
+	Email string
+	Name  string
+	// Status is the participation status of an attendee.
+	Status string
+}
+
+// Event is a VEVENT. Times are written in UTC.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Stamp       time.Time
+	Summary     string
+	Description string
+	Location    string
+	Status      string
+	Organizer   *Person
+	Attendees   []Person
+}
+
+// Write writes a calendar holding events.
+func Write(w io.Writer, events ...Event) error {
+	out := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(out, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", prodID)
+	line("CALSCALE", "GREGORIAN")
+	for _, event := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", event.UID)
+		line("DTSTAMP", formatTime(event.Stamp))
+		line("DTSTART", formatTime(event.Start))
+		line("DTEND", formatTime(event.End))
+		line("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION", escape(event.Location))
+		}
+		if event.Status != "" {
+			line("STATUS", event.Status)
+		}
+		if event.Organizer != nil {
+			writeFolded(out, "ORGANIZER"+commonName(*event.Organizer)+":mailto:"+event.Organizer.Email)
+		}
+		for _, attendee := range event.Attendees {
+			status := attendee.Status
+			if status == "" {
+				status = NeedsAction
+			}
+			writeFolded(out, "ATTENDEE"+commonName(attendee)+";ROLE=REQ-PARTICIPANT;PARTSTAT="+status+":mailto:"+attendee.Email)
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	return out.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// escape escapes a TEXT value.
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// commonName is the CN parameter of a person, quoted since names may hold
+// separators.
+func commonName(p Person) string {
+	if p.Name == "" {
+		return ""
+	}
+	return `;CN="` + strings.NewReplacer(`"`, "'", "\r", "", "\n", " ").Replace(p.Name) + `"`
+}
+
+// writeFolded writes a content line, folded so that no line exceeds 75
+// octets without splitting UTF-8 sequences.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,672 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultJWTSecret is only acceptable outside production.
+const DefaultJWTSecret = "default-secret-change-in-production"
+
+// Config is the typed application configuration. Values come, by increasing
+// priority, from the defaults, the YAML file (CONFIG_FILE, config.yaml if
+// present) and the environment (including .env, loaded by the caller).
+type Config struct {
+	Env             string        `yaml:"env"`
+	Port            int           `yaml:"port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For; only enable
+	// behind a reverse proxy that sets it, as clients could spoof it otherwise.
+	TrustProxyHeaders bool            `yaml:"trust_proxy_headers"`
+	Database          DatabaseConfig  `yaml:"database"`
+	JWT               JWTConfig       `yaml:"jwt"`
+	CORS              CORSConfig      `yaml:"cors"`
+	RateLimit         RateLimitConfig `yaml:"rate_limit"`
+	TwoFactor         TwoFactorConfig `yaml:"two_factor"`
+	OIDC              OIDCConfig      `yaml:"oidc"`
+	Storage           StorageConfig   `yaml:"storage"`
+	CheckIn           CheckInConfig   `yaml:"check_in"`
+	Telemetry         TelemetryConfig `yaml:"telemetry"`
+	Log               LogConfig       `yaml:"log"`
+}
+
+type DatabaseConfig struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnectAttempts int           `yaml:"connect_attempts"`
+	ConnectBackoff  time.Duration `yaml:"connect_backoff"`
+}
+
+type JWTConfig struct {
+	// Secret signs HS256 tokens and the SSO flow cookie.
+	Secret   string        `yaml:"secret"`
+	TokenTTL time.Duration `yaml:"token_ttl"`
+
+	// Algorithm is HS256 (shared secret), RS256 or EdDSA. With an asymmetric
+	// algorithm, other services verify tokens with /.well-known/jwks.json.
+	// Changing it invalidates the sessions signed before.
+	Algorithm string `yaml:"algorithm"`
+	// Issuer and Audience are set in tokens and checked by JWTAuth.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+
+	// KeyStore is "memory" (keys lost on restart, single instance) or
+	// "postgres" (shared by instances).
+	KeyStore string `yaml:"key_store"`
+	// KeyRotation is the lifetime of a signing key (0 disables rotation);
+	// a new key is published KeyPublishAhead before it starts signing.
+	KeyRotation     time.Duration `yaml:"key_rotation"`
+	KeyPublishAhead time.Duration `yaml:"key_publish_ahead"`
+
+	// UserStateCacheTTL is how long an instance caches the user state
+	// (role, token version, deletion) checked on each request. A revoked
+	// session is refused at once by the instance making the change and
+	// after at most this delay by the others; 0 checks the database on
+	// every request.
+	UserStateCacheTTL time.Duration `yaml:"user_state_cache_ttl"`
+}
+
+// Asymmetric tells whether tokens are signed with the rotated key pairs.
+func (j JWTConfig) Asymmetric() bool {
+	return j.Algorithm == "RS256" || j.Algorithm == "EdDSA"
+}
+
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allow_origins"`
+}
+
+type RateLimitConfig struct {
+	// Store is "memory" (single instance) or "postgres" (shared by instances).
+	Store string `yaml:"store"`
+
+	// Token bucket per authenticated user (per IP for anonymous requests).
+	// A rate of 0 disables the API limiter.
+	APIRequestsPerMinute int `yaml:"api_requests_per_minute"`
+	APIBurst             int `yaml:"api_burst"`
+
+	// Token bucket per IP on the login endpoint.
+	LoginRequestsPerMinute int `yaml:"login_requests_per_minute"`
+	LoginBurst             int `yaml:"login_burst"`
+
+	// Lockout after repeated login failures, doubling from LockoutBase up to
+	// LockoutMax. Failures older than FailureWindow are forgotten.
+	MaxFailuresPerAccount int           `yaml:"max_failures_per_account"`
+	MaxFailuresPerIP      int           `yaml:"max_failures_per_ip"`
+	LockoutBase           time.Duration `yaml:"lockout_base"`
+	LockoutMax            time.Duration `yaml:"lockout_max"`
+	FailureWindow         time.Duration `yaml:"failure_window"`
+}
+
+type TwoFactorConfig struct {
+	// RequireForAdmins refuses admin routes to admins who did not log in
+	// with a second factor; they can still enrol through /me/2fa.
+	RequireForAdmins bool `yaml:"require_for_admins"`
+	// Issuer is the account label shown by authenticator apps.
+	Issuer string `yaml:"issuer"`
+	// ChallengeTTL is how long the second step of a login may take.
+	ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+}
+
+// OIDCConfig enables single sign-on with an OpenID Connect provider when
+// IssuerURL is set.
+type OIDCConfig struct {
+	IssuerURL    string   `yaml:"issuer_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // this API's /auth/oidc/callback
+	Scopes       []string `yaml:"scopes"`
+	// FrontendRedirectURL receives the session token in its fragment
+	// (#token=...). The callback answers in JSON when empty.
+	FrontendRedirectURL string `yaml:"frontend_redirect_url"`
+	// GroupsClaim names the ID token claim listing the user's groups, and
+	// GroupRoles maps them to roles. Users in no mapped group get DefaultRole.
+	GroupsClaim string            `yaml:"groups_claim"`
+	GroupRoles  map[string]string `yaml:"group_roles"`
+	DefaultRole string            `yaml:"default_role"`
+}
+
+func (o OIDCConfig) Enabled() bool {
+	return o.IssuerURL != ""
+}
+
+// StorageConfig describes where uploaded files (resource photos) are kept.
+type StorageConfig struct {
+	// Backend is "local": files under LocalDir, which must be shared by
+	// instances (volume) when several run.
+	Backend  string `yaml:"backend"`
+	LocalDir string `yaml:"local_dir"`
+	// MaxUploadSize is the largest accepted upload, in bytes.
+	MaxUploadSize int `yaml:"max_upload_size"`
+	// ThumbnailSize is the longest side of thumbnails, in pixels.
+	ThumbnailSize int `yaml:"thumbnail_size"`
+}
+
+// CheckInConfig governs the resources that require a check-in: approved
+// reservations nobody checked in to by GracePeriod after their start are
+// released as no-shows.
+type CheckInConfig struct {
+	// Check-in is accepted from OpensBefore before the start until
+	// GracePeriod after it.
+	OpensBefore time.Duration `yaml:"opens_before"`
+	GracePeriod time.Duration `yaml:"grace_period"`
+	// ReleaseInterval is how often no-shows are looked for.
+	ReleaseInterval time.Duration `yaml:"release_interval"`
+	// NoShowLimit no-shows within NoShowWindow bar a user from booking
+	// until the oldest one leaves the window; 0 disables the penalty.
+	NoShowLimit  int           `yaml:"no_show_limit"`
+	NoShowWindow time.Duration `yaml:"no_show_window"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // json or text
+}
+
+type TelemetryConfig struct {
+	ServiceName string `yaml:"service_name"`
+	// OTLPEndpoint is the OTLP/HTTP collector URL (e.g. http://localhost:4318).
+	// Tracing is disabled when empty.
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+	// MetricsAddr is the address of the listener serving /metrics, apart
+	// from the API. Metrics are not served when empty.
+	MetricsAddr string `yaml:"metrics_addr"`
+	// MetricsToken, when set, is the bearer token scrapers must send.
+	MetricsToken string `yaml:"metrics_token"`
+}
+
+// App is the configuration loaded at startup.
+var App *Config
+
+// Get returns the loaded configuration, or one built from the defaults and
+// the environment when Load has not been called (e.g. in tests).
+func Get() *Config {
+	if App == nil {
+		cfg := Default()
+		if err := cfg.applyEnv(); err != nil {
+			panic(err)
+		}
+		App = cfg
+	}
+	return App
+}
+
+func Default() *Config {
+	return &Config{
+		Env:             "development",
+		Port:            8000,
+		ShutdownTimeout: 15 * time.Second,
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnectAttempts: 10,
+			ConnectBackoff:  500 * time.Millisecond,
+		},
+		JWT: JWTConfig{
+			Secret:            DefaultJWTSecret,
+			TokenTTL:          24 * time.Hour,
+			Algorithm:         "HS256",
+			Issuer:            "spacebook",
+			Audience:          "spacebook",
+			KeyStore:          "memory",
+			KeyRotation:       30 * 24 * time.Hour,
+			KeyPublishAhead:   time.Hour,
+			UserStateCacheTTL: 5 * time.Second,
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{"*"},
+		},
+		RateLimit: RateLimitConfig{
+			Store:                  "memory",
+			APIRequestsPerMinute:   300,
+			APIBurst:               60,
+			LoginRequestsPerMinute: 10,
+			LoginBurst:             5,
+			MaxFailuresPerAccount:  5,
+			MaxFailuresPerIP:       20,
+			LockoutBase:            30 * time.Second,
+			LockoutMax:             time.Hour,
+			FailureWindow:          15 * time.Minute,
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:       "SpaceBook",
+			ChallengeTTL: 5 * time.Minute,
+		},
+		OIDC: OIDCConfig{
+			Scopes:      []string{"openid", "email", "profile"},
+			GroupsClaim: "groups",
+			DefaultRole: "user",
+		},
+		Storage: StorageConfig{
+			Backend:       "local",
+			LocalDir:      "data/uploads",
+			MaxUploadSize: 5 << 20,
+			ThumbnailSize: 320,
+		},
+		CheckIn: CheckInConfig{
+			OpensBefore:     15 * time.Minute,
+			GracePeriod:     15 * time.Minute,
+			ReleaseInterval: time.Minute,
+			NoShowLimit:     3,
+			NoShowWindow:    30 * 24 * time.Hour,
+		},
+		Telemetry: TelemetryConfig{
+			ServiceName: "spacebook",
+			SampleRatio: 1,
+			MetricsAddr: "127.0.0.1:9091",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// Load builds and validates the configuration, then makes it available
+// through App.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		if _, err := os.Stat("config.yaml"); err == nil {
+			path = "config.yaml"
+		}
+	}
+	if path != "" {
+		if err := cfg.applyYAML(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	App = cfg
+	return cfg, nil
+}
+
+func (cfg *Config) IsProduction() bool {
+	return cfg.Env == "production"
+}
+
+// Validate checks the configuration and refuses insecure production setups.
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	switch cfg.Env {
+	case "development", "test", "production":
+	default:
+		errs = append(errs, fmt.Errorf("env: unknown environment %q", cfg.Env))
+	}
+
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %d is out of range", cfg.Port))
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+
+	if cfg.Database.Host == "" {
+		errs = append(errs, errors.New("database.host is required"))
+	}
+	if cfg.Database.Name == "" {
+		errs = append(errs, errors.New("database.name is required"))
+	}
+	switch cfg.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("database.sslmode: invalid value %q", cfg.Database.SSLMode))
+	}
+	if cfg.Database.MaxOpenConns < 0 || cfg.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("database: pool sizes cannot be negative"))
+	}
+	if cfg.Database.MaxOpenConns > 0 && cfg.Database.MaxIdleConns > cfg.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database.max_idle_conns cannot exceed database.max_open_conns"))
+	}
+
+	if cfg.Database.ConnectAttempts < 1 {
+		errs = append(errs, errors.New("database.connect_attempts must be at least 1"))
+	}
+	if cfg.Database.ConnectBackoff <= 0 {
+		errs = append(errs, errors.New("database.connect_backoff must be positive"))
+	}
+
+	if cfg.JWT.TokenTTL <= 0 {
+		errs = append(errs, errors.New("jwt.token_ttl must be positive"))
+	}
+	switch cfg.JWT.Algorithm {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		errs = append(errs, fmt.Errorf("jwt.algorithm: invalid value %q", cfg.JWT.Algorithm))
+	}
+	if cfg.JWT.KeyStore != "memory" && cfg.JWT.KeyStore != "postgres" {
+		errs = append(errs, fmt.Errorf("jwt.key_store: invalid value %q", cfg.JWT.KeyStore))
+	}
+	if cfg.JWT.UserStateCacheTTL < 0 {
+		errs = append(errs, errors.New("jwt.user_state_cache_ttl cannot be negative"))
+	}
+	if cfg.JWT.KeyRotation < 0 || cfg.JWT.KeyPublishAhead < 0 {
+		errs = append(errs, errors.New("jwt: key rotation durations cannot be negative"))
+	}
+	if cfg.JWT.KeyRotation > 0 && cfg.JWT.KeyRotation <= cfg.JWT.KeyPublishAhead {
+		errs = append(errs, errors.New("jwt.key_rotation must exceed jwt.key_publish_ahead"))
+	}
+	if cfg.IsProduction() {
+		if cfg.JWT.Secret == "" || cfg.JWT.Secret == DefaultJWTSecret {
+			errs = append(errs, errors.New("jwt.secret: the default secret cannot be used in production"))
+		} else if len(cfg.JWT.Secret) < 32 {
+			errs = append(errs, errors.New("jwt.secret must be at least 32 characters in production"))
+		}
+		if cfg.Database.SSLMode == "disable" {
+			errs = append(errs, errors.New("database.sslmode: TLS must be enabled in production"))
+		}
+		for _, origin := range cfg.CORS.AllowOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New("cors.allow_origins: wildcard origin not allowed in production"))
+			}
+		}
+	}
+
+	rl := cfg.RateLimit
+	if rl.Store != "memory" && rl.Store != "postgres" {
+		errs = append(errs, fmt.Errorf("rate_limit.store: invalid value %q", rl.Store))
+	}
+	if rl.APIRequestsPerMinute < 0 || rl.APIBurst < 0 {
+		errs = append(errs, errors.New("rate_limit: API limits cannot be negative"))
+	}
+	if rl.APIRequestsPerMinute > 0 && rl.APIBurst < 1 {
+		errs = append(errs, errors.New("rate_limit.api_burst must be at least 1"))
+	}
+	if rl.LoginRequestsPerMinute < 1 || rl.LoginBurst < 1 {
+		errs = append(errs, errors.New("rate_limit: login limits must be at least 1"))
+	}
+	if rl.MaxFailuresPerAccount < 1 || rl.MaxFailuresPerIP < 1 {
+		errs = append(errs, errors.New("rate_limit: failure thresholds must be at least 1"))
+	}
+	if rl.LockoutBase <= 0 || rl.LockoutMax < rl.LockoutBase {
+		errs = append(errs, errors.New("rate_limit: lockout_base must be positive and not exceed lockout_max"))
+	}
+	if rl.FailureWindow <= 0 {
+		errs = append(errs, errors.New("rate_limit.failure_window must be positive"))
+	}
+
+	if cfg.TwoFactor.Issuer == "" || strings.Contains(cfg.TwoFactor.Issuer, ":") {
+		errs = append(errs, errors.New("two_factor.issuer is required and cannot contain ':'"))
+	}
+	if cfg.TwoFactor.ChallengeTTL <= 0 {
+		errs = append(errs, errors.New("two_factor.challenge_ttl must be positive"))
+	}
+
+	if cfg.OIDC.Enabled() {
+		if cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "" {
+			errs = append(errs, errors.New("oidc: client_id and redirect_url are required with issuer_url"))
+		}
+		for group, role := range cfg.OIDC.GroupRoles {
+			if role != "user" && role != "admin" {
+				errs = append(errs, fmt.Errorf("oidc.group_roles: invalid role %q for group %q", role, group))
+			}
+		}
+		if cfg.OIDC.DefaultRole != "user" && cfg.OIDC.DefaultRole != "admin" {
+			errs = append(errs, fmt.Errorf("oidc.default_role: invalid role %q", cfg.OIDC.DefaultRole))
+		}
+	}
+
+	if cfg.Storage.Backend != "local" {
+		errs = append(errs, fmt.Errorf("storage.backend: invalid value %q", cfg.Storage.Backend))
+	}
+	if cfg.Storage.Backend == "local" && cfg.Storage.LocalDir == "" {
+		errs = append(errs, errors.New("storage.local_dir is required with the local backend"))
+	}
+	if cfg.Storage.MaxUploadSize < 1 {
+		errs = append(errs, errors.New("storage.max_upload_size must be positive"))
+	}
+	if cfg.Storage.ThumbnailSize < 16 {
+		errs = append(errs, errors.New("storage.thumbnail_size must be at least 16"))
+	}
+
+	ci := cfg.CheckIn
+	if ci.OpensBefore < 0 {
+		errs = append(errs, errors.New("check_in.opens_before cannot be negative"))
+	}
+	if ci.GracePeriod <= 0 || ci.ReleaseInterval <= 0 {
+		errs = append(errs, errors.New("check_in: grace_period and release_interval must be positive"))
+	}
+	if ci.NoShowLimit < 0 {
+		errs = append(errs, errors.New("check_in.no_show_limit cannot be negative"))
+	}
+	if ci.NoShowLimit > 0 && ci.NoShowWindow <= 0 {
+		errs = append(errs, errors.New("check_in.no_show_window must be positive with a no-show limit"))
+	}
+
+	if cfg.Telemetry.SampleRatio < 0 || cfg.Telemetry.SampleRatio > 1 {
+		errs = append(errs, errors.New("telemetry.sample_ratio must be between 0 and 1"))
+	}
+	if cfg.Telemetry.MetricsAddr != "" {
+		if _, port, err := net.SplitHostPort(cfg.Telemetry.MetricsAddr); err != nil {
+			errs = append(errs, fmt.Errorf("telemetry.metrics_addr: %w", err))
+		} else if port == strconv.Itoa(cfg.Port) {
+			errs = append(errs, errors.New("telemetry.metrics_addr must not use the API port"))
+		}
+	}
+
+	switch cfg.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: invalid value %q", cfg.Log.Level))
+	}
+	if cfg.Log.Format != "json" && cfg.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("log.format: invalid value %q", cfg.Log.Format))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Logger builds the structured logger described by the configuration.
+func (cfg LogConfig) Logger() *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+}
+
+// DSN returns the Postgres connection string. Sessions run in UTC so that
+// dates are stored and read back in UTC whatever the server's zone.
+func (db DatabaseConfig) DSN() string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=UTC",
+		db.Host, db.User, db.Password, db.Name, db.Port, db.SSLMode,
+	)
+}
+
+func (cfg *Config) applyYAML(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides the configuration with the environment variables that are set.
+func (cfg *Config) applyEnv() error {
+	var errs []error
+
+	setString := func(key string, target *string) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			*target = value
+		}
+	}
+	setInt := func(key string, target *int) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an integer", key, value))
+				return
+			}
+			*target = n
+		}
+	}
+	setDuration := func(key string, target *time.Duration) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration", key, value))
+				return
+			}
+			*target = d
+		}
+	}
+	setBool := func(key string, target *bool) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", key, value))
+				return
+			}
+			*target = b
+		}
+	}
+	setFloat := func(key string, target *float64) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", key, value))
+				return
+			}
+			*target = f
+		}
+	}
+	setList := func(key string, target *[]string) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*target = items
+		}
+	}
+
+	setString("APP_ENV", &cfg.Env)
+	setInt("PORT", &cfg.Port)
+	setDuration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	setBool("TRUST_PROXY_HEADERS", &cfg.TrustProxyHeaders)
+
+	setString("DB_HOST", &cfg.Database.Host)
+	setInt("DB_PORT", &cfg.Database.Port)
+	setString("DB_USER", &cfg.Database.User)
+	setString("DB_PASSWORD", &cfg.Database.Password)
+	setString("DB_NAME", &cfg.Database.Name)
+	setString("DB_SSLMODE", &cfg.Database.SSLMode)
+	setInt("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	setInt("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	setDuration("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+	setInt("DB_CONNECT_ATTEMPTS", &cfg.Database.ConnectAttempts)
+	setDuration("DB_CONNECT_BACKOFF", &cfg.Database.ConnectBackoff)
+
+	setString("JWT_SECRET", &cfg.JWT.Secret)
+	setDuration("JWT_TOKEN_TTL", &cfg.JWT.TokenTTL)
+	setString("JWT_ALGORITHM", &cfg.JWT.Algorithm)
+	setString("JWT_ISSUER", &cfg.JWT.Issuer)
+	setString("JWT_AUDIENCE", &cfg.JWT.Audience)
+	setString("JWT_KEY_STORE", &cfg.JWT.KeyStore)
+	setDuration("JWT_KEY_ROTATION", &cfg.JWT.KeyRotation)
+	setDuration("JWT_KEY_PUBLISH_AHEAD", &cfg.JWT.KeyPublishAhead)
+	setDuration("JWT_USER_STATE_CACHE_TTL", &cfg.JWT.UserStateCacheTTL)
+
+	setList("CORS_ALLOW_ORIGINS", &cfg.CORS.AllowOrigins)
+
+	setString("RATE_LIMIT_STORE", &cfg.RateLimit.Store)
+	setInt("RATE_LIMIT_API_PER_MINUTE", &cfg.RateLimit.APIRequestsPerMinute)
+	setInt("RATE_LIMIT_API_BURST", &cfg.RateLimit.APIBurst)
+	setInt("RATE_LIMIT_LOGIN_PER_MINUTE", &cfg.RateLimit.LoginRequestsPerMinute)
+	setInt("RATE_LIMIT_LOGIN_BURST", &cfg.RateLimit.LoginBurst)
+	setInt("LOGIN_MAX_FAILURES_PER_ACCOUNT", &cfg.RateLimit.MaxFailuresPerAccount)
+	setInt("LOGIN_MAX_FAILURES_PER_IP", &cfg.RateLimit.MaxFailuresPerIP)
+	setDuration("LOGIN_LOCKOUT_BASE", &cfg.RateLimit.LockoutBase)
+	setDuration("LOGIN_LOCKOUT_MAX", &cfg.RateLimit.LockoutMax)
+	setDuration("LOGIN_FAILURE_WINDOW", &cfg.RateLimit.FailureWindow)
+
+	setBool("TWO_FACTOR_REQUIRED_FOR_ADMINS", &cfg.TwoFactor.RequireForAdmins)
+	setString("TWO_FACTOR_ISSUER", &cfg.TwoFactor.Issuer)
+	setDuration("TWO_FACTOR_CHALLENGE_TTL", &cfg.TwoFactor.ChallengeTTL)
+
+	setString("OIDC_ISSUER_URL", &cfg.OIDC.IssuerURL)
+	setString("OIDC_CLIENT_ID", &cfg.OIDC.ClientID)
+	setString("OIDC_CLIENT_SECRET", &cfg.OIDC.ClientSecret)
+	setString("OIDC_REDIRECT_URL", &cfg.OIDC.RedirectURL)
+	setList("OIDC_SCOPES", &cfg.OIDC.Scopes)
+	setString("OIDC_FRONTEND_REDIRECT_URL", &cfg.OIDC.FrontendRedirectURL)
+	setString("OIDC_GROUPS_CLAIM", &cfg.OIDC.GroupsClaim)
+	setString("OIDC_DEFAULT_ROLE", &cfg.OIDC.DefaultRole)
+	// group=role pairs, e.g. "spacebook-admins=admin,staff=user"
+	if value := os.Getenv("OIDC_GROUP_ROLES"); value != "" {
+		cfg.OIDC.GroupRoles = map[string]string{}
+		for _, pair := range strings.Split(value, ",") {
+			group, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || group == "" {
+				errs = append(errs, fmt.Errorf("OIDC_GROUP_ROLES: %q is not a group=role pair", pair))
+				continue
+			}
+			cfg.OIDC.GroupRoles[group] = role
+		}
+	}
+
+	setString("STORAGE_BACKEND", &cfg.Storage.Backend)
+	setString("STORAGE_LOCAL_DIR", &cfg.Storage.LocalDir)
+	setInt("STORAGE_MAX_UPLOAD_SIZE", &cfg.Storage.MaxUploadSize)
+	setInt("STORAGE_THUMBNAIL_SIZE", &cfg.Storage.ThumbnailSize)
+
+	setDuration("CHECK_IN_OPENS_BEFORE", &cfg.CheckIn.OpensBefore)
+	setDuration("CHECK_IN_GRACE_PERIOD", &cfg.CheckIn.GracePeriod)
+	setDuration("CHECK_IN_RELEASE_INTERVAL", &cfg.CheckIn.ReleaseInterval)
+	setInt("NO_SHOW_LIMIT", &cfg.CheckIn.NoShowLimit)
+	setDuration("NO_SHOW_WINDOW", &cfg.CheckIn.NoShowWindow)
+
+	setString("LOG_LEVEL", &cfg.Log.Level)
+	setString("LOG_FORMAT", &cfg.Log.Format)
+
+	setString("OTEL_SERVICE_NAME", &cfg.Telemetry.ServiceName)
+	setString("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Telemetry.OTLPEndpoint)
+	setFloat("OTEL_TRACES_SAMPLE_RATIO", &cfg.Telemetry.SampleRatio)
+	setString("METRICS_ADDR", &cfg.Telemetry.MetricsAddr)
+	setString("METRICS_TOKEN", &cfg.Telemetry.MetricsToken)
+
+	return errors.Join(errs...)
+}
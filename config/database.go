@@ -1,37 +1,161 @@
 package config
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"log/slog"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"spacebook/models"
+	"spacebook/telemetry"
 )
 
 var DB *gorm.DB
 
-func ConnectDatabase() {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
-
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic("❌ Failed to connect to database")
+// maxConnectBackoff caps the delay between two connection attempts.
+const maxConnectBackoff = 30 * time.Second
+
+// Connect opens the database, retrying with exponential backoff until it
+// answers, then configures the pool and runs the migrations.
+func Connect(ctx context.Context) error {
+	cfg := Get().Database
+
+	var database *gorm.DB
+	var err error
+
+	backoff := cfg.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		database, err = open(ctx, cfg)
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("database not ready, retrying",
+			"attempt", attempt,
+			"max_attempts", cfg.ConnectAttempts,
+			"retry_in", backoff.String(),
+			"error", err,
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
 	}
 
 	DB = database
-	fmt.Println("✅ Database connected")
-	database.AutoMigrate(
+	slog.Info("database connected", "host", cfg.Host, "name", cfg.Name)
+
+	if err := database.AutoMigrate(
 		&models.User{},
+		&models.Location{},
+		&models.SiteAdmin{},
+		&models.Amenity{},
+		&models.AttributeDefinition{},
 		&models.Resource{},
+		&models.ResourcePhoto{},
+		&models.ResourceApprover{},
 		&models.Reservation{},
+		&models.BookingGroup{},
+		&models.Attendee{},
 		&models.Notification{},
-	)
+		&models.AuditEvent{},
+		&models.RecoveryCode{},
+		&models.RateLimitBucket{},
+		&models.LoginFailure{},
+		&models.APIKey{},
+		&models.SigningKey{},
+	); err != nil {
+		return err
+	}
+
+	// Amenities offered out of the box, on first start only so that those
+	// removed by admins do not come back
+	var amenities int64
+	if err := database.Model(&models.Amenity{}).Count(&amenities).Error; err != nil {
+		return err
+	}
+	if amenities == 0 {
+		if err := database.Create(defaultAmenities()).Error; err != nil {
+			return err
+		}
+	}
+
+	// Emails are unique whatever their case. Accounts created before the
+	// normalisation may collide: the index is then left out with a warning.
+	if err := database.Exec(
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))",
+	).Error; err != nil {
+		slog.Warn("case-insensitive email index not created, duplicate emails must be merged", "error", err)
+	}
+	return nil
+}
+
+// ConnectDatabase connects with the configured retries and panics on failure.
+func ConnectDatabase() {
+	if err := Connect(context.Background()); err != nil {
+		panic("❌ Failed to connect to database: " + err.Error())
+	}
+}
+
+func open(ctx context.Context, cfg DatabaseConfig) (*gorm.DB, error) {
+	database, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.Use(telemetry.GormPlugin{}); err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// Ping checks that the database answers, for readiness probes.
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return fmt.Errorf("database not connected")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CloseDatabase releases the connection pool.
+func CloseDatabase() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func defaultAmenities() []models.Amenity {
+	amenities := make([]models.Amenity, len(models.DefaultAmenities))
+	copy(amenities, models.DefaultAmenities)
+	return amenities
 }
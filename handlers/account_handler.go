@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/i18n"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// reauthMaxAge is how recent the login of an account without password must
+// be to confirm a sensitive operation without a second factor code.
+const reauthMaxAge = 5 * time.Minute
+
+var (
+	errWrongPassword   = apperr.Forbidden("invalid_current_password", "Mot de passe actuel incorrect")
+	errReauthRequired  = apperr.Forbidden("reauthentication_required", "Confirmez votre identité avec un code de vérification ou en vous reconnectant")
+	errPasswordReused  = apperr.BadRequest("password_reused", "Le nouveau mot de passe doit être différent de l'actuel")
+	errUserUpdate      = apperr.Internal("user_update_failed", "Échec de la mise à jour de l'utilisateur", nil)
+	errTokenGeneration = apperr.Internal("token_generation_failed", "Échec de la génération du token", nil)
+)
+
+type LocaleRequest struct {
+	Locale string `json:"locale"`
+}
+
+// UpdateProfileRequest only changes the fields that are present.
+type UpdateProfileRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Locale   *string `json:"locale"`
+	// Timezone is an IANA zone, "" for UTC.
+	Timezone *string `json:"timezone"`
+	// CurrentPassword is required to change the email (see confirmIdentity
+	// for accounts without password).
+	CurrentPassword string `json:"current_password"`
+	TwoFactorCodeRequest
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordConfirmation re-authenticates sensitive operations (see
+// confirmIdentity for accounts without password).
+type PasswordConfirmation struct {
+	Password string `json:"password"`
+	TwoFactorCodeRequest
+}
+
+// currentUser loads the authenticated, non-deleted user.
+func currentUser(c echo.Context) (models.User, error) {
+	var user models.User
+
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return user, errNotAuthenticated
+	}
+
+	if err := db(c).Where("deleted_at IS NULL").First(&user, "id = ?", userID).Error; err != nil {
+		return user, lookupError(err, errUserNotFound)
+	}
+	return user, nil
+}
+
+func checkPassword(user models.User, password string) error {
+	if bcrypt.CompareHashAndPassword(user.Password, []byte(password)) != nil {
+		return errWrongPassword
+	}
+	return nil
+}
+
+// confirmIdentity re-authenticates a sensitive operation with the password.
+// Accounts provisioned by the identity provider have none: they confirm with
+// a second factor code when two-factor is enabled, or else by logging in
+// again less than reauthMaxAge ago.
+func confirmIdentity(c echo.Context, user *models.User, password string, factor TwoFactorCodeRequest) error {
+	if len(user.Password) > 0 {
+		return checkPassword(*user, password)
+	}
+
+	if user.TOTPEnabled && (factor.Code != "" || factor.RecoveryCode != "") {
+		ok, err := verifySecondFactor(c, user, factor)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactor
+		}
+		return nil
+	}
+
+	if authTime, ok := middleware.AuthTime(c); ok && time.Since(authTime) <= reauthMaxAge {
+		return nil
+	}
+	return errReauthRequired.WithDetails(echo.Map{
+		"two_factor": user.TOTPEnabled,
+		"max_age":    int(reauthMaxAge.Seconds()),
+	})
+}
+
+// respondWithToken answers with the user and a renewed token, whose claims
+// (email, locale) reflect the update.
+func respondWithToken(c echo.Context, user models.User) error {
+	token, err := middleware.RenewToken(c, user)
+	if err != nil {
+		return errTokenGeneration.Wrap(err)
+	}
+
+	return c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  user,
+	})
+}
+
+// revokeSessions increments the user's token version: every session token
+// issued before is refused from now on.
+func revokeSessions(tx *gorm.DB, user *models.User) error {
+	if err := tx.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return err
+	}
+	user.TokenVersion++
+	middleware.ForgetUser(user.ID)
+	return nil
+}
+
+/*
+GET /me
+Authenticated – profile of the current user
+*/
+func GetMe(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+/*
+PATCH /me
+Authenticated – update username, email (current password, or for accounts
+without password a code or a recent login, required), preferred language or
+timezone. Returns a new token.
+*/
+func UpdateMe(c echo.Context) error {
+	var req UpdateProfileRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	before := user
+
+	updates := map[string]interface{}{}
+
+	if req.Username != nil {
+		username, err := normalizeUsername(*req.Username)
+		if err != nil {
+			return err
+		}
+		updates["username"] = username
+	}
+
+	if req.Email != nil {
+		email, err := normalizeEmail(*req.Email)
+		if err != nil {
+			return err
+		}
+		if email != user.Email {
+			if err := confirmIdentity(c, &user, req.CurrentPassword, req.TwoFactorCodeRequest); err != nil {
+				return err
+			}
+			taken, err := emailTaken(c, email, user.ID)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return errEmailTaken
+			}
+			updates["email"] = email
+		}
+	}
+
+	if req.Locale != nil {
+		if err := validateLocale(*req.Locale); err != nil {
+			return err
+		}
+		updates["locale"] = *req.Locale
+	}
+
+	if req.Timezone != nil {
+		if *req.Timezone != "" && !models.IsValidTimezone(*req.Timezone) {
+			return errInvalidTimezone
+		}
+		updates["timezone"] = *req.Timezone
+	}
+
+	if len(updates) > 0 {
+		if err := db(c).Model(&user).Updates(updates).Error; err != nil {
+			return errUserUpdate.Wrap(err)
+		}
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.update",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		Before:     before,
+		After:      user,
+	})
+
+	return respondWithToken(c, user)
+}
+
+/*
+PUT /me/locale
+Authenticated – set the preferred language of the current user ("fr", "en",
+or "" to follow Accept-Language). Returns a new token carrying the preference.
+*/
+func UpdateMyLocale(c echo.Context) error {
+	var req LocaleRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := validateLocale(req.Locale); err != nil {
+		return err
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	before := user
+
+	if err := db(c).Model(&user).Update("locale", req.Locale).Error; err != nil {
+		return errUserUpdate.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.locale",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		Before:     before,
+		After:      user,
+	})
+
+	return respondWithToken(c, user)
+}
+
+func validateLocale(locale string) error {
+	if locale != "" && !i18n.IsSupported(locale) {
+		return apperr.BadRequest("invalid_locale", "Langue non prise en charge").
+			WithDetails(echo.Map{"supported": []string{i18n.French, i18n.English}})
+	}
+	return nil
+}
+
+/*
+PUT /me/password
+Authenticated – change the password, the current one is required. The
+other sessions are revoked; the response carries a new token.
+*/
+func ChangePassword(c echo.Context) error {
+	var req ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPassword(user, req.CurrentPassword); err != nil {
+		return err
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return errPasswordReused
+	}
+	if err := validatePassword(req.NewPassword, user.Email, user.Username); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return errPasswordHash.Wrap(err)
+	}
+
+	// Other sessions end with the old password: only the caller gets a new token
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, &user)
+	})
+	if err != nil {
+		return errUserUpdate.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.password",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+	})
+
+	return respondWithToken(c, user)
+}
+
+/*
+DELETE /me
+Authenticated – delete the current account (password, or for accounts
+without password a code or a recent login, required).
+
+  - the last administrator cannot delete their account;
+  - upcoming reservations are cancelled, which frees the slots, and their
+    attendees notified;
+  - notifications, approver designations and recovery codes are deleted;
+  - reservations are kept for the usage statistics: the account is then
+    anonymised (no email, name or password left) instead of deleted;
+  - the audit log keeps the account ID only.
+*/
+func DeleteMe(c echo.Context) error {
+	var req PasswordConfirmation
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := confirmIdentity(c, &user, req.Password, req.TwoFactorCodeRequest); err != nil {
+		return err
+	}
+
+	if last, err := isLastAdmin(c, user); err != nil {
+		return err
+	} else if last {
+		return apperr.Conflict("last_admin", "Impossible de supprimer le dernier administrateur")
+	}
+
+	var cancelled, kept int64
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var upcoming []models.Reservation
+		if err := tx.Preload("Resource").
+			Where("user_id = ? AND start_at > ? AND status IN ?",
+				user.ID, now, []string{models.StatusPending, models.StatusApproved}).
+			Find(&upcoming).Error; err != nil {
+			return err
+		}
+		for _, reservation := range upcoming {
+			if err := tx.Model(&models.Reservation{}).Where("id = ?", reservation.ID).
+				Updates(map[string]interface{}{"status": models.StatusCancelled, "updated_at": now}).Error; err != nil {
+				return err
+			}
+			reservation.User = user
+			if err := notifyAttendees(tx, reservation, "meeting_cancelled"); err != nil {
+				return err
+			}
+		}
+		cancelled = int64(len(upcoming))
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.ResourceApprover{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Attendee{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Reservation{}).Where("user_id = ?", user.ID).Count(&kept).Error; err != nil {
+			return err
+		}
+		if kept == 0 {
+			return tx.Delete(&models.User{}, "id = ?", user.ID).Error
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"email":        fmt.Sprintf("deleted-%s@deleted.invalid", user.ID),
+			"username":     "",
+			"password":     nil,
+			"role":         "user",
+			"locale":       "",
+			"totp_secret":  "",
+			"totp_enabled": false,
+			"oidc_subject": nil,
+			"deleted_at":   now,
+		}).Error
+	})
+	if err != nil {
+		return apperr.Internal("user_delete_failed", "Échec de la suppression de l'utilisateur", err)
+	}
+
+	middleware.ForgetUser(user.ID)
+
+	result := echo.Map{
+		"anonymised":             kept > 0,
+		"cancelled_reservations": cancelled,
+		"kept_reservations":      kept,
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.self_delete",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		After:      result,
+	})
+
+	return c.JSON(http.StatusOK, result)
+}
@@ -2,35 +2,58 @@ package handlers
 
 import (
 	"net/http"
-	"spacebook/config"
+	"spacebook/apperr"
+	"spacebook/i18n"
+	"spacebook/middleware"
 	"spacebook/models"
 
 	"github.com/labstack/echo/v4"
 )
 
+/*
+GET /admin/notifications
+Admin only – the notifications, those about the resources of their sites
+for site admins
+*/
 func GetAdminNotifications(c echo.Context) error {
 	var notifications []models.Notification
 
 	// Latest notifications first
-	config.DB.Order("created_at desc").Find(&notifications)
+	if err := scopeToAdminSites(c, db(c)).Order("created_at desc").Find(&notifications).Error; err != nil {
+		return apperr.Internal("notifications_fetch_failed", "Échec de la récupération des notifications", err)
+	}
+
+	localizeNotifications(c, notifications)
 
 	return c.JSON(http.StatusOK, notifications)
 }
 
+/*
+PUT /admin/notifications/:id/read
+Admin only – mark a notification as read, within their sites for site admins
+*/
 func MarkNotificationAsRead(c echo.Context) error {
 	id := c.Param("id")
 
-	result := config.DB.Model(&models.Notification{}).
+	result := scopeToAdminSites(c, db(c).Model(&models.Notification{})).
 		Where("id = ?", id).
 		Update("is_read", true)
 
+	if result.Error != nil {
+		return apperr.Internal("notification_update_failed", "Échec de la mise à jour de la notification", result.Error)
+	}
+
 	if result.RowsAffected == 0 {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "Notification introuvable",
-		})
+		return apperr.NotFound("notification_not_found", "Notification introuvable")
 	}
 
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "notification.read",
+		EntityType: "notification",
+		EntityID:   id,
+	})
+
 	return c.JSON(http.StatusOK, map[string]string{
-		"message": "Notification marquée comme lue",
+		"message": i18n.Message(c, "notification_marked_read", nil),
 	})
 }
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"spacebook/apperr"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// amenityCode matches the identifiers of amenities and attributes:
+// lowercase words separated by underscores.
+var amenityCode = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+var (
+	errInvalidAmenityCode = apperr.BadRequest("invalid_amenity_code", "Code d'équipement invalide (minuscules, chiffres et _)")
+	errAmenityNotFound    = apperr.NotFound("amenity_not_found", "Équipement introuvable")
+	errAmenitiesFetch     = apperr.Internal("amenities_fetch_failed", "Échec de la récupération des équipements", nil)
+)
+
+/*
+GET /amenities
+Public – list the amenities resources can be tagged and filtered with
+*/
+func GetAmenities(c echo.Context) error {
+	var amenities []models.Amenity
+	if err := db(c).Order("label").Find(&amenities).Error; err != nil {
+		return errAmenitiesFetch.Wrap(err)
+	}
+	return c.JSON(http.StatusOK, amenities)
+}
+
+/*
+POST /admin/amenities
+Global admin only – add an amenity
+*/
+func CreateAmenity(c echo.Context) error {
+	var amenity models.Amenity
+	if err := c.Bind(&amenity); err != nil {
+		return errInvalidBody
+	}
+
+	amenity.ID = uuid.Nil
+	amenity.Code = strings.TrimSpace(amenity.Code)
+	amenity.Label = strings.TrimSpace(amenity.Label)
+	if !amenityCode.MatchString(amenity.Code) {
+		return errInvalidAmenityCode
+	}
+	if amenity.Label == "" {
+		return apperr.BadRequest("amenity_label_required", "Le libellé de l'équipement est requis")
+	}
+
+	var count int64
+	if err := db(c).Model(&models.Amenity{}).Where("code = ?", amenity.Code).Count(&count).Error; err != nil {
+		return errAmenitiesFetch.Wrap(err)
+	}
+	if count > 0 {
+		return apperr.Conflict("amenity_exists", "Cet équipement existe déjà")
+	}
+
+	if err := db(c).Create(&amenity).Error; err != nil {
+		return apperr.Internal("amenity_create_failed", "Échec de la création de l'équipement", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "amenity.create",
+		EntityType: "amenity",
+		EntityID:   amenity.ID.String(),
+		After:      amenity,
+	})
+
+	return c.JSON(http.StatusCreated, amenity)
+}
+
+/*
+DELETE /admin/amenities/:id
+Global admin only – remove an amenity from the list and from the resources
+tagged with it
+*/
+func DeleteAmenity(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return errAmenityNotFound
+	}
+
+	var amenity models.Amenity
+	if err := db(c).First(&amenity, "id = ?", id).Error; err != nil {
+		return lookupError(err, errAmenityNotFound)
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM resource_amenities WHERE amenity_id = ?", amenity.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&amenity).Error
+	})
+	if err != nil {
+		return apperr.Internal("amenity_delete_failed", "Échec de la suppression de l'équipement", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "amenity.delete",
+		EntityType: "amenity",
+		EntityID:   amenity.ID.String(),
+		Before:     amenity,
+	})
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// amenitiesByCode loads the amenities with the given codes, refusing
+// unknown ones.
+func amenitiesByCode(c echo.Context, codes []string) ([]models.Amenity, error) {
+	amenities := []models.Amenity{}
+	if len(codes) == 0 {
+		return amenities, nil
+	}
+
+	if err := db(c).Where("code IN ?", codes).Find(&amenities).Error; err != nil {
+		return nil, errAmenitiesFetch.Wrap(err)
+	}
+
+	found := make(map[string]bool, len(amenities))
+	for _, amenity := range amenities {
+		found[amenity.Code] = true
+	}
+	var unknown []string
+	for _, code := range codes {
+		if !found[code] {
+			unknown = append(unknown, code)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, errAmenityNotFound.WithDetails(echo.Map{"unknown_amenities": unknown})
+	}
+	return amenities, nil
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// serviceAccountDomain is used for the placeholder emails of service
+// accounts (.invalid never resolves).
+const serviceAccountDomain = "service.spacebook.invalid"
+
+var (
+	errAPIKeyNameRequired = apperr.BadRequest("api_key_name_required", "Le nom de la clé d'API est requis")
+	errInvalidScope       = apperr.BadRequest("invalid_scope", "Permissions de clé d'API invalides")
+	errInvalidExpiry      = apperr.BadRequest("invalid_expiry", "La date d'expiration doit être dans le futur")
+	errInvalidRole        = apperr.BadRequest("invalid_role", "Rôle invalide")
+	errNotServiceAccount  = apperr.BadRequest("not_service_account", "Les clés d'API sont réservées aux comptes de service")
+	errInvalidAPIKeyID    = apperr.BadRequest("invalid_api_key_id", "ID de clé d'API invalide")
+	errAPIKeyNotFound     = apperr.NotFound("api_key_not_found", "Clé d'API introuvable")
+)
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is optional; a key without expiry lasts until revoked.
+	ExpiresAt *time.Time `json:"expires_at"`
+	// UserID selects an existing service account. Without it, a service
+	// account named after the key is created with Role (user by default).
+	UserID *uuid.UUID `json:"user_id"`
+	Role   string     `json:"role"`
+}
+
+type CreateAPIKeyResponse struct {
+	// Key is only returned here: it is stored hashed.
+	Key    string        `json:"key"`
+	APIKey models.APIKey `json:"api_key"`
+	User   models.User   `json:"user"`
+}
+
+/*
+POST /admin/api-keys
+Admin only – create an API key for a service account (new or existing).
+The key is returned once.
+*/
+func CreateAPIKey(c echo.Context) error {
+	var req CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errAPIKeyNameRequired
+	}
+
+	var invalid []string
+	for _, scope := range req.Scopes {
+		if !middleware.IsScope(scope) {
+			invalid = append(invalid, scope)
+		}
+	}
+	if len(req.Scopes) == 0 || len(invalid) > 0 {
+		return errInvalidScope.WithDetails(echo.Map{"invalid_scopes": invalid, "allowed_scopes": middleware.Scopes})
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errInvalidExpiry
+	}
+
+	if req.Role == "" {
+		req.Role = "user"
+	}
+	if req.Role != "user" && req.Role != "admin" {
+		return errInvalidRole
+	}
+
+	adminID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return errNotAuthenticated
+	}
+
+	key, prefix, hash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		return apperr.Internal("api_key_create_failed", "Échec de la création de la clé d'API", err)
+	}
+
+	var user models.User
+	apiKey := models.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    strings.Join(req.Scopes, " "),
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: adminID,
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if req.UserID != nil {
+			if err := tx.Where("deleted_at IS NULL").First(&user, "id = ?", *req.UserID).Error; err != nil {
+				return lookupError(err, errUserNotFound)
+			}
+			// A key must not bypass a person's password and second factor
+			if !user.ServiceAccount {
+				return errNotServiceAccount
+			}
+		} else {
+			id := uuid.New()
+			user = models.User{
+				ID:             id,
+				Email:          "svc-" + id.String() + "@" + serviceAccountDomain,
+				Username:       req.Name,
+				Role:           req.Role,
+				ServiceAccount: true,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return apperr.Internal("user_create_failed", "Échec de la création de l'utilisateur", err)
+			}
+		}
+
+		apiKey.UserID = user.ID
+		if err := tx.Create(&apiKey).Error; err != nil {
+			return apperr.Internal("api_key_create_failed", "Échec de la création de la clé d'API", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "api_key.create",
+		EntityType: "api_key",
+		EntityID:   apiKey.ID.String(),
+		After:      apiKey,
+	})
+
+	return c.JSON(http.StatusCreated, CreateAPIKeyResponse{
+		Key:    key,
+		APIKey: apiKey,
+		User:   user,
+	})
+}
+
+/*
+GET /admin/api-keys
+Admin only – list API keys (without the keys themselves), with last use
+*/
+func GetAPIKeys(c echo.Context) error {
+	var keys []models.APIKey
+
+	if err := db(c).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return apperr.Internal("api_keys_fetch_failed", "Échec de la récupération des clés d'API", err)
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+/*
+DELETE /admin/api-keys/:id
+Admin only – revoke an API key; it is refused from the next request on
+*/
+func RevokeAPIKey(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return errInvalidAPIKeyID
+	}
+
+	var apiKey models.APIKey
+	if err := db(c).First(&apiKey, "id = ?", id).Error; err != nil {
+		return lookupError(err, errAPIKeyNotFound)
+	}
+
+	if apiKey.RevokedAt == nil {
+		before := apiKey
+		now := time.Now()
+		if err := db(c).Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			return apperr.Internal("api_key_revoke_failed", "Échec de la révocation de la clé d'API", err)
+		}
+
+		middleware.SetAudit(c, middleware.AuditEntry{
+			Action:     "api_key.revoke",
+			EntityType: "api_key",
+			EntityID:   apiKey.ID.String(),
+			Before:     before,
+			After:      apiKey,
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
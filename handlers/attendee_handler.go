@@ -0,0 +1,646 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/calendar"
+	"spacebook/i18n"
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/schedule"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxAttendees bounds the invitations of a reservation whose resource does
+// not limit its seats.
+const maxAttendees = 200
+
+var (
+	errInvalidAttendeeID   = apperr.BadRequest("invalid_attendee_id", "ID de participant invalide")
+	errAttendeeNotFound    = apperr.NotFound("attendee_not_found", "Participant introuvable")
+	errAttendeesRequired   = apperr.BadRequest("attendees_required", "Indiquez au moins un participant (user_ids ou emails)")
+	errTooManyAttendees    = apperr.Conflict("too_many_attendees", "Le nombre de participants dépasse la capacité de la salle")
+	errInvalidSeats        = apperr.BadRequest("invalid_seats", "Le nombre de places ne peut pas être négatif")
+	errNotReservationOwner = apperr.Forbidden("not_reservation_owner", "Seul l'organisateur peut gérer les participants")
+	errInvitationNotFound  = apperr.NotFound("invitation_not_found", "Invitation introuvable")
+	errReservationClosed   = apperr.Conflict("reservation_closed", "La réservation est terminée, refusée ou annulée")
+	errAttendeesFetch      = apperr.Internal("attendees_fetch_failed", "Échec de la récupération des participants", nil)
+	errAttendeesUpdate     = apperr.Internal("attendees_update_failed", "Échec de la mise à jour des participants", nil)
+)
+
+type AttendeesRequest struct {
+	// UserIDs invites registered users; Emails invites anyone, registered
+	// users being recognised by their email.
+	UserIDs []uuid.UUID `json:"user_ids"`
+	Emails  []string    `json:"emails"`
+}
+
+/*
+POST /reservations/:id/attendees
+Organizer – invite registered users and external guests. Registered users
+are notified; the tokens of external guests are returned once, to be sent
+to them.
+*/
+func AddAttendees(c echo.Context) error {
+	reservation, err := ownReservation(c)
+	if err != nil {
+		return err
+	}
+
+	var req AttendeesRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+	if len(req.UserIDs) == 0 && len(req.Emails) == 0 {
+		return errAttendeesRequired
+	}
+
+	// Invitations by email, registered users first
+	invited := map[string]models.Attendee{}
+	var order []string
+	add := func(attendee models.Attendee) {
+		if attendee.Email == reservation.User.Email {
+			return
+		}
+		if _, ok := invited[attendee.Email]; !ok {
+			order = append(order, attendee.Email)
+		}
+		if existing, ok := invited[attendee.Email]; !ok || existing.External() {
+			invited[attendee.Email] = attendee
+		}
+	}
+
+	var emails []string
+	for _, email := range req.Emails {
+		normalized, err := normalizeEmail(email)
+		if err != nil {
+			return errInvalidEmail.WithDetails(echo.Map{"email": email})
+		}
+		emails = append(emails, normalized)
+	}
+
+	var users []models.User
+	if len(req.UserIDs) > 0 || len(emails) > 0 {
+		if err := db(c).
+			Where("id IN ? OR email IN ?", append(req.UserIDs, uuid.Nil), append(emails, "")).
+			Where("service_account = ? AND deleted_at IS NULL", false).
+			Find(&users).Error; err != nil {
+			return errAttendeesFetch.Wrap(err)
+		}
+	}
+	byID := map[uuid.UUID]models.User{}
+	byEmail := map[string]models.User{}
+	for _, user := range users {
+		byID[user.ID] = user
+		byEmail[user.Email] = user
+	}
+
+	for _, id := range req.UserIDs {
+		user, ok := byID[id]
+		if !ok {
+			return errUserNotFound.WithDetails(echo.Map{"user_id": id})
+		}
+		add(internalAttendee(reservation.ID, user))
+	}
+	for _, email := range emails {
+		if user, ok := byEmail[email]; ok {
+			add(internalAttendee(reservation.ID, user))
+		} else {
+			add(models.Attendee{ReservationID: reservation.ID, Email: email})
+		}
+	}
+
+	var created []models.Attendee
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		// Locked so that concurrent invitations cannot overbook the room
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").First(&models.Reservation{}, "id = ?", reservation.ID).Error; err != nil {
+			return err
+		}
+
+		var existing []models.Attendee
+		if err := tx.Where("reservation_id = ?", reservation.ID).Find(&existing).Error; err != nil {
+			return err
+		}
+		present := map[string]bool{}
+		attending := 0
+		for _, attendee := range existing {
+			present[attendee.Email] = true
+			if attendee.Status != models.InvitationDeclined {
+				attending++
+			}
+		}
+
+		for _, email := range order {
+			if present[email] {
+				continue
+			}
+			attendee := invited[email]
+			attendee.ID = uuid.New()
+			attendee.Status = models.InvitationPending
+			if attendee.External() {
+				token, err := randomToken()
+				if err != nil {
+					return err
+				}
+				attendee.Token = token
+				attendee.TokenHash = hashInvitationToken(token)
+			}
+			created = append(created, attendee)
+		}
+
+		if err := checkSeats(reservation.Resource, attending+len(created)); err != nil {
+			return err
+		}
+		if len(created) == 0 {
+			return nil
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&created).Error; err != nil {
+			return err
+		}
+
+		for _, attendee := range created {
+			if attendee.External() {
+				continue
+			}
+			notification := newNotification(attendee.UserID, "invitation", "meeting_invitation", meetingParams(reservation, i18n.Params{
+				"invitation_id": attendee.ID.String(),
+			}))
+			if err := tx.Create(&notification).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if err != nil {
+		return errAttendeesUpdate.Wrap(err)
+	}
+
+	if len(created) > 0 {
+		// The tokens are only given to the organizer: the log keeps their hash
+		audited := slices.Clone(created)
+		for i := range audited {
+			audited[i].Token = ""
+		}
+		middleware.SetAudit(c, middleware.AuditEntry{
+			Action:     "reservation.attendees_add",
+			EntityType: "reservation",
+			EntityID:   reservation.ID.String(),
+			After:      audited,
+		})
+	}
+
+	if created == nil {
+		created = []models.Attendee{}
+	}
+	return c.JSON(http.StatusCreated, created)
+}
+
+/*
+DELETE /reservations/:id/attendees/:attendee_id
+Organizer – withdraw an invitation
+*/
+func RemoveAttendee(c echo.Context) error {
+	reservation, err := ownReservation(c)
+	if err != nil {
+		return err
+	}
+
+	attendeeID, err := uuid.Parse(c.Param("attendee_id"))
+	if err != nil {
+		return errInvalidAttendeeID
+	}
+
+	var attendee models.Attendee
+	if err := db(c).First(&attendee, "id = ? AND reservation_id = ?", attendeeID, reservation.ID).Error; err != nil {
+		return lookupError(err, errAttendeeNotFound)
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&attendee).Error; err != nil {
+			return err
+		}
+		if attendee.External() || attendee.Status == models.InvitationDeclined {
+			return nil
+		}
+		notification := newNotification(attendee.UserID, "invitation", "meeting_invitation_withdrawn", meetingParams(reservation, nil))
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		return errAttendeesUpdate.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "reservation.attendee_remove",
+		EntityType: "reservation",
+		EntityID:   reservation.ID.String(),
+		Before:     attendee,
+	})
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+GET /me/invitations
+Authenticated – invitations to upcoming meetings
+*/
+func GetMyInvitations(c echo.Context) error {
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return errNotAuthenticated
+	}
+
+	var invitations []models.Attendee
+	if err := db(c).
+		Preload("Reservation.Resource").
+		Preload("Reservation.User").
+		Joins("JOIN reservations ON reservations.id = attendees.reservation_id").
+		Where("attendees.user_id = ?", userID).
+		Where("reservations.end_at > ?", time.Now()).
+		Where("reservations.status NOT IN ?", releasedStatuses).
+		Order("reservations.start_at").
+		Find(&invitations).Error; err != nil {
+
+		return errAttendeesFetch.Wrap(err)
+	}
+
+	return c.JSON(http.StatusOK, invitations)
+}
+
+/*
+PUT /me/invitations/:id/accept
+Authenticated – accept an invitation
+*/
+func AcceptInvitation(c echo.Context) error {
+	return answerMyInvitation(c, models.InvitationAccepted)
+}
+
+/*
+PUT /me/invitations/:id/decline
+Authenticated – decline an invitation
+*/
+func DeclineInvitation(c echo.Context) error {
+	return answerMyInvitation(c, models.InvitationDeclined)
+}
+
+/*
+PUT /invitations/:token/accept
+Public – an external guest accepts an invitation
+*/
+func AcceptInvitationByToken(c echo.Context) error {
+	return answerInvitationByToken(c, models.InvitationAccepted)
+}
+
+/*
+PUT /invitations/:token/decline
+Public – an external guest declines an invitation
+*/
+func DeclineInvitationByToken(c echo.Context) error {
+	return answerInvitationByToken(c, models.InvitationDeclined)
+}
+
+func answerMyInvitation(c echo.Context, status string) error {
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return errNotAuthenticated
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return errInvalidAttendeeID
+	}
+
+	var attendee models.Attendee
+	if err := db(c).First(&attendee, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return lookupError(err, errInvitationNotFound)
+	}
+	return answerInvitation(c, attendee, status)
+}
+
+func answerInvitationByToken(c echo.Context, status string) error {
+	attendee, err := invitationByToken(c)
+	if err != nil {
+		return err
+	}
+	return answerInvitation(c, attendee, status)
+}
+
+// answerInvitation records the answer of an attendee and notifies the
+// organizer. Accepting again after declining takes a seat back, if any is
+// left.
+func answerInvitation(c echo.Context, attendee models.Attendee, status string) error {
+	var reservation models.Reservation
+	if err := db(c).Preload("Resource").Preload("User").
+		First(&reservation, "id = ?", attendee.ReservationID).Error; err != nil {
+		return lookupError(err, errInvitationNotFound)
+	}
+	if !reservationOpen(reservation) {
+		return errReservationClosed
+	}
+
+	before := attendee
+	now := time.Now()
+
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		if attendee.Status == models.InvitationDeclined && status == models.InvitationAccepted {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id").First(&models.Reservation{}, "id = ?", reservation.ID).Error; err != nil {
+				return err
+			}
+			var attending int64
+			if err := tx.Model(&models.Attendee{}).
+				Where("reservation_id = ? AND status != ?", reservation.ID, models.InvitationDeclined).
+				Count(&attending).Error; err != nil {
+				return err
+			}
+			if err := checkSeats(reservation.Resource, int(attending)+1); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&attendee).Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		code := "invitation_accepted"
+		if status == models.InvitationDeclined {
+			code = "invitation_declined"
+		}
+		name := attendee.Name
+		if name == "" {
+			name = attendee.Email
+		}
+		notification := newNotification(&reservation.UserID, "invitation", code, meetingParams(reservation, i18n.Params{
+			"attendee": name,
+		}))
+		return tx.Create(&notification).Error
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if err != nil {
+		return errAttendeesUpdate.Wrap(err)
+	}
+
+	attendee.Status = status
+	attendee.RespondedAt = &now
+
+	action := "invitation.accept"
+	if status == models.InvitationDeclined {
+		action = "invitation.decline"
+	}
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     action,
+		EntityType: "reservation",
+		EntityID:   reservation.ID.String(),
+		Before:     before,
+		After:      attendee,
+	})
+
+	return c.JSON(http.StatusOK, attendee)
+}
+
+/*
+GET /reservations/:id/ics
+Organizer or attendee – the reservation as an iCalendar event
+*/
+func GetReservationCalendar(c echo.Context) error {
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return errNotAuthenticated
+	}
+
+	reservation, err := findReservationForCalendar(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	allowed := reservation.UserID == userID
+	for _, attendee := range reservation.Attendees {
+		if attendee.UserID != nil && *attendee.UserID == userID {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return errReservationNotFound
+	}
+
+	return writeCalendar(c, reservation)
+}
+
+/*
+GET /invitations/:token/ics
+Public – the meeting an external guest is invited to, as an iCalendar event
+*/
+func GetInvitationCalendar(c echo.Context) error {
+	attendee, err := invitationByToken(c)
+	if err != nil {
+		return err
+	}
+
+	reservation, err := findReservationForCalendar(c, attendee.ReservationID.String())
+	if err != nil {
+		return err
+	}
+	return writeCalendar(c, reservation)
+}
+
+// ownReservation loads the reservation identified by the :id parameter,
+// with its resource and organizer, and checks that the authenticated user
+// organizes it and that it is still open.
+func ownReservation(c echo.Context) (models.Reservation, error) {
+	var reservation models.Reservation
+
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return reservation, errNotAuthenticated
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return reservation, errInvalidReservationID
+	}
+
+	if err := db(c).Preload("Resource").Preload("User").First(&reservation, "id = ?", id).Error; err != nil {
+		return reservation, lookupError(err, errReservationNotFound)
+	}
+	if reservation.UserID != userID {
+		return reservation, errNotReservationOwner
+	}
+	if !reservationOpen(reservation) {
+		return reservation, errReservationClosed
+	}
+	return reservation, nil
+}
+
+// reservationOpen reports whether attendees can still be invited or answer:
+// the reservation is neither over nor released.
+func reservationOpen(reservation models.Reservation) bool {
+	return reservation.EndAt.After(time.Now()) && !slices.Contains(releasedStatuses, reservation.Status)
+}
+
+// checkSeats refuses more attendees than the resource seats, the organizer
+// taking one seat.
+func checkSeats(resource models.Resource, attendees int) error {
+	limit := maxAttendees
+	if resource.Seats > 0 {
+		limit = resource.Seats - 1
+	}
+	if attendees > limit {
+		return errTooManyAttendees.WithDetails(echo.Map{
+			"seats":     resource.Seats,
+			"attendees": attendees,
+			"max":       limit,
+		})
+	}
+	return nil
+}
+
+func internalAttendee(reservationID uuid.UUID, user models.User) models.Attendee {
+	userID := user.ID
+	return models.Attendee{
+		ReservationID: reservationID,
+		UserID:        &userID,
+		Email:         user.Email,
+		Name:          user.Username,
+	}
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// invitationByToken loads the invitation of an external guest from the
+// :token parameter.
+func invitationByToken(c echo.Context) (models.Attendee, error) {
+	var attendee models.Attendee
+
+	token := c.Param("token")
+	if token == "" {
+		return attendee, errInvitationNotFound
+	}
+	if err := db(c).First(&attendee, "token_hash = ?", hashInvitationToken(token)).Error; err != nil {
+		return attendee, lookupError(err, errInvitationNotFound)
+	}
+	return attendee, nil
+}
+
+// meetingParams are the parameters of the notifications about a meeting,
+// with extra ones.
+func meetingParams(reservation models.Reservation, extra i18n.Params) i18n.Params {
+	params := i18n.Params{
+		"organizer": reservation.User.Username,
+		"resource":  reservation.Resource.Name,
+		"start":     schedule.Format(reservation.StartAt, time.UTC),
+	}
+	for key, value := range extra {
+		params[key] = value
+	}
+	return params
+}
+
+// notifyAttendees notifies the registered attendees of a reservation who
+// did not decline.
+func notifyAttendees(tx *gorm.DB, reservation models.Reservation, code string) error {
+	var attendees []models.Attendee
+	if err := tx.
+		Where("reservation_id = ? AND user_id IS NOT NULL AND status != ?", reservation.ID, models.InvitationDeclined).
+		Find(&attendees).Error; err != nil {
+		return err
+	}
+
+	for _, attendee := range attendees {
+		notification := newNotification(attendee.UserID, "invitation", code, meetingParams(reservation, nil))
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findReservationForCalendar(c echo.Context, id string) (models.Reservation, error) {
+	var reservation models.Reservation
+
+	reservationID, err := uuid.Parse(id)
+	if err != nil {
+		return reservation, errInvalidReservationID
+	}
+	if err := db(c).
+		Preload("Resource.Location").
+		Preload("User").
+		Preload("Attendees", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at") }).
+		First(&reservation, "id = ?", reservationID).Error; err != nil {
+
+		return reservation, lookupError(err, errReservationNotFound)
+	}
+	return reservation, nil
+}
+
+var calendarStatuses = map[string]string{
+	models.StatusPending:   calendar.StatusTentative,
+	models.StatusApproved:  calendar.StatusConfirmed,
+	models.StatusRejected:  calendar.StatusCancelled,
+	models.StatusCancelled: calendar.StatusCancelled,
+	models.StatusNoShow:    calendar.StatusCancelled,
+	models.StatusBumped:    calendar.StatusCancelled,
+}
+
+var participationStatuses = map[string]string{
+	models.InvitationPending:  calendar.NeedsAction,
+	models.InvitationAccepted: calendar.Accepted,
+	models.InvitationDeclined: calendar.Declined,
+}
+
+// writeCalendar renders the reservation as an iCalendar file.
+func writeCalendar(c echo.Context, reservation models.Reservation) error {
+	event := calendar.Event{
+		UID:       reservation.ID.String() + "@spacebook",
+		Start:     reservation.StartAt,
+		End:       reservation.EndAt,
+		Stamp:     reservation.UpdatedAt,
+		Summary:   reservation.Resource.Name,
+		Status:    calendarStatuses[reservation.Status],
+		Organizer: &calendar.Person{Email: reservation.User.Email, Name: reservation.User.Username},
+	}
+	if reservation.Resource.Location != nil {
+		event.Location = reservation.Resource.Location.Name
+	}
+	event.Description = reservation.Resource.Description
+
+	for _, attendee := range reservation.Attendees {
+		event.Attendees = append(event.Attendees, calendar.Person{
+			Email:  attendee.Email,
+			Name:   attendee.Name,
+			Status: participationStatuses[attendee.Status],
+		})
+	}
+
+	var body bytes.Buffer
+	if err := calendar.Write(&body, event); err != nil {
+		return apperr.Internal("calendar_failed", "Échec de la génération du calendrier", err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="reservation-`+reservation.ID.String()+`.ics"`)
+	return c.Blob(http.StatusOK, calendar.ContentType, body.Bytes())
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"spacebook/apperr"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidAttributes   = apperr.BadRequest("invalid_attributes", "Attributs de ressource invalides")
+	errAttributeNotFound   = apperr.NotFound("attribute_not_found", "Attribut introuvable")
+	errAttributesFetch     = apperr.Internal("attributes_fetch_failed", "Échec de la récupération des attributs", nil)
+	errInvalidAttributeDef = apperr.BadRequest("invalid_attribute_definition", "Définition d'attribut invalide")
+)
+
+/*
+GET /attributes?type=
+Public – list the custom attributes defined per resource type
+*/
+func GetAttributeDefinitions(c echo.Context) error {
+	query := db(c).Order("resource_type, key")
+	if resourceType := c.QueryParam("type"); resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+
+	var definitions []models.AttributeDefinition
+	if err := query.Find(&definitions).Error; err != nil {
+		return errAttributesFetch.Wrap(err)
+	}
+	return c.JSON(http.StatusOK, definitions)
+}
+
+type AttributeDefinitionRequest struct {
+	ResourceType string   `json:"resource_type"`
+	Key          string   `json:"key"`
+	Label        string   `json:"label"`
+	ValueType    string   `json:"value_type"`
+	Options      []string `json:"options"`
+	Required     bool     `json:"required"`
+}
+
+/*
+POST /admin/attributes
+Global admin only – define a custom attribute for the resources of a type.
+A required attribute applies to resources created or edited afterwards.
+*/
+func CreateAttributeDefinition(c echo.Context) error {
+	var req AttributeDefinitionRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	definition := models.AttributeDefinition{
+		ResourceType: strings.TrimSpace(req.ResourceType),
+		Key:          strings.TrimSpace(req.Key),
+		Label:        strings.TrimSpace(req.Label),
+		ValueType:    req.ValueType,
+		Required:     req.Required,
+	}
+	if definition.ResourceType == "" || !amenityCode.MatchString(definition.Key) || !models.IsValidAttributeType(definition.ValueType) {
+		return errInvalidAttributeDef
+	}
+	if definition.Label == "" {
+		definition.Label = definition.Key
+	}
+
+	if definition.ValueType == models.AttributeEnum {
+		if len(req.Options) == 0 {
+			return errInvalidAttributeDef.WithDetails(echo.Map{"options": "required for an enum"})
+		}
+		definition.Options, _ = json.Marshal(req.Options)
+	} else if len(req.Options) > 0 {
+		return errInvalidAttributeDef.WithDetails(echo.Map{"options": "only for an enum"})
+	}
+
+	var count int64
+	if err := db(c).Model(&models.AttributeDefinition{}).
+		Where("resource_type = ? AND key = ?", definition.ResourceType, definition.Key).
+		Count(&count).Error; err != nil {
+		return errAttributesFetch.Wrap(err)
+	}
+	if count > 0 {
+		return apperr.Conflict("attribute_exists", "Cet attribut existe déjà pour ce type de ressource")
+	}
+
+	if err := db(c).Create(&definition).Error; err != nil {
+		return apperr.Internal("attribute_create_failed", "Échec de la création de l'attribut", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "attribute.create",
+		EntityType: "attribute",
+		EntityID:   definition.ID.String(),
+		After:      definition,
+	})
+
+	return c.JSON(http.StatusCreated, definition)
+}
+
+/*
+DELETE /admin/attributes/:id
+Global admin only – remove a custom attribute and its values
+*/
+func DeleteAttributeDefinition(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return errAttributeNotFound
+	}
+
+	var definition models.AttributeDefinition
+	if err := db(c).First(&definition, "id = ?", id).Error; err != nil {
+		return lookupError(err, errAttributeNotFound)
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Resource{}).
+			Where("type = ? AND attributes IS NOT NULL", definition.ResourceType).
+			Update("attributes", gorm.Expr("attributes - ?", definition.Key)).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&definition).Error
+	})
+	if err != nil {
+		return apperr.Internal("attribute_delete_failed", "Échec de la suppression de l'attribut", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "attribute.delete",
+		EntityType: "attribute",
+		EntityID:   definition.ID.String(),
+		Before:     definition,
+	})
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkAttributes validates the attributes of a resource of the given type
+// against its definitions and returns them normalised ({} when empty).
+func checkAttributes(c echo.Context, resourceType string, raw models.JSON) (models.JSON, error) {
+	values := map[string]interface{}{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, errInvalidAttributes.WithDetails(echo.Map{"attributes": "must be an object"})
+		}
+	}
+
+	var definitions []models.AttributeDefinition
+	if err := db(c).Where("resource_type = ?", resourceType).Find(&definitions).Error; err != nil {
+		return nil, errAttributesFetch.Wrap(err)
+	}
+
+	invalid := map[string]string{}
+	defined := make(map[string]bool, len(definitions))
+	for _, definition := range definitions {
+		defined[definition.Key] = true
+		value, ok := values[definition.Key]
+		switch {
+		case !ok || value == nil:
+			delete(values, definition.Key)
+			if definition.Required {
+				invalid[definition.Key] = "required"
+			}
+		case !definition.Accepts(value):
+			invalid[definition.Key] = "expected " + definition.ValueType
+		}
+	}
+	for key := range values {
+		if !defined[key] {
+			invalid[key] = "unknown"
+		}
+	}
+
+	if len(invalid) > 0 {
+		return nil, errInvalidAttributes.WithDetails(echo.Map{"invalid_attributes": invalid})
+	}
+
+	normalised, _ := json.Marshal(values)
+	return normalised, nil
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+/*
+GET /admin/audit
+Admin only – list audit events, filterable by actor_id, action, entity_type,
+entity_id, from and to (RFC3339). format=csv exports the result as CSV.
+*/
+func GetAuditEvents(c echo.Context) error {
+	query := db(c).Model(&models.AuditEvent{})
+
+	if actorID := c.QueryParam("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.QueryParam("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.QueryParam("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.QueryParam("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+
+	for param, clause := range map[string]string{"from": "created_at >= ?", "to": "created_at < ?"} {
+		value := c.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return apperr.BadRequest("invalid_date", "Date invalide pour le paramètre "+param).
+				WithDetails(echo.Map{"param": param})
+		}
+		query = query.Where(clause, date)
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(c.QueryParam("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	var events []models.AuditEvent
+	if err := query.
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&events).Error; err != nil {
+
+		return apperr.Internal("audit_fetch_failed", "Échec de la récupération du journal d'audit", err)
+	}
+
+	if wantsCSV(c) {
+		return writeAuditCSV(c, events)
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+func writeAuditCSV(c echo.Context, events []models.AuditEvent) error {
+	rows := make([][]string, 0, len(events))
+	for _, event := range events {
+		actorID := ""
+		if event.ActorID != nil {
+			actorID = event.ActorID.String()
+		}
+		rows = append(rows, []string{
+			event.CreatedAt.Format(time.RFC3339),
+			actorID,
+			event.ActorRole,
+			event.Action,
+			event.EntityType,
+			event.EntityID,
+			event.Method,
+			event.Path,
+			strconv.Itoa(event.Status),
+			event.IP,
+			event.RequestID,
+			string(event.Diff),
+		})
+	}
+
+	return writeCSV(c, "audit.csv", []string{
+		"created_at", "actor_id", "actor_role", "action", "entity_type", "entity_id",
+		"method", "path", "status", "ip", "request_id", "diff",
+	}, rows)
+}
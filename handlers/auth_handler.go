@@ -1,14 +1,31 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"spacebook/apperr"
 	"spacebook/config"
 	"spacebook/middleware"
 	"spacebook/models"
+	"spacebook/ratelimit"
+	"spacebook/telemetry"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidCredentials = apperr.Unauthorized("invalid_credentials", "Identifiants invalides")
+	errLoginLocked        = apperr.TooManyRequests("login_locked", "Trop de tentatives de connexion échouées, réessayez plus tard")
+	errTooManyRequests    = apperr.TooManyRequests("too_many_requests", "Trop de requêtes")
+	errRateLimitFailed    = apperr.Internal("rate_limit_failed", "Échec de la vérification des limites de connexion", nil)
+	errEmailTaken         = apperr.Conflict("email_taken", "Cet email est déjà utilisé")
+	errPasswordHash       = apperr.Internal("password_hash_failed", "Échec du hachage du mot de passe", nil)
 )
 
 type RegisterRequest struct {
@@ -30,54 +47,64 @@ type AuthResponse struct {
 func Register(c echo.Context) error {
 	var req RegisterRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Données invalides",
-		})
+		return errInvalidBody
 	}
 
 	if req.Email == "" || req.Password == "" || req.Username == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Email, nom d'utilisateur et mot de passe requis",
-		})
+		return apperr.BadRequest("register_fields_missing", "Email, nom d'utilisateur et mot de passe requis")
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return err
+	}
+	username, err := normalizeUsername(req.Username)
+	if err != nil {
+		return err
+	}
+	if err := validatePassword(req.Password, email, username); err != nil {
+		return err
 	}
 
 	// Check if user already exists
-	var existingUser models.User
-	if err := config.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		return c.JSON(http.StatusConflict, map[string]string{
-			"error": "Cet email est déjà utilisé",
-		})
+	taken, err := emailTaken(c, email, uuid.Nil)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errEmailTaken
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Échec du hachage du mot de passe",
-		})
+		return errPasswordHash.Wrap(err)
 	}
 
 	user := models.User{
-		Email:    req.Email,
-		Username: req.Username,
+		Email:    email,
+		Username: username,
 		Password: hashedPassword,
 		Role:     "user",
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Échec de la création de l'utilisateur",
-		})
+	if err := db(c).Create(&user).Error; err != nil {
+		return apperr.Internal("user_create_failed", "Échec de la création de l'utilisateur", err)
 	}
 
 	// Generate JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role)
+	token, err := middleware.GenerateToken(user)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Échec de la génération du token",
-		})
+		return apperr.Internal("token_generation_failed", "Échec de la génération du token", err)
 	}
 
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.register",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		After:      user,
+	})
+
 	return c.JSON(http.StatusCreated, AuthResponse{
 		Token: token,
 		User:  user,
@@ -87,42 +114,154 @@ func Register(c echo.Context) error {
 func Login(c echo.Context) error {
 	var req LoginRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Données invalides",
-		})
+		return errInvalidBody
 	}
 
 	if req.Email == "" || req.Password == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Email et mot de passe requis",
-		})
+		return apperr.BadRequest("login_fields_missing", "Email et mot de passe requis")
+	}
+
+	guard := newLoginGuard(c, req.Email)
+	if err := guard.check(); err != nil {
+		return err
 	}
 
 	// Find user
 	var user models.User
-	if err := config.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "Identifiants invalides",
-		})
+	if err := db(c).Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(req.Email))).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperr.Internal("user_lookup_failed", "Échec de la recherche de l'utilisateur", err)
+		}
+		return guard.fail()
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword(user.Password, []byte(req.Password)); err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "Identifiants invalides",
-		})
+		return guard.fail()
+	}
+
+	// Second step required: the session token is issued by LoginTwoFactor
+	if user.TOTPEnabled {
+		return respondWithChallenge(c, user)
+	}
+
+	if err := guard.succeed(); err != nil {
+		return err
 	}
 
 	// Generate JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role)
+	token, err := middleware.GenerateToken(user)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Échec de la génération du token",
-		})
+		return apperr.Internal("token_generation_failed", "Échec de la génération du token", err)
 	}
 
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "auth.login",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+	})
+
 	return c.JSON(http.StatusOK, AuthResponse{
 		Token: token,
 		User:  user,
 	})
 }
+
+// emailTaken reports whether another account than except uses the address,
+// whatever its case (accounts created before normalisation may be mixed-case).
+func emailTaken(c echo.Context, email string, except uuid.UUID) (bool, error) {
+	var count int64
+	err := db(c).Model(&models.User{}).
+		Where("LOWER(email) = ? AND id <> ?", strings.ToLower(email), except).
+		Count(&count).Error
+	if err != nil {
+		return false, apperr.Internal("user_lookup_failed", "Échec de la recherche de l'utilisateur", err)
+	}
+	return count > 0, nil
+}
+
+// loginGuard throttles login attempts per client IP and locks the IP and the
+// account out, for exponentially longer periods, after repeated failures.
+type loginGuard struct {
+	c          echo.Context
+	cfg        config.RateLimitConfig
+	store      ratelimit.Store
+	ipKey      string
+	accountKey string
+}
+
+func newLoginGuard(c echo.Context, email string) loginGuard {
+	return loginGuard{
+		c:          c,
+		cfg:        config.Get().RateLimit,
+		store:      ratelimit.Current(),
+		ipKey:      "login:ip:" + c.RealIP(),
+		accountKey: "login:account:" + strings.ToLower(strings.TrimSpace(email)),
+	}
+}
+
+// check refuses the attempt when the IP exceeds its rate or when the IP or
+// the account is locked out. It runs before the password is verified so a
+// locked account cannot be probed.
+func (g loginGuard) check() error {
+	ctx := g.c.Request().Context()
+
+	decision, err := g.store.Allow(ctx, g.ipKey, ratelimit.PerMinute(g.cfg.LoginRequestsPerMinute, g.cfg.LoginBurst))
+	if err != nil {
+		return errRateLimitFailed.Wrap(err)
+	}
+	if !decision.Allowed {
+		return middleware.TooManyRequests(g.c, "login", errTooManyRequests, decision.RetryAfter)
+	}
+
+	for _, key := range []string{g.accountKey, g.ipKey} {
+		lockedUntil, err := g.store.LockedUntil(ctx, key)
+		if err != nil {
+			return errRateLimitFailed.Wrap(err)
+		}
+		if !lockedUntil.IsZero() {
+			return middleware.TooManyRequests(g.c, "lockout", errLoginLocked, time.Until(lockedUntil))
+		}
+	}
+	return nil
+}
+
+// fail records a failed attempt and returns the invalid credentials error.
+func (g loginGuard) fail() error {
+	if err := g.record(); err != nil {
+		return err
+	}
+	return errInvalidCredentials
+}
+
+// record counts a failed attempt against the account and the IP.
+func (g loginGuard) record() error {
+	telemetry.LoginsFailed.Inc()
+	ctx := g.c.Request().Context()
+
+	policy := ratelimit.LockoutPolicy{
+		Base:   g.cfg.LockoutBase,
+		Max:    g.cfg.LockoutMax,
+		Window: g.cfg.FailureWindow,
+	}
+
+	policy.MaxFailures = g.cfg.MaxFailuresPerAccount
+	if _, err := g.store.RecordFailure(ctx, g.accountKey, policy); err != nil {
+		return errRateLimitFailed.Wrap(err)
+	}
+
+	policy.MaxFailures = g.cfg.MaxFailuresPerIP
+	if _, err := g.store.RecordFailure(ctx, g.ipKey, policy); err != nil {
+		return errRateLimitFailed.Wrap(err)
+	}
+	return nil
+}
+
+// succeed clears the account failures. The IP counter is kept so that an
+// attacker cannot reset it by logging into their own account.
+func (g loginGuard) succeed() error {
+	if err := g.store.Reset(g.c.Request().Context(), g.accountKey); err != nil {
+		return errRateLimitFailed.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/i18n"
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxGroupItems bounds the number of resources booked by a group.
+const maxGroupItems = 20
+
+var (
+	errInvalidBookingGroupID      = apperr.BadRequest("invalid_booking_group_id", "ID de groupe de réservations invalide")
+	errBookingGroupNotFound       = apperr.NotFound("booking_group_not_found", "Groupe de réservations introuvable")
+	errGroupItemsRequired         = apperr.BadRequest("group_items_required", "Le groupe doit réserver au moins une ressource")
+	errTooManyGroupItems          = apperr.BadRequest("too_many_group_items", "Le groupe réserve trop de ressources")
+	errDuplicateGroupItem         = apperr.BadRequest("duplicate_group_item", "Une ressource apparaît plusieurs fois dans le groupe")
+	errInvalidGroupApproval       = apperr.BadRequest("invalid_group_approval_mode", "Mode d'approbation invalide (group, item)")
+	errGroupDecisionRequired      = apperr.Conflict("group_decision_required", "Les réservations de ce groupe sont décidées ensemble")
+	errItemDecisionRequired       = apperr.Conflict("item_decision_required", "Les réservations de ce groupe sont décidées une par une")
+	errBookingGroupNotPending     = apperr.Conflict("booking_group_not_pending", "Aucune réservation du groupe n'est à décider")
+	errBookingGroupNotCancellable = apperr.Conflict("booking_group_not_cancellable", "Le groupe ne contient plus de réservation à venir")
+	errGroupCancelNotAllowed      = apperr.Forbidden("booking_group_cancel_not_allowed", "Vous n'êtes pas autorisé à annuler ce groupe")
+	errBookOnBehalfNotAllowed     = apperr.Forbidden("book_on_behalf_not_allowed", "Seuls les administrateurs et les comptes de service peuvent réserver pour un autre utilisateur")
+	errBookingGroupsFetch         = apperr.Internal("booking_groups_fetch_failed", "Échec de la récupération du groupe de réservations", nil)
+)
+
+type BookingGroupItem struct {
+	ResourceID uuid.UUID `json:"resource_id"`
+	Quantity   int       `json:"quantity"`
+}
+
+type BookingGroupRequest struct {
+	// UserID is the user the group is booked for, the caller by default.
+	// Only admins and service accounts may give another one.
+	UserID       uuid.UUID          `json:"user_id"`
+	StartAt      time.Time          `json:"start_at"`
+	EndAt        time.Time          `json:"end_at"`
+	ApprovalMode string             `json:"approval_mode"`
+	Items        []BookingGroupItem `json:"items"`
+}
+
+/*
+POST /reservations/groups
+Authenticated – book several resources for the same window, all or none
+(for another user: admins and service accounts only).
+approval_mode "group" (default) waits for one decision on the whole group,
+"item" lets each resource be approved on its own.
+*/
+func CreateBookingGroup(c echo.Context) error {
+	var req BookingGroupRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	// Stored in UTC whatever the zone sent
+	req.StartAt, req.EndAt = req.StartAt.UTC(), req.EndAt.UTC()
+	if !req.StartAt.Before(req.EndAt) {
+		return errInvalidPeriod
+	}
+
+	if req.ApprovalMode == "" {
+		req.ApprovalMode = models.GroupApprovalGroup
+	}
+	if !models.IsValidGroupApprovalMode(req.ApprovalMode) {
+		return errInvalidGroupApproval
+	}
+
+	if len(req.Items) == 0 {
+		return errGroupItemsRequired
+	}
+	if len(req.Items) > maxGroupItems {
+		return errTooManyGroupItems.WithDetails(echo.Map{"max": maxGroupItems})
+	}
+
+	resourceIDs := make([]uuid.UUID, 0, len(req.Items))
+	seen := make(map[uuid.UUID]bool, len(req.Items))
+	for i := range req.Items {
+		item := &req.Items[i]
+		if seen[item.ResourceID] {
+			return errDuplicateGroupItem.WithDetails(echo.Map{"resource_id": item.ResourceID})
+		}
+		seen[item.ResourceID] = true
+		resourceIDs = append(resourceIDs, item.ResourceID)
+
+		// Une unité par défaut
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		if item.Quantity < 0 {
+			return errInvalidQuantity
+		}
+	}
+
+	// Booked for the authenticated user unless another one is given
+	callerID, _ := c.Get("user_id").(uuid.UUID)
+	if req.UserID == uuid.Nil {
+		if callerID == uuid.Nil {
+			return errUserIDRequired
+		}
+		req.UserID = callerID
+	}
+	onBehalf := req.UserID != callerID
+	if onBehalf && !canBookOnBehalf(c) {
+		return errBookOnBehalfNotAllowed
+	}
+
+	var user models.User
+	if err := db(c).First(&user, "id = ?", req.UserID).Error; err != nil {
+		return lookupError(err, errUserNotFound)
+	}
+	if err := checkNoShowPenalty(c, user.ID); err != nil {
+		return err
+	}
+
+	group := models.BookingGroup{
+		ID:           uuid.New(),
+		UserID:       user.ID,
+		StartAt:      req.StartAt,
+		EndAt:        req.EndAt,
+		ApprovalMode: req.ApprovalMode,
+	}
+
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		// The resources are locked so that concurrent bookings cannot take
+		// the units counted below before the group is created
+		var resources []models.Resource
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", resourceIDs).
+			Order("id").
+			Find(&resources).Error; err != nil {
+			return err
+		}
+		byID := make(map[string]models.Resource, len(resources))
+		for _, resource := range resources {
+			byID[resource.ID] = resource
+		}
+
+		// Checked before anything is written: one item that does not fit
+		// refuses the whole group
+		needsDecision := false
+		for _, item := range req.Items {
+			resource, ok := byID[item.ResourceID.String()]
+			if !ok {
+				return errResourceNotFound.WithDetails(echo.Map{"resource_id": item.ResourceID})
+			}
+			// Site admins only book for others on their sites
+			if onBehalf {
+				if err := checkSiteScope(c, resource.LocationID); err != nil {
+					return err
+				}
+			}
+
+			if item.Quantity > resource.Capacity {
+				return errQuantityOverCapacity.WithDetails(echo.Map{
+					"resource_id": resource.ID,
+					"capacity":    resource.Capacity,
+					"requested":   item.Quantity,
+				})
+			}
+
+			booked, err := bookedQuantity(tx, resource.ID, group.StartAt, group.EndAt)
+			if err != nil {
+				return err
+			}
+			if booked+item.Quantity > resource.Capacity {
+				telemetry.CapacityConflicts.Inc()
+				return errResourceFull.WithDetails(echo.Map{
+					"resource_id": resource.ID,
+					"capacity":    resource.Capacity,
+					"booked":      booked,
+					"available":   max(resource.Capacity-booked, 0),
+					"requested":   item.Quantity,
+				})
+			}
+
+			if resource.ApprovalPolicy != models.ApprovalAuto {
+				needsDecision = true
+			}
+		}
+
+		if err := tx.Omit("Items").Create(&group).Error; err != nil {
+			return err
+		}
+
+		for _, item := range req.Items {
+			resource := byID[item.ResourceID.String()]
+
+			// Decided as a whole, the group stays pending until its decision
+			// even for the resources approved automatically
+			status := models.StatusPending
+			if resource.ApprovalPolicy == models.ApprovalAuto &&
+				(group.ApprovalMode == models.GroupApprovalItem || !needsDecision) {
+				status = models.StatusApproved
+			}
+
+			reservation := models.Reservation{
+				ID:         uuid.New(),
+				UserID:     user.ID,
+				ResourceID: item.ResourceID,
+				StartAt:    group.StartAt,
+				EndAt:      group.EndAt,
+				Status:     status,
+				Quantity:   item.Quantity,
+				GroupID:    &group.ID,
+			}
+			if err := tx.Omit("User", "Resource").Create(&reservation).Error; err != nil {
+				return err
+			}
+			reservation.Resource = resource
+			group.Items = append(group.Items, reservation)
+
+			if status == models.StatusPending && resource.ApprovalPolicy != models.ApprovalAuto {
+				if err := notifyApprovers(tx, resource, "reservation_requested", i18n.Params{
+					"username": user.Username,
+					"resource": resource.Name,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if group.Status() == models.StatusApproved {
+			notification := newNotification(&user.ID, "reservation", "reservation_auto_approved", i18n.Params{
+				"resource": groupResourceNames(group),
+			})
+			return tx.Create(&notification).Error
+		}
+		return nil
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if err != nil {
+		return apperr.Internal("booking_group_create_failed", "Échec de la création du groupe de réservations", err)
+	}
+
+	for _, item := range group.Items {
+		telemetry.ReservationsCreated.WithLabelValues(item.Status).Inc()
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "booking_group.create",
+		EntityType: "booking_group",
+		EntityID:   group.ID.String(),
+		After:      group,
+	})
+
+	return respondWithBookingGroup(c, http.StatusCreated, group)
+}
+
+// canBookOnBehalf reports whether the caller may book for another user:
+// admins, and service accounts (which authenticate with API keys).
+func canBookOnBehalf(c echo.Context) bool {
+	if role, _ := c.Get("role").(string); role == "admin" {
+		return true
+	}
+	_, ok := c.Get("api_key_id").(uuid.UUID)
+	return ok
+}
+
+/*
+GET /reservations/groups/:id
+Owner, admin or approver of one of its resources – a booking group and its
+items
+*/
+func GetBookingGroup(c echo.Context) error {
+	group, err := findBookingGroup(c)
+	if err != nil {
+		return err
+	}
+
+	if userID, _ := c.Get("user_id").(uuid.UUID); userID != group.UserID {
+		allowed := false
+		for _, item := range group.Items {
+			if allowed, err = canDecide(c, item.Resource); err != nil {
+				return apperr.Internal("approvers_fetch_failed", "Échec de la récupération des approbateurs", err)
+			} else if allowed {
+				break
+			}
+		}
+		if !allowed {
+			return errBookingGroupNotFound
+		}
+	}
+
+	return respondWithBookingGroup(c, http.StatusOK, group)
+}
+
+/*
+PUT /admin/reservations/groups/:id/approve
+PUT /reservations/groups/:id/approve
+Admin or approver of all its resources – approve a group decided as a whole
+*/
+func ApproveBookingGroup(c echo.Context) error {
+	return decideBookingGroup(c, models.StatusApproved, "booking_group_approved")
+}
+
+/*
+PUT /admin/reservations/groups/:id/reject
+PUT /reservations/groups/:id/reject
+Admin or approver of all its resources – reject a group decided as a whole,
+releasing all of its items
+*/
+func RejectBookingGroup(c echo.Context) error {
+	return decideBookingGroup(c, models.StatusRejected, "booking_group_rejected")
+}
+
+// decideBookingGroup sets the status of the undecided items of the group
+// identified by the :id parameter and notifies its owner. Rejecting also
+// releases the items approved automatically: the group is all or nothing.
+func decideBookingGroup(c echo.Context, status, notificationCode string) error {
+	group, err := findBookingGroup(c)
+	if err != nil {
+		return err
+	}
+
+	if group.ApprovalMode != models.GroupApprovalGroup {
+		return errItemDecisionRequired
+	}
+
+	// The decider must be allowed on every resource that asks for a decision
+	for _, item := range group.Items {
+		if item.Resource.ApprovalPolicy == models.ApprovalAuto {
+			continue
+		}
+		allowed, err := canDecide(c, item.Resource)
+		if err != nil {
+			return apperr.Internal("approvers_fetch_failed", "Échec de la récupération des approbateurs", err)
+		}
+		if !allowed {
+			return errCannotDecide.WithDetails(echo.Map{"resource_id": item.ResourceID})
+		}
+	}
+
+	decided := []string{models.StatusPending}
+	if status == models.StatusRejected {
+		decided = append(decided, models.StatusApproved)
+	}
+
+	before := group
+	before.Items = append([]models.Reservation(nil), group.Items...)
+
+	var changed int64
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Reservation{}).
+			Where("group_id = ? AND status IN ?", group.ID, decided).
+			Updates(map[string]interface{}{"status": status, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		changed = result.RowsAffected
+		if changed == 0 {
+			return errBookingGroupNotPending
+		}
+
+		notification := newNotification(&group.UserID, "reservation", notificationCode, i18n.Params{
+			"resources": groupResourceNames(group),
+		})
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+
+		for _, item := range group.Items {
+			if !slices.Contains(decided, item.Status) {
+				continue
+			}
+			item.User = group.User
+			if err := notifyAttendees(tx, item, meetingNotificationCode(status)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if err != nil {
+		return apperr.Internal("reservation_update_failed", "Échec de la mise à jour de la réservation", err)
+	}
+
+	telemetry.ReservationDecisions.WithLabelValues(status).Add(float64(changed))
+
+	for i := range group.Items {
+		if slices.Contains(decided, group.Items[i].Status) {
+			group.Items[i].Status = status
+		}
+	}
+
+	action := "booking_group.approve"
+	if status == models.StatusRejected {
+		action = "booking_group.reject"
+	}
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     action,
+		EntityType: "booking_group",
+		EntityID:   group.ID.String(),
+		Before:     before,
+		After:      group,
+	})
+
+	return respondWithBookingGroup(c, http.StatusOK, group)
+}
+
+/*
+PUT /reservations/groups/:id/cancel
+Owner or admin – cancel the items of a group that have not ended yet
+*/
+func CancelBookingGroup(c echo.Context) error {
+	group, err := findBookingGroup(c)
+	if err != nil {
+		return err
+	}
+
+	if userID, _ := c.Get("user_id").(uuid.UUID); userID != group.UserID {
+		if role, _ := c.Get("role").(string); role != "admin" {
+			return errGroupCancelNotAllowed
+		}
+		for _, item := range group.Items {
+			if err := checkSiteScope(c, item.Resource.LocationID); err != nil {
+				return err
+			}
+		}
+	}
+
+	before := group
+	before.Items = append([]models.Reservation(nil), group.Items...)
+
+	now := time.Now()
+	cancellable := func(item models.Reservation) bool {
+		return (item.Status == models.StatusPending || item.Status == models.StatusApproved) && item.EndAt.After(now)
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Reservation{}).
+			Where("group_id = ? AND status IN ? AND end_at > ?",
+				group.ID, []string{models.StatusPending, models.StatusApproved}, now).
+			Updates(map[string]interface{}{"status": models.StatusCancelled, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errBookingGroupNotCancellable
+		}
+
+		for _, item := range group.Items {
+			if !cancellable(item) {
+				continue
+			}
+			item.User = group.User
+			if err := notifyAttendees(tx, item, "meeting_cancelled"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if err != nil {
+		return apperr.Internal("reservation_update_failed", "Échec de la mise à jour de la réservation", err)
+	}
+
+	for i := range group.Items {
+		if cancellable(group.Items[i]) {
+			group.Items[i].Status = models.StatusCancelled
+		}
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "booking_group.cancel",
+		EntityType: "booking_group",
+		EntityID:   group.ID.String(),
+		Before:     before,
+		After:      group,
+	})
+
+	return respondWithBookingGroup(c, http.StatusOK, group)
+}
+
+// findBookingGroup loads the group identified by the :id parameter with its
+// items and their resources.
+func findBookingGroup(c echo.Context) (models.BookingGroup, error) {
+	var group models.BookingGroup
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return group, errInvalidBookingGroupID
+	}
+
+	if err := db(c).
+		Preload("User").
+		Preload("Items", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at") }).
+		Preload("Items.Resource").
+		First(&group, "id = ?", id).Error; err != nil {
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return group, errBookingGroupNotFound
+		}
+		return group, errBookingGroupsFetch.Wrap(err)
+	}
+	return group, nil
+}
+
+// groupResourceNames lists the resources of a group for notifications.
+func groupResourceNames(group models.BookingGroup) string {
+	names := make([]string, 0, len(group.Items))
+	for _, item := range group.Items {
+		names = append(names, item.Resource.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/i18n"
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/schedule"
+	"spacebook/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// noShowBatchSize bounds the reservations released by one run; the next
+// runs release the rest.
+const noShowBatchSize = 500
+
+var (
+	errCheckInNotAllowed   = apperr.Forbidden("check_in_not_allowed", "Seuls l'organisateur et les participants peuvent s'enregistrer")
+	errCheckInNotApproved  = apperr.Conflict("check_in_not_approved", "Seule une réservation approuvée peut être enregistrée")
+	errAlreadyCheckedIn    = apperr.Conflict("already_checked_in", "La présence a déjà été enregistrée")
+	errCheckInWindowClosed = apperr.Conflict("check_in_window_closed", "L'enregistrement n'est pas ouvert pour cette réservation")
+	errInvalidCheckInToken = apperr.Forbidden("invalid_check_in_token", "Code de la salle invalide")
+	errNoShowPenalty       = apperr.Forbidden("no_show_penalty", "Trop de réservations non honorées récemment : nouvelles réservations bloquées")
+)
+
+type CheckInRequest struct {
+	// Token is read from the QR code of resources that have one.
+	Token string `json:"token"`
+}
+
+/*
+POST /reservations/:id/check-in
+Organizer or attendee – record presence, from shortly before the start until
+the grace period after it. Resources with a QR code need its token.
+*/
+func CheckIn(c echo.Context) error {
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return errNotAuthenticated
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return errInvalidReservationID
+	}
+
+	var req CheckInRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	var reservation models.Reservation
+	if err := db(c).Preload("Resource").First(&reservation, "id = ?", id).Error; err != nil {
+		return lookupError(err, errReservationNotFound)
+	}
+
+	if reservation.UserID != userID {
+		var attendees int64
+		if err := db(c).Model(&models.Attendee{}).
+			Where("reservation_id = ? AND user_id = ? AND status != ?", reservation.ID, userID, models.InvitationDeclined).
+			Count(&attendees).Error; err != nil {
+			return errAttendeesFetch.Wrap(err)
+		}
+		if attendees == 0 {
+			return errCheckInNotAllowed
+		}
+	}
+
+	if reservation.Status != models.StatusApproved {
+		return errCheckInNotApproved.WithDetails(echo.Map{"status": reservation.Status})
+	}
+	if reservation.CheckedInAt != nil {
+		return errAlreadyCheckedIn.WithDetails(echo.Map{"checked_in_at": reservation.CheckedInAt})
+	}
+
+	cfg := config.Get().CheckIn
+	now := time.Now()
+	opensAt, closesAt := reservation.StartAt.Add(-cfg.OpensBefore), reservation.StartAt.Add(cfg.GracePeriod)
+	if now.Before(opensAt) || now.After(closesAt) {
+		return errCheckInWindowClosed.WithDetails(echo.Map{"opens_at": opensAt, "closes_at": closesAt})
+	}
+
+	if expected := reservation.Resource.CheckInToken; expected != "" &&
+		subtle.ConstantTimeCompare([]byte(req.Token), []byte(expected)) != 1 {
+		return errInvalidCheckInToken
+	}
+
+	// The worker may release the reservation meanwhile: only an approved
+	// reservation not checked in yet is updated
+	result := db(c).Model(&models.Reservation{}).
+		Where("id = ? AND status = ? AND checked_in_at IS NULL", reservation.ID, models.StatusApproved).
+		Update("checked_in_at", now)
+	if result.Error != nil {
+		return apperr.Internal("reservation_update_failed", "Échec de la mise à jour de la réservation", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errCheckInNotApproved
+	}
+
+	before := reservation
+	reservation.CheckedInAt = &now
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "reservation.check_in",
+		EntityType: "reservation",
+		EntityID:   reservation.ID.String(),
+		Before:     before,
+		After:      reservation,
+	})
+
+	return respondWithReservation(c, http.StatusOK, reservation)
+}
+
+/*
+GET /admin/resources/:id/check-in-token
+Admin only – the token to print as a QR code in the room
+*/
+func GetCheckInToken(c echo.Context) error {
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"resource_id":       resource.ID,
+		"check_in_required": resource.CheckInRequired,
+		"token":             resource.CheckInToken,
+	})
+}
+
+/*
+POST /admin/resources/:id/check-in-token
+Admin only – set a new QR code token, the previous one stops working
+*/
+func RotateCheckInToken(c echo.Context) error {
+	token, err := randomToken()
+	if err != nil {
+		return apperr.Internal("check_in_token_failed", "Échec de la génération du code de la salle", err)
+	}
+	return setCheckInToken(c, token, "resource.check_in_token_rotate")
+}
+
+/*
+DELETE /admin/resources/:id/check-in-token
+Admin only – check in without QR code
+*/
+func DeleteCheckInToken(c echo.Context) error {
+	return setCheckInToken(c, "", "resource.check_in_token_delete")
+}
+
+func setCheckInToken(c echo.Context, token, action string) error {
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
+	if err := db(c).Model(&resource).Update("check_in_token", token).Error; err != nil {
+		return apperr.Internal("resource_update_failed", "Échec de la mise à jour de la ressource", err)
+	}
+
+	// The token itself is not recorded
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     action,
+		EntityType: "resource",
+		EntityID:   resource.ID,
+	})
+
+	if token == "" {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"resource_id":       resource.ID,
+		"check_in_required": resource.CheckInRequired,
+		"token":             token,
+	})
+}
+
+// checkNoShowPenalty refuses new bookings to users who reached the no-show
+// limit within the window; the error tells when they can book again.
+func checkNoShowPenalty(c echo.Context, userID uuid.UUID) error {
+	cfg := config.Get().CheckIn
+	if cfg.NoShowLimit == 0 {
+		return nil
+	}
+
+	var noShows []time.Time
+	if err := db(c).Model(&models.Reservation{}).
+		Where("user_id = ? AND status = ? AND start_at > ?", userID, models.StatusNoShow, time.Now().Add(-cfg.NoShowWindow)).
+		Order("start_at DESC").
+		Limit(cfg.NoShowLimit).
+		Pluck("start_at", &noShows).Error; err != nil {
+		return apperr.Internal("reservations_count_failed", "Échec de la vérification des réservations", err)
+	}
+
+	if len(noShows) < cfg.NoShowLimit {
+		return nil
+	}
+	// Booking reopens when the oldest of the last NoShowLimit no-shows
+	// leaves the window
+	return errNoShowPenalty.WithDetails(echo.Map{
+		"no_shows": len(noShows),
+		"limit":    cfg.NoShowLimit,
+		"until":    noShows[len(noShows)-1].Add(cfg.NoShowWindow),
+	})
+}
+
+// ReleaseNoShows releases as no-shows the approved reservations of resources
+// requiring a check-in that nobody checked in to within the grace period:
+// their capacity is freed, the no-show is counted against the owner, who is
+// notified, and the change is audited.
+func ReleaseNoShows(ctx context.Context) error {
+	cfg := config.Get().CheckIn
+	now := time.Now()
+
+	var released int
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Skipped when locked: another instance is releasing them
+		var reservations []models.Reservation
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "reservations"}, Options: "SKIP LOCKED"}).
+			Select("reservations.*").
+			Joins("JOIN resources ON resources.id = reservations.resource_id").
+			Where("resources.check_in_required").
+			Where("reservations.status = ? AND reservations.checked_in_at IS NULL", models.StatusApproved).
+			Where("reservations.start_at < ?", now.Add(-cfg.GracePeriod)).
+			Order("reservations.start_at").
+			Limit(noShowBatchSize).
+			Preload("Resource").
+			Find(&reservations).Error; err != nil {
+			return err
+		}
+
+		for _, reservation := range reservations {
+			before := reservation
+			reservation.Status = models.StatusNoShow
+			reservation.UpdatedAt = now
+
+			if err := tx.Model(&models.Reservation{}).Where("id = ?", reservation.ID).
+				Updates(map[string]interface{}{"status": reservation.Status, "updated_at": now}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.User{}).Where("id = ?", reservation.UserID).
+				Update("no_shows", gorm.Expr("no_shows + 1")).Error; err != nil {
+				return err
+			}
+
+			notification := newNotification(&reservation.UserID, "reservation", "reservation_no_show", i18n.Params{
+				"resource": reservation.Resource.Name,
+				"start":    schedule.Format(reservation.StartAt, time.UTC),
+			})
+			if err := tx.Create(&notification).Error; err != nil {
+				return err
+			}
+
+			if err := middleware.RecordSystemAudit(tx, middleware.AuditEntry{
+				Action:     "reservation.no_show",
+				EntityType: "reservation",
+				EntityID:   reservation.ID.String(),
+				Before:     before,
+				After:      reservation,
+			}); err != nil {
+				return err
+			}
+		}
+		released = len(reservations)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if released > 0 {
+		telemetry.NoShows.Add(float64(released))
+		slog.InfoContext(ctx, "no-shows released", "count", released)
+	}
+	return nil
+}
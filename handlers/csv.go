@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// wantsCSV reports whether the client asked for a CSV export (?format=csv).
+func wantsCSV(c echo.Context) bool {
+	return c.QueryParam("format") == "csv"
+}
+
+// writeCSV streams rows as a CSV attachment named filename.
+func writeCSV(c echo.Context, filename string, header []string, rows [][]string) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = escapeFormula(cell)
+		}
+		if err := w.Write(cells); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// escapeFormula prefixes the cells a spreadsheet would run as a formula with
+// a quote, so that user input (names, audit paths) is shown as text.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
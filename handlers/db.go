@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"spacebook/config"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// db returns the database handle bound to the request context, so that
+// queries are cancelled with the request and traced under its span.
+func db(c echo.Context) *gorm.DB {
+	return config.DB.WithContext(c.Request().Context())
+}
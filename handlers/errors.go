@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+
+	"spacebook/apperr"
+
+	"gorm.io/gorm"
+)
+
+// Errors shared by several handlers.
+var (
+	errInvalidBody          = apperr.BadRequest("invalid_body", "Données invalides")
+	errInvalidReservationID = apperr.BadRequest("invalid_reservation_id", "ID de réservation invalide")
+	errReservationNotFound  = apperr.NotFound("reservation_not_found", "Réservation introuvable")
+	errResourceNotFound     = apperr.NotFound("resource_not_found", "Ressource introuvable")
+	errUserNotFound         = apperr.NotFound("user_not_found", "Utilisateur introuvable")
+	errNotAuthenticated     = apperr.Unauthorized("not_authenticated", "Utilisateur non authentifié")
+	errUserIDRequired       = apperr.BadRequest("user_id_required", "userId est requis")
+	errInvalidUserID        = apperr.BadRequest("invalid_user_id", "ID utilisateur invalide")
+	errOtherUserNotAllowed  = apperr.Forbidden("other_user_not_allowed", "Seuls les administrateurs et les comptes de service peuvent consulter les données d'un autre utilisateur")
+)
+
+// lookupError maps the failure of a single-record lookup to notFound, or to
+// an internal error when the database itself failed.
+func lookupError(err error, notFound *apperr.Error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound
+	}
+	return apperr.Internal("database_error", "Erreur de base de données", err)
+}
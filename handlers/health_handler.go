@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"spacebook/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown makes the readiness probe fail so that load balancers stop
+// routing new traffic while in-flight requests are drained.
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+/*
+GET /livez
+Liveness probe – the process is up and serving HTTP
+*/
+func Livez(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{
+		"status": "ok",
+	})
+}
+
+/*
+GET /readyz
+GET /health
+Readiness probe – the API can serve traffic: not shutting down and Postgres answers
+*/
+func Readyz(c echo.Context) error {
+	if shuttingDown.Load() {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{
+			"status": "shutting down",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 2*time.Second)
+	defer cancel()
+
+	if err := config.Ping(ctx); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{
+			"status":   "unavailable",
+			"database": "down",
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"status":   "API is running",
+		"database": "up",
+	})
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"spacebook/signing"
+
+	"github.com/labstack/echo/v4"
+)
+
+/*
+GET /.well-known/jwks.json
+Public – public keys verifying SpaceBook tokens, selected by the kid header.
+Empty when tokens are signed with a shared secret (HS256).
+*/
+func GetJWKS(c echo.Context) error {
+	set := signing.JWKSet{Keys: []signing.JWK{}}
+	if keyring := signing.Current(); keyring != nil {
+		set = keyring.JWKS()
+	}
+
+	// New keys are published ahead of use: a short cache is enough
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"spacebook/apperr"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidLocationID     = apperr.BadRequest("invalid_location_id", "ID de lieu invalide")
+	errLocationNotFound      = apperr.NotFound("location_not_found", "Lieu introuvable")
+	errLocationNameRequired  = apperr.BadRequest("location_name_required", "Le nom du lieu est requis")
+	errInvalidLocationKind   = apperr.BadRequest("invalid_location_kind", "Type de lieu invalide (site, building, floor)")
+	errInvalidLocationParent = apperr.BadRequest("invalid_location_parent", "Un bâtiment doit être rattaché à un site et un étage à un bâtiment")
+	errInvalidTimezone       = apperr.BadRequest("invalid_timezone", "Fuseau horaire invalide")
+	errSiteNotAllowed        = apperr.Forbidden("site_not_allowed", "Ce site ne fait pas partie de votre périmètre d'administration")
+	errLocationsFetch        = apperr.Internal("locations_fetch_failed", "Échec de la récupération des lieux", nil)
+	errSiteScopeCheck        = apperr.Internal("site_scope_check_failed", "Échec de la vérification du périmètre d'administration", nil)
+)
+
+// locationSubtreeSQL selects the given locations and all those below them.
+const locationSubtreeSQL = `WITH RECURSIVE subtree AS (
+	SELECT id FROM locations WHERE id IN ?
+	UNION ALL
+	SELECT locations.id FROM locations JOIN subtree ON locations.parent_id = subtree.id
+) SELECT id FROM subtree`
+
+// locationSubtree is a subquery of the ids of roots and their descendants,
+// for use as `location_id IN (?)`.
+func locationSubtree(c echo.Context, roots ...uuid.UUID) *gorm.DB {
+	return db(c).Raw(locationSubtreeSQL, roots)
+}
+
+// siteOf returns the site a location belongs to (itself for a site).
+func siteOf(tx *gorm.DB, id uuid.UUID) (models.Location, error) {
+	// floor > building > site
+	for depth := 0; depth < 3; depth++ {
+		var location models.Location
+		if err := tx.First(&location, "id = ?", id).Error; err != nil {
+			return location, err
+		}
+		if location.ParentID == nil {
+			return location, nil
+		}
+		id = *location.ParentID
+	}
+	return models.Location{}, errors.New("location hierarchy deeper than site > building > floor")
+}
+
+// inSiteScope reports whether the authenticated admin manages the location:
+// global admins manage all of them, including resources without location;
+// site admins only the locations of their sites.
+func inSiteScope(c echo.Context, locationID *uuid.UUID) (bool, error) {
+	sites, restricted := middleware.AdminSites(c)
+	if !restricted {
+		return true, nil
+	}
+	if locationID == nil {
+		return false, nil
+	}
+
+	site, err := siteOf(db(c), *locationID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range sites {
+		if id == site.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkSiteScope refuses the request when the location is outside the
+// authenticated admin's sites.
+func checkSiteScope(c echo.Context, locationID *uuid.UUID) error {
+	allowed, err := inSiteScope(c, locationID)
+	if err != nil {
+		return errSiteScopeCheck.Wrap(err)
+	}
+	if !allowed {
+		return errSiteNotAllowed
+	}
+	return nil
+}
+
+// scopeToAdminSites restricts a query on a table with a location_id column
+// to the sites of a site admin; it is left unchanged for global admins.
+func scopeToAdminSites(c echo.Context, query *gorm.DB) *gorm.DB {
+	if sites, restricted := middleware.AdminSites(c); restricted {
+		return query.Where("location_id IN (?)", locationSubtree(c, sites...))
+	}
+	return query
+}
+
+// locationParam parses an optional location id query parameter and checks
+// that the location exists.
+func locationParam(c echo.Context, name string) (*uuid.UUID, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, errInvalidLocationID
+	}
+
+	var location models.Location
+	if err := db(c).Select("id").First(&location, "id = ?", id).Error; err != nil {
+		return nil, lookupError(err, errLocationNotFound)
+	}
+	return &id, nil
+}
+
+/*
+GET /locations?kind=&parent_id=
+Public – list the sites, buildings and floors
+*/
+func GetLocations(c echo.Context) error {
+	query := db(c).Order("name")
+
+	if kind := c.QueryParam("kind"); kind != "" {
+		if _, ok := models.ParentKind(kind); !ok {
+			return errInvalidLocationKind
+		}
+		query = query.Where("kind = ?", kind)
+	}
+
+	if parent := c.QueryParam("parent_id"); parent != "" {
+		parentID, err := uuid.Parse(parent)
+		if err != nil {
+			return errInvalidLocationID
+		}
+		query = query.Where("parent_id = ?", parentID)
+	}
+
+	var locations []models.Location
+	if err := query.Find(&locations).Error; err != nil {
+		return errLocationsFetch.Wrap(err)
+	}
+	return c.JSON(http.StatusOK, locations)
+}
+
+type LocationRequest struct {
+	Name     string     `json:"name"`
+	Kind     string     `json:"kind"`
+	ParentID *uuid.UUID `json:"parent_id"`
+	Timezone string     `json:"timezone"`
+}
+
+/*
+POST /admin/locations
+Admin only – create a site (with its timezone), a building in a site or a
+floor in a building. Site admins create buildings and floors of their sites.
+*/
+func CreateLocation(c echo.Context) error {
+	var req LocationRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	location := models.Location{
+		Name:     strings.TrimSpace(req.Name),
+		Kind:     req.Kind,
+		ParentID: req.ParentID,
+		Timezone: strings.TrimSpace(req.Timezone),
+	}
+	if location.Name == "" {
+		return errLocationNameRequired
+	}
+
+	parentKind, ok := models.ParentKind(location.Kind)
+	if !ok {
+		return errInvalidLocationKind
+	}
+
+	if parentKind == "" {
+		if location.ParentID != nil {
+			return errInvalidLocationParent
+		}
+		if !models.IsValidTimezone(location.Timezone) {
+			return errInvalidTimezone
+		}
+		if _, restricted := middleware.AdminSites(c); restricted {
+			return errSiteNotAllowed
+		}
+	} else {
+		if location.ParentID == nil {
+			return errInvalidLocationParent
+		}
+		var parent models.Location
+		if err := db(c).First(&parent, "id = ?", *location.ParentID).Error; err != nil {
+			return lookupError(err, errLocationNotFound)
+		}
+		if parent.Kind != parentKind {
+			return errInvalidLocationParent
+		}
+		// Buildings and floors follow the timezone of their site
+		location.Timezone = ""
+
+		if err := checkSiteScope(c, location.ParentID); err != nil {
+			return err
+		}
+	}
+
+	if err := db(c).Create(&location).Error; err != nil {
+		return apperr.Internal("location_create_failed", "Échec de la création du lieu", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "location.create",
+		EntityType: "location",
+		EntityID:   location.ID.String(),
+		After:      location,
+	})
+
+	return c.JSON(http.StatusCreated, location)
+}
+
+/*
+PUT /admin/locations/:id
+Admin only – rename a location or change the timezone of a site
+*/
+func UpdateLocation(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return errInvalidLocationID
+	}
+
+	var req LocationRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	var location models.Location
+	if err := db(c).First(&location, "id = ?", id).Error; err != nil {
+		return lookupError(err, errLocationNotFound)
+	}
+	if err := checkSiteScope(c, &location.ID); err != nil {
+		return err
+	}
+
+	before := location
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		location.Name = name
+	}
+	if timezone := strings.TrimSpace(req.Timezone); timezone != "" {
+		if location.Kind != models.LocationSite || !models.IsValidTimezone(timezone) {
+			return errInvalidTimezone
+		}
+		location.Timezone = timezone
+	}
+
+	if err := db(c).Model(&location).Updates(map[string]interface{}{
+		"name":     location.Name,
+		"timezone": location.Timezone,
+	}).Error; err != nil {
+		return apperr.Internal("location_update_failed", "Échec de la mise à jour du lieu", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "location.update",
+		EntityType: "location",
+		EntityID:   location.ID.String(),
+		Before:     before,
+		After:      location,
+	})
+
+	return c.JSON(http.StatusOK, location)
+}
+
+/*
+DELETE /admin/locations/:id
+Admin only – delete a location without sub-locations, resources nor site
+admins. Only global admins delete sites.
+*/
+func DeleteLocation(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return errInvalidLocationID
+	}
+
+	var location models.Location
+	if err := db(c).First(&location, "id = ?", id).Error; err != nil {
+		return lookupError(err, errLocationNotFound)
+	}
+
+	if _, restricted := middleware.AdminSites(c); restricted && location.Kind == models.LocationSite {
+		return errSiteNotAllowed
+	}
+	if err := checkSiteScope(c, &location.ID); err != nil {
+		return err
+	}
+
+	// Site admins are kept too: without their site, an admin restricted to
+	// it would become a global admin
+	var children, resources, admins int64
+	if err := db(c).Model(&models.Location{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+		return errLocationsFetch.Wrap(err)
+	}
+	if err := db(c).Model(&models.Resource{}).Where("location_id = ?", id).Count(&resources).Error; err != nil {
+		return apperr.Internal("resources_fetch_failed", "Échec de la récupération des ressources", err)
+	}
+	if err := db(c).Model(&models.SiteAdmin{}).Where("site_id = ?", id).Count(&admins).Error; err != nil {
+		return errSiteScopeCheck.Wrap(err)
+	}
+	if children > 0 || resources > 0 || admins > 0 {
+		return apperr.Conflict("location_in_use", "Le lieu contient encore des lieux, des ressources ou des administrateurs").
+			WithDetails(echo.Map{"locations": children, "resources": resources, "site_admins": admins})
+	}
+
+	if err := db(c).Delete(&models.Location{}, "id = ?", id).Error; err != nil {
+		return apperr.Internal("location_delete_failed", "Échec de la suppression du lieu", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "location.delete",
+		EntityType: "location",
+		EntityID:   location.ID.String(),
+		Before:     location,
+	})
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,34 +1,83 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 
-	"spacebook/config"
+	"spacebook/apperr"
+	"spacebook/i18n"
 	"spacebook/models"
+	"spacebook/schedule"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+/*
+GET /notifications?userId=
+Authenticated – the caller's notifications; admins and service accounts read
+those of another user with userId
+*/
 func GetUserNotifications(c echo.Context) error {
-	userId := c.QueryParam("userId")
-
-	if userId == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "userId est requis",
-		})
+	userId, err := requestedUser(c)
+	if err != nil {
+		return err
 	}
 
 	var notifications []models.Notification
 
-	if err := config.DB.
+	if err := db(c).
 		Where("user_id = ?", userId).
 		Order("created_at DESC").
 		Find(&notifications).Error; err != nil {
 
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la récupération des notifications",
-		})
+		return apperr.Internal("notifications_fetch_failed", "Échec de la récupération des notifications", err)
 	}
 
+	localizeNotifications(c, notifications)
+
 	return c.JSON(http.StatusOK, notifications)
 }
+
+// newNotification builds a notification stored as an i18n code and its
+// parameters. Message holds the default-locale rendering as a fallback.
+// A nil userID makes the notification visible to every admin.
+func newNotification(userID *uuid.UUID, kind, code string, params i18n.Params) models.Notification {
+	notification := models.Notification{
+		UserID:  userID,
+		Type:    kind,
+		Code:    code,
+		Message: i18n.T(i18n.Default, code, params),
+	}
+	if len(params) > 0 {
+		// A map of strings always marshals
+		notification.Params, _ = json.Marshal(params)
+	}
+	return notification
+}
+
+// localizeNotifications renders the message of coded notifications in the
+// language of the request, with their times (stored in UTC) in the caller's
+// zone.
+func localizeNotifications(c echo.Context, notifications []models.Notification) {
+	locale := i18n.Locale(c)
+	loc := callerLocation(c)
+	for i := range notifications {
+		n := &notifications[i]
+		if n.Code == "" {
+			continue
+		}
+		var params i18n.Params
+		if len(n.Params) > 0 {
+			if err := json.Unmarshal(n.Params, &params); err != nil {
+				continue
+			}
+		}
+		for key, value := range params {
+			if local, ok := schedule.Localize(value, loc); ok {
+				params[key] = local
+			}
+		}
+		n.Message = i18n.T(locale, n.Code, params)
+	}
+}
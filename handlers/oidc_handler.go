@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcCookieName = "spacebook_oidc"
+	oidcCookiePath = "/auth/oidc"
+	// oidcFlowTTL bounds the time spent on the provider's login page.
+	oidcFlowTTL = 10 * time.Minute
+)
+
+var (
+	errOIDCDisabled        = apperr.NotFound("oidc_disabled", "La connexion SSO n'est pas configurée")
+	errOIDCProvider        = apperr.New(http.StatusBadGateway, "oidc_provider_unavailable", "Le fournisseur d'identité est injoignable")
+	errOIDCState           = apperr.BadRequest("invalid_oidc_state", "Session de connexion SSO invalide ou expirée")
+	errOIDCLogin           = apperr.Unauthorized("oidc_login_failed", "Échec de la connexion SSO")
+	errOIDCEmailMissing    = apperr.BadRequest("oidc_email_missing", "Le fournisseur d'identité n'a pas fourni d'adresse email valide")
+	errOIDCEmailUnverified = apperr.Conflict("oidc_email_unverified", "Un compte utilise déjà cet email, non vérifié par le fournisseur d'identité")
+)
+
+// oidcProviders caches the discovered provider (and its signing keys) per
+// issuer; discovery happens on the first SSO login.
+var oidcProviders = struct {
+	sync.Mutex
+	byIssuer map[string]*oidc.Provider
+}{byIssuer: map[string]*oidc.Provider{}}
+
+func oidcProvider(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	oidcProviders.Lock()
+	defer oidcProviders.Unlock()
+
+	if provider, ok := oidcProviders.byIssuer[issuer]; ok {
+		return provider, nil
+	}
+
+	// The provider keeps refreshing its keys beyond this request
+	provider, err := oidc.NewProvider(context.WithoutCancel(ctx), issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProviders.byIssuer[issuer] = provider
+	return provider, nil
+}
+
+func oauth2Config(cfg config.OIDCConfig, provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	}
+}
+
+// oidcFlow is kept in a signed, HttpOnly cookie between the redirection to
+// the provider and the callback.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// oidcIdentity is what SpaceBook uses from the ID token.
+type oidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+	// MFA is set when the provider reports a second factor (amr claim).
+	MFA bool
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func flowKey() []byte {
+	return []byte(config.Get().JWT.Secret)
+}
+
+/*
+GET /auth/oidc/login
+Public – redirect to the identity provider (authorization code + PKCE)
+*/
+func OIDCLogin(c echo.Context) error {
+	cfg := config.Get().OIDC
+	if !cfg.Enabled() {
+		return errOIDCDisabled
+	}
+
+	provider, err := oidcProvider(c.Request().Context(), cfg.IssuerURL)
+	if err != nil {
+		return errOIDCProvider.Wrap(err)
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return apperr.Internal("oidc_state_failed", "Échec de la préparation de la connexion SSO", err)
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return apperr.Internal("oidc_state_failed", "Échec de la préparation de la connexion SSO", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	flow, err := jwt.NewWithClaims(jwt.SigningMethodHS256, oidcFlow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcFlowTTL)),
+		},
+	}).SignedString(flowKey())
+	if err != nil {
+		return apperr.Internal("oidc_state_failed", "Échec de la préparation de la connexion SSO", err)
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidcCookieName,
+		Value:    flow,
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.RedirectURL, "https://"),
+		// Lax: the cookie must come back with the provider's top-level redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authURL := oauth2Config(cfg, provider).AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oidc.Nonce(nonce),
+	)
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+/*
+GET /auth/oidc/callback
+Public – provider callback: verifies the ID token, provisions or links the
+account, then hands the session token to the frontend
+*/
+func OIDCCallback(c echo.Context) error {
+	cfg := config.Get().OIDC
+	if !cfg.Enabled() {
+		return errOIDCDisabled
+	}
+
+	if providerErr := c.QueryParam("error"); providerErr != "" {
+		return errOIDCLogin.WithDetails(echo.Map{
+			"error":             providerErr,
+			"error_description": c.QueryParam("error_description"),
+		})
+	}
+
+	flow, err := readOIDCFlow(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	provider, err := oidcProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return errOIDCProvider.Wrap(err)
+	}
+
+	token, err := oauth2Config(cfg, provider).Exchange(ctx, c.QueryParam("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return errOIDCLogin.Wrap(err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return errOIDCLogin.Wrap(errors.New("no id_token in the token response"))
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return errOIDCLogin.Wrap(err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		return errOIDCLogin.Wrap(errors.New("nonce mismatch"))
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return errOIDCLogin.Wrap(err)
+	}
+	identity := parseOIDCIdentity(idToken.Subject, claims, cfg.GroupsClaim)
+
+	user, provisioned, err := provisionOIDCUser(c, identity, cfg)
+	if err != nil {
+		return err
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "auth.oidc_login",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		After:      echo.Map{"provisioned": provisioned, "role": user.Role, "groups": identity.Groups},
+	})
+
+	// Accounts with a local second factor still go through /auth/2fa
+	if user.TOTPEnabled {
+		challenge, err := middleware.GenerateChallengeToken(user)
+		if err != nil {
+			return errTokenGeneration.Wrap(err)
+		}
+		if cfg.FrontendRedirectURL != "" {
+			return redirectWithFragment(c, cfg.FrontendRedirectURL, url.Values{
+				"two_factor_required": {"true"},
+				"challenge_token":     {challenge},
+			})
+		}
+		return c.JSON(http.StatusOK, TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(config.Get().TwoFactor.ChallengeTTL.Seconds()),
+		})
+	}
+
+	session, err := middleware.GenerateSSOToken(user, identity.MFA)
+	if err != nil {
+		return errTokenGeneration.Wrap(err)
+	}
+
+	if cfg.FrontendRedirectURL != "" {
+		return redirectWithFragment(c, cfg.FrontendRedirectURL, url.Values{"token": {session}})
+	}
+	return c.JSON(http.StatusOK, AuthResponse{
+		Token: session,
+		User:  user,
+	})
+}
+
+// readOIDCFlow checks the flow cookie against the state returned by the
+// provider, then deletes the cookie: a flow is used once.
+func readOIDCFlow(c echo.Context) (oidcFlow, error) {
+	var flow oidcFlow
+
+	cookie, err := c.Cookie(oidcCookieName)
+	if err != nil {
+		return flow, errOIDCState
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidcCookieName,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	_, err = jwt.ParseWithClaims(cookie.Value, &flow, func(token *jwt.Token) (interface{}, error) {
+		return flowKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return flow, errOIDCState
+	}
+
+	state := c.QueryParam("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(flow.State)) != 1 {
+		return flow, errOIDCState
+	}
+	return flow, nil
+}
+
+// redirectWithFragment sends values in the URL fragment, which browsers do
+// not send to servers nor in Referer headers.
+func redirectWithFragment(c echo.Context, target string, values url.Values) error {
+	return c.Redirect(http.StatusFound, target+"#"+values.Encode())
+}
+
+func parseOIDCIdentity(subject string, claims map[string]interface{}, groupsClaim string) oidcIdentity {
+	identity := oidcIdentity{Subject: subject}
+
+	identity.Email, _ = claims["email"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		// Some providers send it as a string
+		identity.EmailVerified = verified == "true"
+	}
+
+	for _, key := range []string{"preferred_username", "name"} {
+		if name, ok := claims[key].(string); ok && name != "" {
+			identity.Name = name
+			break
+		}
+	}
+
+	identity.Groups = stringList(claims[groupsClaim])
+
+	for _, method := range stringList(claims["amr"]) {
+		switch method {
+		case "mfa", "otp", "hwk", "swk", "sms":
+			identity.MFA = true
+		}
+	}
+
+	return identity
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// mapOIDCRole returns the role granted by the user's groups: admin if any
+// group maps to admin, else the role of a mapped group, else the default.
+func mapOIDCRole(groups []string, cfg config.OIDCConfig) string {
+	role := cfg.DefaultRole
+	for _, group := range groups {
+		mapped, ok := cfg.GroupRoles[group]
+		if !ok {
+			continue
+		}
+		if mapped == "admin" {
+			return "admin"
+		}
+		role = mapped
+	}
+	return role
+}
+
+// provisionOIDCUser finds the account linked to the subject, links an
+// existing account with the same verified email, or creates one. With a
+// group mapping configured, the provider is authoritative for the role.
+func provisionOIDCUser(c echo.Context, identity oidcIdentity, cfg config.OIDCConfig) (models.User, bool, error) {
+	var user models.User
+	role := mapOIDCRole(identity.Groups, cfg)
+	syncRole := len(cfg.GroupRoles) > 0
+
+	err := db(c).Where("oidc_subject = ? AND deleted_at IS NULL", identity.Subject).First(&user).Error
+	if err == nil {
+		if syncRole && user.Role != role {
+			if err := updateRole(db(c), &user, role); err != nil {
+				return user, false, errUserUpdate.Wrap(err)
+			}
+		}
+		return user, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, false, lookupError(err, errUserNotFound)
+	}
+
+	email, err := normalizeEmail(identity.Email)
+	if err != nil {
+		return user, false, errOIDCEmailMissing
+	}
+
+	err = db(c).Where("LOWER(email) = ? AND deleted_at IS NULL", email).First(&user).Error
+	if err == nil {
+		// Linking to an unverified address would hand over the local account
+		if !identity.EmailVerified {
+			return user, false, errOIDCEmailUnverified
+		}
+		err := db(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Update("oidc_subject", identity.Subject).Error; err != nil {
+				return err
+			}
+			if syncRole && user.Role != role {
+				return updateRole(tx, &user, role)
+			}
+			return nil
+		})
+		if err != nil {
+			return user, false, errUserUpdate.Wrap(err)
+		}
+		return user, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, false, lookupError(err, errUserNotFound)
+	}
+
+	username, err := normalizeUsername(identity.Name)
+	if err != nil {
+		username, _, _ = strings.Cut(email, "@")
+	}
+
+	subject := identity.Subject
+	user = models.User{
+		Email:       email,
+		Username:    username,
+		Role:        role,
+		OIDCSubject: &subject,
+	}
+	if err := db(c).Create(&user).Error; err != nil {
+		return user, false, apperr.Internal("user_create_failed", "Échec de la création de l'utilisateur", err)
+	}
+	return user, true, nil
+}
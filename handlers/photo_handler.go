@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"spacebook/apperr"
+	"spacebook/blob"
+	"spacebook/config"
+	"spacebook/imaging"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// maxPhotosPerResource bounds the storage used by a resource.
+const maxPhotosPerResource = 20
+
+var (
+	errPhotoNotFound      = apperr.NotFound("photo_not_found", "Photo introuvable")
+	errPhotoRequired      = apperr.BadRequest("photo_required", "Le fichier photo est requis (champ photo)")
+	errPhotoTooLarge      = apperr.New(http.StatusRequestEntityTooLarge, "photo_too_large", "La photo dépasse la taille maximale autorisée")
+	errUnsupportedImage   = apperr.New(http.StatusUnsupportedMediaType, "unsupported_image", "Format d'image non pris en charge (JPEG, PNG ou GIF)")
+	errStorageUnavailable = apperr.Internal("storage_unavailable", "Stockage des fichiers indisponible", nil)
+)
+
+func blobStore() (blob.Store, error) {
+	if store := blob.Current(); store != nil {
+		return store, nil
+	}
+	return nil, errStorageUnavailable
+}
+
+/*
+POST /admin/resources/:id/photos
+Admin only – upload a photo (multipart field "photo": JPEG, PNG or GIF);
+a thumbnail is made at upload
+*/
+func UploadResourcePhoto(c echo.Context) error {
+	store, err := blobStore()
+	if err != nil {
+		return err
+	}
+	cfg := config.Get().Storage
+
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := db(c).Model(&models.ResourcePhoto{}).Where("resource_id = ?", resource.ID).Count(&count).Error; err != nil {
+		return apperr.Internal("photos_fetch_failed", "Échec de la récupération des photos", err)
+	}
+	if count >= maxPhotosPerResource {
+		return apperr.Conflict("too_many_photos", "Nombre maximal de photos atteint pour cette ressource").
+			WithDetails(echo.Map{"max": maxPhotosPerResource})
+	}
+
+	// The multipart envelope adds a little to the file itself
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, int64(cfg.MaxUploadSize)+64<<10)
+
+	header, err := c.FormFile("photo")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errPhotoTooLarge.WithDetails(echo.Map{"max_bytes": cfg.MaxUploadSize})
+		}
+		return errPhotoRequired
+	}
+	if header.Size > int64(cfg.MaxUploadSize) {
+		return errPhotoTooLarge.WithDetails(echo.Map{"max_bytes": cfg.MaxUploadSize})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return errPhotoRequired
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(cfg.MaxUploadSize)+1))
+	if err != nil {
+		return errPhotoRequired
+	}
+
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return errUnsupportedImage
+	}
+
+	var thumbnail bytes.Buffer
+	thumbnailType, err := imaging.Encode(&thumbnail, imaging.Thumbnail(img, cfg.ThumbnailSize), img.Format)
+	if err != nil {
+		return apperr.Internal("thumbnail_failed", "Échec de la création de la miniature", err)
+	}
+
+	bounds := img.Bounds()
+	photo := models.ResourcePhoto{
+		ID:                   uuid.New(),
+		ResourceID:           resource.ID,
+		ContentType:          img.ContentType,
+		Size:                 int64(len(data)),
+		Width:                bounds.Dx(),
+		Height:               bounds.Dy(),
+		ThumbnailContentType: thumbnailType,
+	}
+
+	ctx := req.Context()
+	if err := store.Put(ctx, photo.Key(), bytes.NewReader(data)); err != nil {
+		return apperr.Internal("photo_store_failed", "Échec de l'enregistrement de la photo", err)
+	}
+	if err := store.Put(ctx, photo.ThumbnailKey(), &thumbnail); err != nil {
+		deletePhotoFiles(c, photo)
+		return apperr.Internal("photo_store_failed", "Échec de l'enregistrement de la photo", err)
+	}
+	if err := db(c).Create(&photo).Error; err != nil {
+		deletePhotoFiles(c, photo)
+		return apperr.Internal("photo_store_failed", "Échec de l'enregistrement de la photo", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "resource.photo_add",
+		EntityType: "resource",
+		EntityID:   resource.ID,
+		After:      photo,
+	})
+
+	return c.JSON(http.StatusCreated, photo)
+}
+
+/*
+DELETE /admin/resources/:id/photos/:photo_id
+Admin only – remove a photo of a resource
+*/
+func DeleteResourcePhoto(c echo.Context) error {
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
+	photo, err := findPhoto(c)
+	if err != nil {
+		return err
+	}
+
+	if err := db(c).Delete(&photo).Error; err != nil {
+		return apperr.Internal("photo_delete_failed", "Échec de la suppression de la photo", err)
+	}
+	deletePhotoFiles(c, photo)
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "resource.photo_delete",
+		EntityType: "resource",
+		EntityID:   resource.ID,
+		Before:     photo,
+	})
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+GET /resources/:id/photos/:photo_id
+Public – the photo as uploaded
+*/
+func GetResourcePhoto(c echo.Context) error {
+	photo, err := findPhoto(c)
+	if err != nil {
+		return err
+	}
+	return servePhotoFile(c, photo.Key(), photo.ContentType)
+}
+
+/*
+GET /resources/:id/photos/:photo_id/thumbnail
+Public – the thumbnail of a photo
+*/
+func GetResourcePhotoThumbnail(c echo.Context) error {
+	photo, err := findPhoto(c)
+	if err != nil {
+		return err
+	}
+	return servePhotoFile(c, photo.ThumbnailKey(), photo.ThumbnailContentType)
+}
+
+// findPhoto loads the photo identified by the :id and :photo_id parameters.
+func findPhoto(c echo.Context) (models.ResourcePhoto, error) {
+	var photo models.ResourcePhoto
+
+	id, err := uuid.Parse(c.Param("photo_id"))
+	if err != nil {
+		return photo, errPhotoNotFound
+	}
+	if err := db(c).First(&photo, "id = ? AND resource_id = ?", id, c.Param("id")).Error; err != nil {
+		return photo, lookupError(err, errPhotoNotFound)
+	}
+	return photo, nil
+}
+
+func servePhotoFile(c echo.Context, key, contentType string) error {
+	store, err := blobStore()
+	if err != nil {
+		return err
+	}
+
+	file, err := store.Open(c.Request().Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		return errPhotoNotFound
+	}
+	if err != nil {
+		return apperr.Internal("photo_read_failed", "Échec de la lecture de la photo", err)
+	}
+	defer file.Close()
+
+	// Files never change: a new upload gets a new id
+	header := c.Response().Header()
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("X-Content-Type-Options", "nosniff")
+	return c.Stream(http.StatusOK, contentType, file)
+}
+
+// deletePhotoFiles removes the files of photos whose rows are gone. A
+// failure only leaves an orphan file behind, so it is logged.
+func deletePhotoFiles(c echo.Context, photos ...models.ResourcePhoto) {
+	store := blob.Current()
+	if store == nil {
+		return
+	}
+	ctx := c.Request().Context()
+	for _, photo := range photos {
+		for _, key := range []string{photo.Key(), photo.ThumbnailKey()} {
+			if err := store.Delete(ctx, key); err != nil {
+				slog.WarnContext(ctx, "photo file not deleted", "key", key, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/i18n"
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInvalidPriority  = apperr.BadRequest("invalid_priority", "La priorité doit être comprise entre 1 et 10")
+	errReasonRequired   = apperr.BadRequest("priority_reason_required", "Le motif de la réservation prioritaire est requis")
+	errPriorityConflict = apperr.Conflict("priority_conflict", "Les réservations en conflit ont une priorité égale ou supérieure")
+)
+
+type PriorityReservationRequest struct {
+	// UserID is the user the reservation is made for, the admin by default.
+	UserID     uuid.UUID `json:"user_id"`
+	ResourceID uuid.UUID `json:"resource_id"`
+	StartAt    time.Time `json:"start_at"`
+	EndAt      time.Time `json:"end_at"`
+	Quantity   int       `json:"quantity"`
+	// Priority defaults to 1, above every reservation made by users.
+	Priority int `json:"priority"`
+	// Reason is recorded in the audit log and given to the bumped users.
+	Reason string `json:"reason"`
+}
+
+// BumpedReservation is a reservation that gave way to a priority one, with
+// the alternatives offered to its owner.
+type BumpedReservation struct {
+	Reservation  models.Reservation   `json:"reservation"`
+	Alternatives []ResourceSuggestion `json:"alternatives"`
+}
+
+/*
+POST /admin/reservations/priority
+Admin only – book a resource with a priority, approved at once: the
+conflicting reservations of lower priority are bumped (least priority and
+most recent first, only as many as needed for the units held at the same
+time to fit), their owners notified with alternatives
+*/
+func CreatePriorityReservation(c echo.Context) error {
+	var req PriorityReservationRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	req.StartAt, req.EndAt = req.StartAt.UTC(), req.EndAt.UTC()
+	if !req.StartAt.Before(req.EndAt) {
+		return errInvalidPeriod
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		return errInvalidQuantity
+	}
+	if req.Priority == 0 {
+		req.Priority = 1
+	}
+	if req.Priority < 1 || req.Priority > models.MaxPriority {
+		return errInvalidPriority
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return errReasonRequired
+	}
+
+	if req.UserID == uuid.Nil {
+		userID, ok := c.Get("user_id").(uuid.UUID)
+		if !ok {
+			return errUserIDRequired
+		}
+		req.UserID = userID
+	}
+	var user models.User
+	if err := db(c).First(&user, "id = ?", req.UserID).Error; err != nil {
+		return lookupError(err, errUserNotFound)
+	}
+
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", req.ResourceID).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+	if req.Quantity > resource.Capacity {
+		return errQuantityOverCapacity.WithDetails(echo.Map{
+			"capacity":  resource.Capacity,
+			"requested": req.Quantity,
+		})
+	}
+
+	reservation := models.Reservation{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		ResourceID: req.ResourceID,
+		StartAt:    req.StartAt,
+		EndAt:      req.EndAt,
+		Status:     models.StatusApproved,
+		Quantity:   req.Quantity,
+		Priority:   req.Priority,
+	}
+	var bumped []BumpedReservation
+
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		// Locked so that no booking takes the units freed below
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, "id = ?", resource.ID).Error; err != nil {
+			return err
+		}
+
+		var conflicts []models.Reservation
+		if err := overlappingReservations(tx, req.StartAt, req.EndAt).
+			Where("reservations.resource_id = ?", resource.ID).
+			Preload("User").
+			Order("reservations.priority, reservations.created_at DESC").
+			Find(&conflicts).Error; err != nil {
+			return err
+		}
+
+		// Units held at the busiest moment of the slot: reservations that
+		// follow each other do not add up
+		fits := func(kept []models.Reservation) bool {
+			return models.PeakQuantity(kept, resource.Turnaround(), req.StartAt, req.EndAt)+req.Quantity <= resource.Capacity
+		}
+		booked := models.PeakQuantity(conflicts, resource.Turnaround(), req.StartAt, req.EndAt)
+
+		kept := conflicts
+		var victims []models.Reservation
+		for len(kept) > 0 && !fits(kept) && kept[0].Priority < req.Priority {
+			victims = append(victims, kept[0])
+			kept = kept[1:]
+		}
+		// Victims not needed after all, outside the moments freed by the
+		// later ones, are kept, the most important first
+		for i := len(victims) - 1; i >= 0; i-- {
+			if candidate := append(slices.Clone(kept), victims[i]); fits(candidate) {
+				kept = candidate
+				victims = slices.Delete(victims, i, i+1)
+			}
+		}
+		if !fits(kept) {
+			telemetry.CapacityConflicts.Inc()
+			return errPriorityConflict.WithDetails(echo.Map{
+				"capacity":  resource.Capacity,
+				"booked":    booked,
+				"requested": req.Quantity,
+				"priority":  req.Priority,
+			})
+		}
+
+		if err := tx.Omit("User", "Resource").Create(&reservation).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, victim := range victims {
+			before := victim
+			victim.Status = models.StatusBumped
+			victim.BumpedByID = &reservation.ID
+			victim.UpdatedAt = now
+			victim.Resource = resource
+
+			if err := tx.Model(&models.Reservation{}).Where("id = ?", victim.ID).Updates(map[string]interface{}{
+				"status":       victim.Status,
+				"bumped_by_id": victim.BumpedByID,
+				"updated_at":   now,
+			}).Error; err != nil {
+				return err
+			}
+
+			alternatives, err := similarResources(tx, resource, victim.StartAt, victim.EndAt, victim.Quantity, maxSuggestions)
+			if err != nil {
+				return err
+			}
+			if err := notifyBumped(tx, victim, req.Reason, alternatives); err != nil {
+				return err
+			}
+
+			if err := middleware.RecordAudit(c, tx, middleware.AuditEntry{
+				Action:     "reservation.bump",
+				EntityType: "reservation",
+				EntityID:   victim.ID.String(),
+				Before:     before,
+				After:      victim,
+			}); err != nil {
+				return err
+			}
+
+			bumped = append(bumped, BumpedReservation{Reservation: victim, Alternatives: alternatives})
+		}
+
+		notification := newNotification(&user.ID, "reservation", "reservation_auto_approved", i18n.Params{
+			"resource": resource.Name,
+		})
+		return tx.Create(&notification).Error
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if err != nil {
+		return apperr.Internal("reservation_create_failed", "Échec de la création de la réservation", err)
+	}
+
+	telemetry.ReservationsCreated.WithLabelValues(reservation.Status).Inc()
+	telemetry.ReservationsBumped.Add(float64(len(bumped)))
+
+	bumpedIDs := make([]uuid.UUID, len(bumped))
+	for i, b := range bumped {
+		bumpedIDs[i] = b.Reservation.ID
+	}
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "reservation.priority_create",
+		EntityType: "reservation",
+		EntityID:   reservation.ID.String(),
+		After: echo.Map{
+			"reservation": reservation,
+			"reason":      req.Reason,
+			"bumped":      bumpedIDs,
+		},
+	})
+
+	reservation.Resource = resource
+	loc := callerLocation(c)
+	localizeReservation(&reservation, loc)
+	for i := range bumped {
+		localizeReservation(&bumped[i].Reservation, loc)
+	}
+	return c.JSON(http.StatusCreated, echo.Map{
+		"reservation": reservation,
+		"bumped":      bumped,
+	})
+}
+
+// notifyBumped tells the owner and the attendees of a bumped reservation,
+// offering the owner the alternatives found.
+func notifyBumped(tx *gorm.DB, reservation models.Reservation, reason string, alternatives []ResourceSuggestion) error {
+	code := "reservation_bumped_no_alternative"
+	params := meetingParams(reservation, i18n.Params{"reason": reason})
+	if len(alternatives) > 0 {
+		names := make([]string, len(alternatives))
+		for i, alternative := range alternatives {
+			names[i] = alternative.Resource.Name
+		}
+		code = "reservation_bumped"
+		params["alternatives"] = strings.Join(names, ", ")
+	}
+
+	notification := newNotification(&reservation.UserID, "reservation", code, params)
+	if err := tx.Create(&notification).Error; err != nil {
+		return err
+	}
+	return notifyAttendees(tx, reservation, "meeting_cancelled")
+}
@@ -1,223 +1,510 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
-	"spacebook/config"
+	"spacebook/apperr"
+	"spacebook/i18n"
+	"spacebook/middleware"
 	"spacebook/models"
+	"spacebook/telemetry"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func GetUserReservations(c echo.Context) error {
-	userId := c.QueryParam("userId")
+var (
+	errInvalidPeriod        = apperr.BadRequest("invalid_period", "La date de début doit être antérieure à la date de fin")
+	errResourceFull         = apperr.Conflict("resource_full", "Ressource complète pour ce créneau horaire")
+	errInvalidQuantity      = apperr.BadRequest("invalid_quantity", "La quantité doit être au moins 1")
+	errQuantityOverCapacity = apperr.BadRequest("quantity_exceeds_capacity", "La quantité demandée dépasse la capacité de la ressource")
+	errCannotDecide         = apperr.Forbidden("decision_not_allowed", "Vous n'êtes pas autorisé à décider de cette réservation")
+	errReservationCancelled = apperr.Conflict("reservation_cancelled", "Cette réservation a été annulée")
+	errNoShowFinal          = apperr.Conflict("no_show_final", "Une absence constatée ne peut plus être modifiée")
+)
 
-	if userId == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "userId est requis",
-		})
+const msgReservationsFetchFailed = "Échec de la récupération des réservations"
+
+/*
+GET /reservations?userId=
+Authenticated – the caller's reservations and the meetings they are invited
+to; admins and service accounts read those of another user with userId
+*/
+func GetUserReservations(c echo.Context) error {
+	userId, err := requestedUser(c)
+	if err != nil {
+		return err
 	}
 
 	var reservations []models.Reservation
 
-	if err := config.DB.
+	// Meetings the user is invited to are listed with their own bookings
+	if err := db(c).
 		Preload("Resource").
-		Where("user_id = ?", userId).
+		Preload("Attendees").
+		Where("user_id = ? OR id IN (?)", userId,
+			db(c).Model(&models.Attendee{}).Select("reservation_id").
+				Where("user_id = ? AND status != ?", userId, models.InvitationDeclined)).
 		Order("created_at DESC").
 		Find(&reservations).Error; err != nil {
 
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la récupération des réservations",
-		})
+		return apperr.Internal("reservations_fetch_failed", msgReservationsFetchFailed, err)
 	}
 
-	return c.JSON(http.StatusOK, reservations)
+	return respondWithReservations(c, http.StatusOK, reservations)
+}
+
+// requestedUser is the user whose data is read: the caller, or the one of the
+// userId query parameter for admins and service accounts.
+func requestedUser(c echo.Context) (uuid.UUID, error) {
+	callerID, _ := c.Get("user_id").(uuid.UUID)
+	value := c.QueryParam("userId")
+	if value == "" {
+		if callerID == uuid.Nil {
+			return uuid.Nil, errUserIDRequired
+		}
+		return callerID, nil
+	}
+
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, errInvalidUserID
+	}
+	if userID != callerID && !canBookOnBehalf(c) {
+		return uuid.Nil, errOtherUserNotAllowed
+	}
+	return userID, nil
 }
 
 func CreateReservation(c echo.Context) error {
 	var reservation models.Reservation
 
 	if err := c.Bind(&reservation); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Corps de requête invalide",
-		})
+		return errInvalidBody
 	}
+	// Les priorités sont réservées aux administrateurs (POST /admin/reservations/priority)
+	reservation.Priority = 0
+	reservation.BumpedByID = nil
+	reservation.CheckedInAt = nil
+	// Les groupes se créent par POST /reservations/groups
+	reservation.GroupID = nil
+	// Les participants s'invitent par POST /reservations/:id/attendees
+	reservation.Attendees = nil
+	// Les dates sont stockées en UTC, quel que soit le fuseau envoyé
+	reservation.StartAt, reservation.EndAt = reservation.StartAt.UTC(), reservation.EndAt.UTC()
 
 	// Validation des dates
 	if reservation.StartAt.After(reservation.EndAt) || reservation.StartAt.Equal(reservation.EndAt) {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "La date de début doit être antérieure à la date de fin",
-		})
+		return errInvalidPeriod
+	}
+
+	// Une unité par défaut
+	if reservation.Quantity == 0 {
+		reservation.Quantity = 1
+	}
+	if reservation.Quantity < 0 {
+		return errInvalidQuantity
+	}
+
+	// Réservation pour soi par défaut ; pour un autre utilisateur, réservé aux
+	// administrateurs et aux comptes de service
+	callerID, _ := c.Get("user_id").(uuid.UUID)
+	if reservation.UserID == uuid.Nil {
+		if callerID == uuid.Nil {
+			return errUserIDRequired
+		}
+		reservation.UserID = callerID
+	}
+	onBehalf := reservation.UserID != callerID
+	if onBehalf && !canBookOnBehalf(c) {
+		return errBookOnBehalfNotAllowed
 	}
 
 	// Récupérer la ressource pour connaître sa capacité
 	var resource models.Resource
-	if err := config.DB.First(&resource, "id = ?", reservation.ResourceID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Ressource introuvable",
-		})
+	if err := db(c).First(&resource, "id = ?", reservation.ResourceID).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
 	}
-
-	// Compter les réservations qui chevauchent ce créneau (non rejetées)
-	var overlappingCount int64
-	if err := config.DB.Model(&models.Reservation{}).
-		Where("resource_id = ?", reservation.ResourceID).
-		Where("status != ?", "rejected").
-		Where("start_at < ? AND end_at > ?", reservation.EndAt, reservation.StartAt).
-		Count(&overlappingCount).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la vérification de disponibilité",
-		})
+	// Les administrateurs de site ne réservent pour autrui que sur leurs sites
+	if onBehalf {
+		if err := checkSiteScope(c, resource.LocationID); err != nil {
+			return err
+		}
 	}
 
-	// Vérifier si la capacité est atteinte
-	if int(overlappingCount) >= resource.Capacity {
-		return c.JSON(http.StatusConflict, echo.Map{
-			"error":     "Ressource complète pour ce créneau horaire",
+	if reservation.Quantity > resource.Capacity {
+		return errQuantityOverCapacity.WithDetails(echo.Map{
 			"capacity":  resource.Capacity,
-			"booked":    overlappingCount,
-			"available": 0,
+			"requested": reservation.Quantity,
 		})
 	}
 
 	reservation.ID = uuid.New()
-	reservation.Status = "pending"
+	reservation.Status = models.StatusPending
 
-	if err := config.DB.Create(&reservation).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la création de la réservation",
-		})
+	// Approbation automatique : la capacité est vérifiée avant la création
+	if resource.ApprovalPolicy == models.ApprovalAuto {
+		reservation.Status = models.StatusApproved
 	}
 
 	// Récupérer l'utilisateur pour le message de notification
 	var user models.User
-	config.DB.First(&user, "id = ?", reservation.UserID)
+	if err := db(c).First(&user, "id = ?", reservation.UserID).Error; err != nil {
+		return lookupError(err, errUserNotFound)
+	}
+
+	// Les absences répétées bloquent les nouvelles réservations
+	if err := checkNoShowPenalty(c, user.ID); err != nil {
+		return err
+	}
 
-	// Notification pour les admins (sans UserID = visible par tous les admins)
-	notification := models.Notification{
-		Type:    "reservation",
-		Message: "Nouvelle demande de réservation de " + user.Username + " pour " + resource.Name,
-		IsRead:  false,
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		// Verrou sur la ressource, comme pour les groupes et les réservations
+		// prioritaires : deux réservations simultanées ne peuvent pas compter
+		// les mêmes unités libres
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, "id = ?", resource.ID).Error; err != nil {
+			return err
+		}
+
+		// Additionner les quantités des réservations qui chevauchent ce créneau (non rejetées)
+		booked, err := bookedQuantity(tx, resource.ID, reservation.StartAt, reservation.EndAt)
+		if err != nil {
+			return apperr.Internal("availability_check_failed", "Échec de la vérification de disponibilité", err)
+		}
+
+		// Vérifier s'il reste assez d'unités ; les unités restantes permettent
+		// au client de proposer une quantité réduite, les suggestions un autre
+		// créneau ou une ressource similaire
+		if booked+reservation.Quantity > resource.Capacity {
+			telemetry.CapacityConflicts.Inc()
+			suggestions, err := suggestAlternatives(tx, resource, reservation.StartAt, reservation.EndAt, reservation.Quantity)
+			if err != nil {
+				return apperr.Internal("availability_check_failed", "Échec de la vérification de disponibilité", err)
+			}
+			return errResourceFull.WithDetails(echo.Map{
+				"capacity":    resource.Capacity,
+				"booked":      booked,
+				"available":   max(resource.Capacity-booked, 0),
+				"requested":   reservation.Quantity,
+				"suggestions": suggestions,
+			})
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&reservation).Error; err != nil {
+			return err
+		}
+
+		if reservation.Status == models.StatusApproved {
+			userID := reservation.UserID
+			notification := newNotification(&userID, "reservation", "reservation_auto_approved", i18n.Params{
+				"resource": resource.Name,
+			})
+			return tx.Create(&notification).Error
+		}
+
+		return notifyApprovers(tx, resource, "reservation_requested", i18n.Params{
+			"username": user.Username,
+			"resource": resource.Name,
+		})
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
 	}
-	config.DB.Create(&notification)
+	if err != nil {
+		return apperr.Internal("reservation_create_failed", "Échec de la création de la réservation", err)
+	}
+
+	telemetry.ReservationsCreated.WithLabelValues(reservation.Status).Inc()
 
-	return c.JSON(http.StatusCreated, reservation)
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "reservation.create",
+		EntityType: "reservation",
+		EntityID:   reservation.ID.String(),
+		After:      reservation,
+	})
+
+	return respondWithReservation(c, http.StatusCreated, reservation)
+}
+
+// releasedStatuses are the statuses of reservations that no longer hold
+// capacity.
+var releasedStatuses = []string{models.StatusRejected, models.StatusCancelled, models.StatusNoShow, models.StatusBumped}
+
+// turnaroundSQL is the Turnaround of the resource joined to a reservation.
+const turnaroundSQL = "make_interval(mins => resources.setup_minutes + resources.teardown_minutes)"
+
+// overlappingReservations selects the reservations holding capacity during
+// [start, end): those not released that overlap it once the turnaround of
+// their resource is kept between them. Columns are qualified as the query
+// joins the resources.
+func overlappingReservations(tx *gorm.DB, start, end time.Time) *gorm.DB {
+	return tx.Model(&models.Reservation{}).
+		Joins("JOIN resources ON resources.id = reservations.resource_id").
+		Where("reservations.status NOT IN ?", releasedStatuses).
+		Where("reservations.start_at < ?::timestamptz + "+turnaroundSQL, end).
+		Where("reservations.end_at > ?::timestamptz - "+turnaroundSQL, start)
 }
 
+// bookedQuantity is the most units of a resource held at the same time
+// during [start, end).
+func bookedQuantity(tx *gorm.DB, resourceID string, start, end time.Time) (int, error) {
+	booked, err := bookedByResource(tx, start, end, []string{resourceID})
+	return booked[resourceID], err
+}
+
+// meetingNotificationCode is the notification sent to attendees when a
+// reservation gets status.
+func meetingNotificationCode(status string) string {
+	if status == models.StatusApproved {
+		return "meeting_confirmed"
+	}
+	return "meeting_cancelled"
+}
+
+// notifyApprovers routes a notification to whoever decides on the resource's
+// reservations: its designated approvers for a delegated policy, all admins
+// otherwise (a notification without UserID is visible by every admin).
+func notifyApprovers(tx *gorm.DB, resource models.Resource, code string, params i18n.Params) error {
+	if resource.ApprovalPolicy == models.ApprovalDelegated {
+		var approvers []models.ResourceApprover
+		if err := tx.Where("resource_id = ?", resource.ID).Find(&approvers).Error; err != nil {
+			return err
+		}
+
+		if len(approvers) > 0 {
+			for _, approver := range approvers {
+				userID := approver.UserID
+				notification := newNotification(&userID, "reservation", code, params)
+				if err := tx.Create(&notification).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		// No approver designated: fall back to the admins so the request is not lost
+	}
+
+	notification := newNotification(nil, "reservation", code, params)
+	notification.LocationID = resource.LocationID
+	return tx.Create(&notification).Error
+}
+
+// canDecide reports whether the authenticated user may approve or reject
+// reservations of the given resource. Admins can decide on the resources of
+// their sites (all of them for global admins); other users only when they
+// are designated approvers of a delegated resource.
+func canDecide(c echo.Context, resource models.Resource) (bool, error) {
+	if role, _ := c.Get("role").(string); role == "admin" {
+		if allowed, err := inSiteScope(c, resource.LocationID); err != nil || allowed {
+			return allowed, err
+		}
+	}
+
+	if resource.ApprovalPolicy != models.ApprovalDelegated {
+		return false, nil
+	}
+
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return false, nil
+	}
+
+	var count int64
+	if err := db(c).Model(&models.ResourceApprover{}).
+		Where("resource_id = ? AND user_id = ?", resource.ID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
 
 /*
-GET /admin/reservations
-Admin only – list all reservations with User + Resource
+GET /reservations/approvals
+Designated approvers – pending reservations of the resources they approve
 */
-func GetAdminReservations(c echo.Context) error {
+func GetApproverReservations(c echo.Context) error {
+	userID, ok := c.Get("user_id").(uuid.UUID)
+	if !ok {
+		return errNotAuthenticated
+	}
+
 	var reservations []models.Reservation
 
-	if err := config.DB.
+	if err := db(c).
 		Preload("User").
 		Preload("Resource").
-		Order("created_at DESC").
+		Joins("JOIN resources ON resources.id = reservations.resource_id").
+		Joins("JOIN resource_approvers ON resource_approvers.resource_id = reservations.resource_id").
+		Where("resource_approvers.user_id = ?", userID).
+		Where("resources.approval_policy = ?", models.ApprovalDelegated).
+		Where("reservations.status = ?", models.StatusPending).
+		Order("reservations.created_at DESC").
 		Find(&reservations).Error; err != nil {
 
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la récupération des réservations",
-		})
+		return apperr.Internal("reservations_fetch_failed", msgReservationsFetchFailed, err)
 	}
 
-	return c.JSON(http.StatusOK, reservations)
+	return respondWithReservations(c, http.StatusOK, reservations)
 }
 
 /*
-PUT /admin/reservations/:id/approve
-Admin only – approve reservation + notify user
+GET /admin/reservations
+Admin only – list all reservations with User + Resource (those of their
+sites for site admins)
 */
-func ApproveReservation(c echo.Context) error {
-	idParam := c.Param("id")
+func GetAdminReservations(c echo.Context) error {
+	var reservations []models.Reservation
 
-	reservationID, err := uuid.Parse(idParam)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "ID de réservation invalide",
-		})
+	query := db(c)
+	if _, restricted := middleware.AdminSites(c); restricted {
+		query = query.Where("resource_id IN (?)",
+			scopeToAdminSites(c, db(c).Model(&models.Resource{}).Select("id")))
 	}
 
-	var reservation models.Reservation
-	if err := config.DB.
+	if err := query.
 		Preload("User").
 		Preload("Resource").
-		First(&reservation, "id = ?", reservationID).Error; err != nil {
-
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Réservation introuvable",
-		})
-	}
-
-	// Update status
-	reservation.Status = "approved"
-	reservation.UpdatedAt = time.Now()
-
-	if err := config.DB.Save(&reservation).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de l'approbation de la réservation",
-		})
-	}
-
-	// Notification for user (UUID pointer)
-	userID := reservation.UserID
+		Order("created_at DESC").
+		Find(&reservations).Error; err != nil {
 
-	notification := models.Notification{
-		UserID:  &userID,
-		Type:    "reservation",
-		Message: "Votre réservation a été approuvée",
-		IsRead:  false,
+		return apperr.Internal("reservations_fetch_failed", msgReservationsFetchFailed, err)
 	}
 
-	_ = config.DB.Create(&notification)
+	return respondWithReservations(c, http.StatusOK, reservations)
+}
 
-	return c.JSON(http.StatusOK, reservation)
+/*
+PUT /admin/reservations/:id/approve
+PUT /reservations/:id/approve
+Admin or designated approver – approve reservation + notify user
+*/
+func ApproveReservation(c echo.Context) error {
+	return decideReservation(c, models.StatusApproved, "reservation_approved")
 }
 
 /*
 PUT /admin/reservations/:id/reject
-(Admin optional)
+PUT /reservations/:id/reject
+Admin or designated approver – reject reservation + notify user
 */
 func RejectReservation(c echo.Context) error {
-	idParam := c.Param("id")
+	return decideReservation(c, models.StatusRejected, "reservation_rejected")
+}
 
-	reservationID, err := uuid.Parse(idParam)
+// decideReservation sets the status of the reservation identified by the
+// :id parameter and notifies its owner.
+func decideReservation(c echo.Context, status, notificationCode string) error {
+	reservationID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "ID de réservation invalide",
-		})
+		return errInvalidReservationID
 	}
 
 	var reservation models.Reservation
-	if err := config.DB.First(&reservation, "id = ?", reservationID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Réservation introuvable",
-		})
+	if err := db(c).
+		Preload("User").
+		Preload("Resource").
+		First(&reservation, "id = ?", reservationID).Error; err != nil {
+
+		return lookupError(err, errReservationNotFound)
 	}
 
-	reservation.Status = "rejected"
-	reservation.UpdatedAt = time.Now()
+	allowed, err := canDecide(c, reservation.Resource)
+	if err != nil {
+		return apperr.Internal("approvers_fetch_failed", "Échec de la récupération des approbateurs", err)
+	}
+	if !allowed {
+		return errCannotDecide
+	}
 
-	if err := config.DB.Save(&reservation).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec du rejet de la réservation",
-		})
+	// Their capacity may have been taken since
+	if reservation.Status == models.StatusCancelled || reservation.Status == models.StatusBumped {
+		return errReservationCancelled
+	}
+	// The no-show counter of the owner already accounts for it
+	if reservation.Status == models.StatusNoShow {
+		return errNoShowFinal
+	}
+
+	// The items of a group decided as a whole go through the group endpoints
+	if reservation.GroupID != nil {
+		var group models.BookingGroup
+		if err := db(c).Select("approval_mode").First(&group, "id = ?", *reservation.GroupID).Error; err != nil {
+			return lookupError(err, errBookingGroupNotFound)
+		}
+		if group.ApprovalMode == models.GroupApprovalGroup {
+			return errGroupDecisionRequired.WithDetails(echo.Map{"group_id": reservation.GroupID})
+		}
 	}
 
-	userID := reservation.UserID
+	before := reservation
 
-	notification := models.Notification{
-		UserID:  &userID,
-		Type:    "reservation",
-		Message: "Votre réservation a été refusée",
-		IsRead:  false,
+	// Update status
+	reservation.Status = status
+	reservation.UpdatedAt = time.Now()
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		// A rejected reservation held no capacity: approving it takes some
+		// again, checked under the lock taken by the other bookings
+		if status == models.StatusApproved && before.Status == models.StatusRejected {
+			resource := reservation.Resource
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, "id = ?", resource.ID).Error; err != nil {
+				return err
+			}
+			booked, err := bookedQuantity(tx, resource.ID, reservation.StartAt, reservation.EndAt)
+			if err != nil {
+				return err
+			}
+			if booked+reservation.Quantity > resource.Capacity {
+				telemetry.CapacityConflicts.Inc()
+				return errResourceFull.WithDetails(echo.Map{
+					"capacity":  resource.Capacity,
+					"booked":    booked,
+					"available": max(resource.Capacity-booked, 0),
+					"requested": reservation.Quantity,
+				})
+			}
+		}
+
+		if err := tx.Save(&reservation).Error; err != nil {
+			return err
+		}
+
+		// Notification for user (UUID pointer)
+		userID := reservation.UserID
+		notification := newNotification(&userID, "reservation", notificationCode, nil)
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+
+		return notifyAttendees(tx, reservation, meetingNotificationCode(status))
+	})
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if err != nil {
+		return apperr.Internal("reservation_update_failed", "Échec de la mise à jour de la réservation", err)
 	}
 
-	_ = config.DB.Create(&notification)
+	telemetry.ReservationDecisions.WithLabelValues(status).Inc()
 
-	return c.JSON(http.StatusOK, reservation)
+	action := "reservation.approve"
+	if status == models.StatusRejected {
+		action = "reservation.reject"
+	}
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     action,
+		EntityType: "reservation",
+		EntityID:   reservation.ID.String(),
+		Before:     before,
+		After:      reservation,
+	})
+
+	return respondWithReservation(c, http.StatusOK, reservation)
 }
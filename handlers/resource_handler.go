@@ -2,58 +2,636 @@ package handlers
 
 import (
 	"net/http"
-	"spacebook/config"
+	"strconv"
+	"strings"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/middleware"
 	"spacebook/models"
+	"spacebook/schedule"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInvalidApprovalPolicy = apperr.BadRequest("invalid_approval_policy", "Politique d'approbation invalide")
+	errInvalidBuffer         = apperr.BadRequest("invalid_buffer", "Les temps de préparation et de remise en état doivent être compris entre 0 et 1440 minutes")
 )
 
+// validBuffer reports whether minutes is a valid setup or teardown buffer.
+func validBuffer(minutes int) bool {
+	return minutes >= 0 && minutes <= models.MaxBufferMinutes
+}
+
+// filterResources applies the filters shared by the resource listings:
+// location_id (the location and those below it: a site includes its
+// buildings and floors), type and amenities (comma-separated codes, all
+// required).
+func filterResources(c echo.Context, query *gorm.DB) (*gorm.DB, error) {
+	locationID, err := locationParam(c, "location_id")
+	if err != nil {
+		return nil, err
+	}
+	if locationID != nil {
+		query = query.Where("location_id IN (?)", locationSubtree(c, *locationID))
+	}
+
+	if resourceType := c.QueryParam("type"); resourceType != "" {
+		query = query.Where("type = ?", resourceType)
+	}
+
+	if value := c.QueryParam("amenities"); value != "" {
+		var codes []string
+		for _, code := range strings.Split(value, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				codes = append(codes, code)
+			}
+		}
+		if len(codes) > 0 {
+			query = query.Where(`id IN (
+				SELECT resource_amenities.resource_id FROM resource_amenities
+				JOIN amenities ON amenities.id = resource_amenities.amenity_id
+				WHERE amenities.code IN ?
+				GROUP BY resource_amenities.resource_id
+				HAVING COUNT(DISTINCT amenities.code) = ?)`, codes, len(uniqueStrings(codes)))
+		}
+	}
+
+	return query, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+/*
+GET /resources?location_id=&type=&amenities=
+Public – list the resources with their amenities and photos, optionally
+filtered by location, type and amenities
+*/
 func GetResources(c echo.Context) error {
+	query, err := filterResources(c, db(c).Preload("Location").Preload("Amenities").Preload("Photos"))
+	if err != nil {
+		return err
+	}
+
 	var resources []models.Resource
-	config.DB.Find(&resources)
+	if err := query.Find(&resources).Error; err != nil {
+		return apperr.Internal("resources_fetch_failed", "Échec de la récupération des ressources", err)
+	}
 	return c.JSON(http.StatusOK, resources)
 }
 
-func CreateResource(c echo.Context) error {
-	var resource models.Resource
-	if err := c.Bind(&resource); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Données invalides",
+// Availability states of a resource over a period.
+const (
+	AvailabilityFree    = "available" // no unit booked
+	AvailabilityPartial = "partial"   // some units left
+	AvailabilityFull    = "full"
+)
+
+// ResourceAvailability is the capacity left on a resource over a period, in
+// units (booked is the most units held at the same time in the period).
+type ResourceAvailability struct {
+	Resource  models.Resource `json:"resource"`
+	Capacity  int             `json:"capacity"`
+	Booked    int             `json:"booked"`
+	Available int             `json:"available"`
+	State     string          `json:"state"`
+	// Timezone is the one of the resource's site, "" without location.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+/*
+GET /resources/availability?from=&to=&location_id=&type=&amenities=&quantity=
+Public – units booked and left on each resource over [from, to), with the
+filters of GET /resources; quantity keeps the resources with at least that
+many units left
+*/
+func GetResourceAvailability(c echo.Context) error {
+	loc := callerLocation(c)
+	from, err := schedule.ParseDate(c.QueryParam("from"), loc)
+	if err != nil {
+		return apperr.BadRequest("invalid_from", "Date de début invalide")
+	}
+	to, err := schedule.ParseDate(c.QueryParam("to"), loc)
+	if err != nil {
+		return apperr.BadRequest("invalid_to", "Date de fin invalide")
+	}
+	if !from.Before(to) {
+		return errInvalidPeriod
+	}
+
+	query, err := filterResources(c, db(c).Preload("Location").Preload("Amenities").Order("name"))
+	if err != nil {
+		return err
+	}
+
+	quantity := 0
+	if value := c.QueryParam("quantity"); value != "" {
+		if quantity, err = strconv.Atoi(value); err != nil || quantity < 1 {
+			return errInvalidQuantity
+		}
+	}
+
+	var resources []models.Resource
+	if err := query.Find(&resources).Error; err != nil {
+		return apperr.Internal("resources_fetch_failed", "Échec de la récupération des ressources", err)
+	}
+
+	booked, err := bookedByResource(db(c), from, to, nil)
+	if err != nil {
+		return apperr.Internal("availability_check_failed", "Échec de la vérification de disponibilité", err)
+	}
+
+	timezones, err := siteTimezones(c)
+	if err != nil {
+		return errLocationsFetch.Wrap(err)
+	}
+
+	availability := make([]ResourceAvailability, 0, len(resources))
+	for _, resource := range resources {
+		entry := ResourceAvailability{
+			Resource:  resource,
+			Capacity:  resource.Capacity,
+			Booked:    booked[resource.ID],
+			Available: max(resource.Capacity-booked[resource.ID], 0),
+		}
+		switch {
+		case entry.Booked == 0:
+			entry.State = AvailabilityFree
+		case entry.Available > 0:
+			entry.State = AvailabilityPartial
+		default:
+			entry.State = AvailabilityFull
+		}
+		if entry.Available < quantity {
+			continue
+		}
+		if resource.LocationID != nil {
+			entry.Timezone = timezones[*resource.LocationID]
+		}
+		availability = append(availability, entry)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"from":      from,
+		"to":        to,
+		"resources": availability,
+	})
+}
+
+// bookedByResource is the most units held at the same time on each resource
+// during [start, end), turnaround included, on the given resources only
+// unless resourceIDs is nil. Reservations that follow each other within the
+// period do not add up.
+func bookedByResource(tx *gorm.DB, start, end time.Time, resourceIDs []string) (map[string]int, error) {
+	query := overlappingReservations(tx, start, end)
+	if resourceIDs != nil {
+		query = query.Where("reservations.resource_id IN ?", resourceIDs)
+	}
+
+	var rows []struct {
+		ResourceID        string
+		StartAt           time.Time
+		EndAt             time.Time
+		Quantity          int
+		TurnaroundMinutes int
+	}
+	if err := query.
+		Select("reservations.resource_id, reservations.start_at, reservations.end_at, reservations.quantity, " +
+			"resources.setup_minutes + resources.teardown_minutes AS turnaround_minutes").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	held := make(map[string][]models.Reservation)
+	turnarounds := make(map[string]time.Duration)
+	for _, row := range rows {
+		held[row.ResourceID] = append(held[row.ResourceID], models.Reservation{
+			StartAt:  row.StartAt,
+			EndAt:    row.EndAt,
+			Quantity: row.Quantity,
 		})
+		turnarounds[row.ResourceID] = time.Duration(row.TurnaroundMinutes) * time.Minute
+	}
+
+	booked := make(map[string]int, len(held))
+	for id, reservations := range held {
+		booked[id] = models.PeakQuantity(reservations, turnarounds[id], start, end)
+	}
+	return booked, nil
+}
+
+// siteTimezones maps every location to the timezone of its site.
+func siteTimezones(c echo.Context) (map[uuid.UUID]string, error) {
+	var locations []models.Location
+	if err := db(c).Select("id", "parent_id", "timezone").Find(&locations).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]models.Location, len(locations))
+	for _, location := range locations {
+		byID[location.ID] = location
+	}
+
+	timezones := make(map[uuid.UUID]string, len(locations))
+	for _, location := range locations {
+		site := location
+		// floor > building > site
+		for depth := 0; depth < 2 && site.ParentID != nil; depth++ {
+			site = byID[*site.ParentID]
+		}
+		timezones[location.ID] = site.Timezone
+	}
+	return timezones, nil
+}
+
+// ResourceRequest is a resource as created by admins, with its amenities
+// given by code.
+type ResourceRequest struct {
+	models.Resource
+	Amenities []string `json:"amenities"`
+}
+
+func CreateResource(c echo.Context) error {
+	var req ResourceRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+	resource := req.Resource
+
+	if resource.ApprovalPolicy != "" && !models.IsValidApprovalPolicy(resource.ApprovalPolicy) {
+		return errInvalidApprovalPolicy
 	}
 
 	if resource.Type == "room" {
 		resource.Capacity = 1
 		resource.Category = "none"
 	}
-	config.DB.Create(&resource)
-	notification := models.Notification{
-		Type:    "resource",
-		Message: "Une nouvelle ressource a été créée",
+	if resource.Seats < 0 {
+		return errInvalidSeats
+	}
+	if !validBuffer(resource.SetupMinutes) || !validBuffer(resource.TeardownMinutes) {
+		return errInvalidBuffer
+	}
+
+	// Site admins create resources in their sites only
+	if resource.LocationID != nil {
+		var location models.Location
+		if err := db(c).Select("id").First(&location, "id = ?", *resource.LocationID).Error; err != nil {
+			return lookupError(err, errLocationNotFound)
+		}
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+	resource.Location = nil
+	resource.Photos = nil
+
+	attributes, err := checkAttributes(c, resource.Type, resource.Attributes)
+	if err != nil {
+		return err
+	}
+	resource.Attributes = attributes
+
+	if resource.Amenities, err = amenitiesByCode(c, uniqueStrings(req.Amenities)); err != nil {
+		return err
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&resource).Error; err != nil {
+			return err
+		}
+
+		notification := newNotification(nil, "resource", "resource_created", nil)
+		notification.LocationID = resource.LocationID
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		return apperr.Internal("resource_create_failed", "Échec de la création de la ressource", err)
 	}
-	config.DB.Create(&notification)
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "resource.create",
+		EntityType: "resource",
+		EntityID:   resource.ID,
+		After:      resource,
+	})
+
 	return c.JSON(http.StatusCreated, resource)
 }
 
 func DeleteResource(c echo.Context) error {
 	id := c.Param("id")
 
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", id).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
 	var count int64
-	config.DB.Model(&models.Reservation{}).
+	if err := db(c).Model(&models.Reservation{}).
 		Where("resource_id = ?", id).
-		Count(&count)
+		Count(&count).Error; err != nil {
+		return apperr.Internal("reservations_count_failed", "Échec de la vérification des réservations", err)
+	}
 
 	if count > 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "La ressource ne peut pas être supprimée car elle a des réservations",
-		})
+		return apperr.BadRequest("resource_has_reservations", "La ressource ne peut pas être supprimée car elle a des réservations")
 	}
 
-	if err := config.DB.Delete(&models.Resource{}, "id = ?", id).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la suppression de la ressource",
-		})
+	var photos []models.ResourcePhoto
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("resource_id = ?", id).Delete(&models.ResourceApprover{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM resource_amenities WHERE resource_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Returning{}).Where("resource_id = ?", id).Delete(&photos).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Resource{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return apperr.Internal("resource_delete_failed", "Échec de la suppression de la ressource", err)
 	}
+	deletePhotoFiles(c, photos...)
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "resource.delete",
+		EntityType: "resource",
+		EntityID:   resource.ID,
+		Before:     resource,
+	})
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+type ApprovalPolicyRequest struct {
+	Policy      string      `json:"policy"`
+	ApproverIDs []uuid.UUID `json:"approver_ids"`
+}
+
+/*
+PUT /admin/resources/:id/approval
+Admin only – set the approval policy of a resource and its designated approvers
+*/
+func UpdateApprovalPolicy(c echo.Context) error {
+	id := c.Param("id")
+
+	var req ApprovalPolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	if !models.IsValidApprovalPolicy(req.Policy) {
+		return errInvalidApprovalPolicy
+	}
+
+	if req.Policy == models.ApprovalDelegated && len(req.ApproverIDs) == 0 {
+		return apperr.BadRequest("approvers_required", "Au moins un approbateur est requis pour une approbation déléguée")
+	}
+
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", id).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
+	var previousApprovers []uuid.UUID
+	if err := db(c).Model(&models.ResourceApprover{}).
+		Where("resource_id = ?", resource.ID).
+		Pluck("user_id", &previousApprovers).Error; err != nil {
+		return apperr.Internal("approvers_fetch_failed", "Échec de la récupération des approbateurs", err)
+	}
+
+	if len(req.ApproverIDs) > 0 {
+		var count int64
+		if err := db(c).Model(&models.User{}).Where("id IN ?", req.ApproverIDs).Count(&count).Error; err != nil {
+			return apperr.Internal("approvers_fetch_failed", "Échec de la récupération des approbateurs", err)
+		}
+		if int(count) != len(req.ApproverIDs) {
+			return apperr.BadRequest("approver_not_found", "Approbateur introuvable")
+		}
+	}
+
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&resource).Update("approval_policy", req.Policy).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("resource_id = ?", resource.ID).Delete(&models.ResourceApprover{}).Error; err != nil {
+			return err
+		}
+
+		for _, userID := range req.ApproverIDs {
+			approver := models.ResourceApprover{ResourceID: resource.ID, UserID: userID}
+			if err := tx.Create(&approver).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return apperr.Internal("approval_policy_update_failed", "Échec de la mise à jour de la politique d'approbation", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "resource.approval_policy",
+		EntityType: "resource",
+		EntityID:   resource.ID,
+		Before:     ApprovalPolicyRequest{Policy: resource.ApprovalPolicy, ApproverIDs: previousApprovers},
+		After:      req,
+	})
+
+	var approvers []models.ResourceApprover
+	if err := db(c).Preload("User").Where("resource_id = ?", resource.ID).Find(&approvers).Error; err != nil {
+		return apperr.Internal("approvers_fetch_failed", "Échec de la récupération des approbateurs", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"resource":  resource,
+		"approvers": approvers,
+	})
+}
+
+type ResourceLocationRequest struct {
+	// LocationID nil detaches the resource (global admins only).
+	LocationID *uuid.UUID `json:"location_id"`
+}
+
+/*
+PUT /admin/resources/:id/location
+Admin only – attach a resource to a site, building or floor. Site admins
+move resources between locations of their sites.
+*/
+func UpdateResourceLocation(c echo.Context) error {
+	var req ResourceLocationRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	var resource models.Resource
+	if err := db(c).First(&resource, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
+	if req.LocationID != nil {
+		var location models.Location
+		if err := db(c).Select("id").First(&location, "id = ?", *req.LocationID).Error; err != nil {
+			return lookupError(err, errLocationNotFound)
+		}
+	}
+	if err := checkSiteScope(c, req.LocationID); err != nil {
+		return err
+	}
+
+	before := resource
+	if err := db(c).Model(&resource).Update("location_id", req.LocationID).Error; err != nil {
+		return apperr.Internal("resource_update_failed", "Échec de la mise à jour de la ressource", err)
+	}
+	resource.LocationID = req.LocationID
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "resource.location",
+		EntityType: "resource",
+		EntityID:   resource.ID,
+		Before:     before,
+		After:      resource,
+	})
+
+	return c.JSON(http.StatusOK, resource)
+}
+
+type ResourceDetailsRequest struct {
+	// Fields left out are unchanged; amenities and attributes are replaced
+	// as a whole when given.
+	Description     *string     `json:"description"`
+	Seats           *int        `json:"seats"`
+	CheckInRequired *bool       `json:"check_in_required"`
+	SetupMinutes    *int        `json:"setup_minutes"`
+	TeardownMinutes *int        `json:"teardown_minutes"`
+	Amenities       *[]string   `json:"amenities"`
+	Attributes      models.JSON `json:"attributes"`
+}
+
+/*
+PUT /admin/resources/:id/details
+Admin only – set the description, seats, check-in requirement, setup and
+teardown buffers, amenities and custom attributes of a resource
+*/
+func UpdateResourceDetails(c echo.Context) error {
+	var req ResourceDetailsRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	var resource models.Resource
+	if err := db(c).Preload("Amenities").First(&resource, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errResourceNotFound)
+	}
+	if err := checkSiteScope(c, resource.LocationID); err != nil {
+		return err
+	}
+
+	before := resource
+	updates := map[string]interface{}{}
+
+	if req.Description != nil {
+		resource.Description = strings.TrimSpace(*req.Description)
+		updates["description"] = resource.Description
+	}
+
+	// Meetings already holding more attendees keep them
+	if req.Seats != nil {
+		if *req.Seats < 0 {
+			return errInvalidSeats
+		}
+		resource.Seats = *req.Seats
+		updates["seats"] = resource.Seats
+	}
+
+	if req.CheckInRequired != nil {
+		resource.CheckInRequired = *req.CheckInRequired
+		updates["check_in_required"] = resource.CheckInRequired
+	}
+
+	// Reservations already made keep their periods, the buffers apply to
+	// the capacity checks from now on
+	if req.SetupMinutes != nil {
+		if !validBuffer(*req.SetupMinutes) {
+			return errInvalidBuffer
+		}
+		resource.SetupMinutes = *req.SetupMinutes
+		updates["setup_minutes"] = resource.SetupMinutes
+	}
+	if req.TeardownMinutes != nil {
+		if !validBuffer(*req.TeardownMinutes) {
+			return errInvalidBuffer
+		}
+		resource.TeardownMinutes = *req.TeardownMinutes
+		updates["teardown_minutes"] = resource.TeardownMinutes
+	}
+
+	// Required attributes defined since the creation are enforced on edit
+	raw := resource.Attributes
+	if req.Attributes != nil {
+		raw = req.Attributes
+	}
+	attributes, err := checkAttributes(c, resource.Type, raw)
+	if err != nil {
+		return err
+	}
+	resource.Attributes = attributes
+	updates["attributes"] = attributes
+
+	if req.Amenities != nil {
+		if resource.Amenities, err = amenitiesByCode(c, uniqueStrings(*req.Amenities)); err != nil {
+			return err
+		}
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&resource).Updates(updates).Error; err != nil {
+			return err
+		}
+		if req.Amenities != nil {
+			return tx.Model(&resource).Association("Amenities").Replace(resource.Amenities)
+		}
+		return nil
+	})
+	if err != nil {
+		return apperr.Internal("resource_update_failed", "Échec de la mise à jour de la ressource", err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "resource.details",
+		EntityType: "resource",
+		EntityID:   resource.ID,
+		Before:     before,
+		After:      resource,
+	})
+
+	return c.JSON(http.StatusOK, resource)
+}
@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/i18n"
+	"spacebook/models"
+	"spacebook/schedule"
+
+	"github.com/labstack/echo/v4"
+)
+
+// statsPeriod is the [From, To) window a report covers, together with the
+// daily opening hours used to compute the open time of each resource. Dates
+// and opening hours are read on the wall clock of Location.
+type statsPeriod struct {
+	From     time.Time
+	To       time.Time
+	OpenFrom time.Duration
+	OpenTo   time.Duration
+	Weekends bool
+	Location *time.Location
+
+	// from and to are the values of the query, read again by In
+	from, to string
+}
+
+// In returns the period read on the wall clock of loc: dates given without
+// a time become its midnights.
+func (p statsPeriod) In(loc *time.Location) statsPeriod {
+	p.Location = loc
+	if p.from != "" {
+		p.From, _ = schedule.ParseDate(p.from, loc)
+	}
+	if p.to != "" {
+		p.To, _ = schedule.ParseDate(p.to, loc)
+	}
+	return p
+}
+
+// OpenHours is the open time of a single unit of capacity over the period.
+func (p statsPeriod) OpenHours() float64 {
+	return schedule.OpenDuration(p.From, p.To, p.Location, p.OpenFrom, p.OpenTo, p.Weekends).Hours()
+}
+
+type UtilisationRow struct {
+	Key          string  `json:"key"`
+	Name         string  `json:"name"`
+	Type         string  `json:"type,omitempty"`
+	Category     string  `json:"category,omitempty"`
+	Capacity     int     `json:"capacity"`
+	Reservations int64   `json:"reservations"`
+	BookedHours  float64 `json:"booked_hours"`
+	OpenHours    float64 `json:"open_hours"`
+	Utilisation  float64 `json:"utilisation"`
+}
+
+type HeatmapCell struct {
+	Weekday     int     `json:"weekday"` // ISO: 1 = Monday ... 7 = Sunday
+	Hour        int     `json:"hour"`
+	BookedHours float64 `json:"booked_hours"`
+}
+
+type DecisionStats struct {
+	Key           string  `json:"key"`
+	Name          string  `json:"name"`
+	Total         int64   `json:"total"`
+	Pending       int64   `json:"pending"`
+	Approved      int64   `json:"approved"`
+	Rejected      int64   `json:"rejected"`
+	NoShow        int64   `json:"no_show"`
+	ApprovalRate  float64 `json:"approval_rate"`
+	RejectionRate float64 `json:"rejection_rate"`
+	NoShowRate    float64 `json:"no_show_rate"`
+}
+
+type TopUserRow struct {
+	UserID       string  `json:"user_id"`
+	Username     string  `json:"username"`
+	Email        string  `json:"email"`
+	Reservations int64   `json:"reservations"`
+	BookedHours  float64 `json:"booked_hours"`
+	NoShows      int64   `json:"no_shows"`
+}
+
+const msgStatsFailed = "Échec du calcul des statistiques"
+
+// bookedHoursSQL is the duration of a reservation clipped to the period, in hours.
+const bookedHoursSQL = "EXTRACT(EPOCH FROM LEAST(reservations.end_at, @to) - GREATEST(reservations.start_at, @from)) / 3600"
+
+// openBookedHoursSQL is the part of a reservation within the period that
+// falls in the opening hours, in hours: the same window as the open hours it
+// is compared with. Each local day the reservation covers gives one window,
+// on the wall clock of @tz (the zone of the resource's site).
+const openBookedHoursSQL = `
+	SELECT SUM(EXTRACT(EPOCH FROM LEAST(reservations.end_at, @to, opening.close_at)
+	                            - GREATEST(reservations.start_at, @from, opening.open_at))) / 3600 AS hours
+	FROM (
+		SELECT (day + make_interval(mins => @open_from)) AT TIME ZONE @tz AS open_at,
+		       (day + make_interval(mins => @open_to)) AT TIME ZONE @tz AS close_at
+		FROM generate_series(date_trunc('day', reservations.start_at AT TIME ZONE @tz),
+		                     reservations.end_at AT TIME ZONE @tz, interval '1 day') AS day
+		WHERE @weekends OR EXTRACT(ISODOW FROM day) < 6
+	) AS opening
+	WHERE opening.open_at < LEAST(reservations.end_at, @to)
+	  AND opening.close_at > GREATEST(reservations.start_at, @from)`
+
+/*
+GET /admin/stats/utilisation
+Admin only – booked hours vs. open hours per resource, type or category
+(group_by=resource|type|category) over [from, to). Both count units: a
+reservation of 3 laptops for 2 hours books 6 hours. Only the booked hours
+within the opening hours count, so that utilisation stays at most 1. Dates
+and opening hours follow the timezone of each resource's site, the caller's
+for resources without one.
+*/
+func GetUtilisationStats(c echo.Context) error {
+	period, err := parseStatsPeriod(c)
+	if err != nil {
+		return err
+	}
+
+	groupBy := c.QueryParam("group_by")
+	if groupBy == "" {
+		groupBy = "resource"
+	}
+	if groupBy != "resource" && groupBy != "type" && groupBy != "category" {
+		return apperr.BadRequest("invalid_group_by", "group_by doit valoir resource, type ou category")
+	}
+
+	zones, err := resourceZones(c, period.Location)
+	if err != nil {
+		return apperr.Internal("stats_failed", msgStatsFailed, err)
+	}
+
+	// One query per zone: the resources of a site share its wall clock
+	var perResource []UtilisationRow
+	for _, zone := range zones {
+		local := period.In(zone.Location)
+		args := statsArgs(local)
+		args["resources"] = zone.ResourceIDs
+
+		var rows []UtilisationRow
+		if err := db(c).Raw(`
+			SELECT resources.id AS key, resources.name, resources.type, resources.category, resources.capacity,
+			       COUNT(reservations.id) AS reservations,
+			       COALESCE(SUM(open_booked.hours * reservations.quantity), 0) AS booked_hours
+			FROM resources
+			LEFT JOIN reservations ON reservations.resource_id = resources.id
+			     AND reservations.status = @approved
+			     AND reservations.start_at < @to AND reservations.end_at > @from
+			LEFT JOIN LATERAL (`+openBookedHoursSQL+`) AS open_booked ON true
+			WHERE resources.id IN @resources
+			GROUP BY resources.id, resources.name, resources.type, resources.category, resources.capacity`,
+			args,
+		).Scan(&rows).Error; err != nil {
+			return apperr.Internal("stats_failed", msgStatsFailed, err)
+		}
+
+		openHours := local.OpenHours()
+		for i := range rows {
+			rows[i].OpenHours = openHours * float64(rows[i].Capacity)
+		}
+		perResource = append(perResource, rows...)
+	}
+	sort.SliceStable(perResource, func(i, j int) bool { return perResource[i].Name < perResource[j].Name })
+
+	rows := groupUtilisation(perResource, groupBy)
+
+	if wantsCSV(c) {
+		records := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			records = append(records, []string{
+				row.Key, row.Name, row.Type, row.Category, strconv.Itoa(row.Capacity),
+				strconv.FormatInt(row.Reservations, 10), formatFloat(row.BookedHours),
+				formatFloat(row.OpenHours), formatFloat(row.Utilisation),
+			})
+		}
+		return writeCSV(c, "utilisation.csv", []string{
+			"key", "name", "type", "category", "capacity",
+			"reservations", "booked_hours", "open_hours", "utilisation",
+		}, records)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"from":     period.From,
+		"to":       period.To,
+		"group_by": groupBy,
+		"rows":     rows,
+	})
+}
+
+/*
+GET /admin/stats/heatmap
+Admin only – approved booked hours per weekday and hour of day (in the
+caller's zone), to spot peak hours.
+*/
+func GetHeatmapStats(c echo.Context) error {
+	period, err := parseStatsPeriod(c)
+	if err != nil {
+		return err
+	}
+
+	// Each reservation is split into the hour slots it covers; every slot
+	// contributes the part of the hour actually booked.
+	var cells []HeatmapCell
+	if err := db(c).Raw(`
+		SELECT EXTRACT(ISODOW FROM slot AT TIME ZONE @tz)::int AS weekday,
+		       EXTRACT(HOUR FROM slot AT TIME ZONE @tz)::int AS hour,
+		       SUM(EXTRACT(EPOCH FROM LEAST(reservations.end_at, @to, slot + interval '1 hour')
+		                            - GREATEST(reservations.start_at, @from, slot)) / 3600) AS booked_hours
+		FROM reservations,
+		     generate_series(date_trunc('hour', GREATEST(reservations.start_at, @from), @tz),
+		                     LEAST(reservations.end_at, @to) - interval '1 microsecond',
+		                     interval '1 hour') AS slot
+		WHERE reservations.status = @approved
+		  AND reservations.start_at < @to AND reservations.end_at > @from
+		GROUP BY 1, 2
+		ORDER BY 1, 2`,
+		statsArgs(period),
+	).Scan(&cells).Error; err != nil {
+		return apperr.Internal("stats_failed", msgStatsFailed, err)
+	}
+
+	if wantsCSV(c) {
+		records := make([][]string, 0, len(cells))
+		for _, cell := range cells {
+			records = append(records, []string{
+				strconv.Itoa(cell.Weekday), strconv.Itoa(cell.Hour), formatFloat(cell.BookedHours),
+			})
+		}
+		return writeCSV(c, "heatmap.csv", []string{"weekday", "hour", "booked_hours"}, records)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"from":  period.From,
+		"to":    period.To,
+		"cells": cells,
+	})
+}
+
+/*
+GET /admin/stats/decisions
+Admin only – approval, rejection and no-show ratios per resource and overall,
+for reservations starting in [from, to).
+*/
+func GetDecisionStats(c echo.Context) error {
+	period, err := parseStatsPeriod(c)
+	if err != nil {
+		return err
+	}
+
+	var rows []DecisionStats
+	if err := db(c).Raw(`
+		SELECT resources.id AS key, resources.name,
+		       COUNT(reservations.id) AS total,
+		       COUNT(*) FILTER (WHERE reservations.status = @pending) AS pending,
+		       COUNT(*) FILTER (WHERE reservations.status = @approved) AS approved,
+		       COUNT(*) FILTER (WHERE reservations.status = @rejected) AS rejected,
+		       COUNT(*) FILTER (WHERE reservations.status = @no_show) AS no_show
+		FROM resources
+		JOIN reservations ON reservations.resource_id = resources.id
+		WHERE reservations.start_at >= @from AND reservations.start_at < @to
+		GROUP BY resources.id, resources.name
+		ORDER BY resources.name`,
+		statsArgs(period),
+	).Scan(&rows).Error; err != nil {
+		return apperr.Internal("stats_failed", msgStatsFailed, err)
+	}
+
+	overall := DecisionStats{Key: "all", Name: i18n.Message(c, "stats_all_resources", nil)}
+	for i := range rows {
+		computeDecisionRates(&rows[i])
+		overall.Total += rows[i].Total
+		overall.Pending += rows[i].Pending
+		overall.Approved += rows[i].Approved
+		overall.Rejected += rows[i].Rejected
+		overall.NoShow += rows[i].NoShow
+	}
+	computeDecisionRates(&overall)
+
+	if wantsCSV(c) {
+		records := make([][]string, 0, len(rows)+1)
+		for _, row := range append(rows, overall) {
+			records = append(records, []string{
+				row.Key, row.Name,
+				strconv.FormatInt(row.Total, 10), strconv.FormatInt(row.Pending, 10),
+				strconv.FormatInt(row.Approved, 10), strconv.FormatInt(row.Rejected, 10),
+				strconv.FormatInt(row.NoShow, 10), formatFloat(row.ApprovalRate),
+				formatFloat(row.RejectionRate), formatFloat(row.NoShowRate),
+			})
+		}
+		return writeCSV(c, "decisions.csv", []string{
+			"key", "name", "total", "pending", "approved", "rejected", "no_show",
+			"approval_rate", "rejection_rate", "no_show_rate",
+		}, records)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"from":      period.From,
+		"to":        period.To,
+		"overall":   overall,
+		"resources": rows,
+	})
+}
+
+/*
+GET /admin/stats/top-users
+Admin only – users with the most approved booked hours over [from, to).
+*/
+func GetTopUsersStats(c echo.Context) error {
+	period, err := parseStatsPeriod(c)
+	if err != nil {
+		return err
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	args := statsArgs(period)
+	args["limit"] = limit
+
+	var rows []TopUserRow
+	if err := db(c).Raw(`
+		SELECT users.id AS user_id, users.username, users.email,
+		       COUNT(*) FILTER (WHERE reservations.status = @approved) AS reservations,
+		       COALESCE(SUM(`+bookedHoursSQL+`) FILTER (WHERE reservations.status = @approved), 0) AS booked_hours,
+		       COUNT(*) FILTER (WHERE reservations.status = @no_show) AS no_shows
+		FROM users
+		JOIN reservations ON reservations.user_id = users.id
+		WHERE reservations.start_at < @to AND reservations.end_at > @from
+		GROUP BY users.id, users.username, users.email
+		ORDER BY booked_hours DESC, reservations DESC
+		LIMIT @limit`,
+		args,
+	).Scan(&rows).Error; err != nil {
+		return apperr.Internal("stats_failed", msgStatsFailed, err)
+	}
+
+	if wantsCSV(c) {
+		records := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			records = append(records, []string{
+				row.UserID, row.Username, row.Email, strconv.FormatInt(row.Reservations, 10),
+				formatFloat(row.BookedHours), strconv.FormatInt(row.NoShows, 10),
+			})
+		}
+		return writeCSV(c, "top-users.csv", []string{
+			"user_id", "username", "email", "reservations", "booked_hours", "no_shows",
+		}, records)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"from":  period.From,
+		"to":    period.To,
+		"users": rows,
+	})
+}
+
+// parseStatsPeriod reads from/to (RFC3339 or YYYY-MM-DD, default: the last
+// 30 days), open_from/open_to (HH:MM, default 08:00-18:00) and weekends
+// (default false) from the query string, in the caller's zone (In reads
+// them again in another one).
+func parseStatsPeriod(c echo.Context) (statsPeriod, error) {
+	now := time.Now().UTC()
+	period := statsPeriod{
+		From:     now.AddDate(0, 0, -30),
+		To:       now,
+		OpenFrom: 8 * time.Hour,
+		OpenTo:   18 * time.Hour,
+		Location: callerLocation(c),
+	}
+
+	var err error
+	if value := c.QueryParam("from"); value != "" {
+		if period.From, err = schedule.ParseDate(value, period.Location); err != nil {
+			return period, apperr.BadRequest("invalid_from", "Date de début invalide")
+		}
+	}
+	if value := c.QueryParam("to"); value != "" {
+		if period.To, err = schedule.ParseDate(value, period.Location); err != nil {
+			return period, apperr.BadRequest("invalid_to", "Date de fin invalide")
+		}
+	}
+	if !period.From.Before(period.To) {
+		return period, errInvalidPeriod
+	}
+
+	if value := c.QueryParam("open_from"); value != "" {
+		if period.OpenFrom, err = parseClock(value); err != nil {
+			return period, apperr.BadRequest("invalid_open_from", "Heure d'ouverture invalide")
+		}
+	}
+	if value := c.QueryParam("open_to"); value != "" {
+		if period.OpenTo, err = parseClock(value); err != nil {
+			return period, apperr.BadRequest("invalid_open_to", "Heure de fermeture invalide")
+		}
+	}
+	if period.OpenFrom >= period.OpenTo {
+		return period, apperr.BadRequest("invalid_opening_hours", "L'heure d'ouverture doit précéder l'heure de fermeture")
+	}
+
+	period.Weekends = c.QueryParam("weekends") == "true"
+	period.from, period.to = c.QueryParam("from"), c.QueryParam("to")
+
+	return period, nil
+}
+
+// statsZone is a timezone and the resources whose opening hours follow it.
+type statsZone struct {
+	Location    *time.Location
+	ResourceIDs []string
+}
+
+// resourceZones groups the resources by the timezone of their site; those
+// without a location, or in a site without timezone, use fallback.
+func resourceZones(c echo.Context, fallback *time.Location) ([]statsZone, error) {
+	var resources []models.Resource
+	if err := db(c).Select("id", "location_id").Order("id").Find(&resources).Error; err != nil {
+		return nil, err
+	}
+	timezones, err := siteTimezones(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []statsZone
+	index := map[string]int{}
+	for _, resource := range resources {
+		loc := fallback
+		if resource.LocationID != nil && timezones[*resource.LocationID] != "" {
+			if siteLoc, err := schedule.Location(timezones[*resource.LocationID]); err == nil {
+				loc = siteLoc
+			}
+		}
+
+		i, ok := index[loc.String()]
+		if !ok {
+			i = len(zones)
+			index[loc.String()] = i
+			zones = append(zones, statsZone{Location: loc})
+		}
+		zones[i].ResourceIDs = append(zones[i].ResourceIDs, resource.ID)
+	}
+	return zones, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+func statsArgs(period statsPeriod) map[string]interface{} {
+	return map[string]interface{}{
+		"from":      period.From,
+		"to":        period.To,
+		"pending":   models.StatusPending,
+		"approved":  models.StatusApproved,
+		"rejected":  models.StatusRejected,
+		"no_show":   models.StatusNoShow,
+		"tz":        period.Location.String(),
+		"open_from": int(period.OpenFrom / time.Minute),
+		"open_to":   int(period.OpenTo / time.Minute),
+		"weekends":  period.Weekends,
+	}
+}
+
+// groupUtilisation rolls the per-resource rows up by type or category and
+// computes the utilisation ratio of each row.
+func groupUtilisation(perResource []UtilisationRow, groupBy string) []UtilisationRow {
+	if groupBy == "resource" {
+		for i := range perResource {
+			perResource[i].Utilisation = ratio(perResource[i].BookedHours, perResource[i].OpenHours)
+		}
+		return perResource
+	}
+
+	groups := map[string]*UtilisationRow{}
+	for _, row := range perResource {
+		key := row.Type
+		if groupBy == "category" {
+			key = row.Category
+		}
+
+		group, ok := groups[key]
+		if !ok {
+			group = &UtilisationRow{Key: key, Name: key}
+			groups[key] = group
+		}
+		group.Capacity += row.Capacity
+		group.Reservations += row.Reservations
+		group.BookedHours += row.BookedHours
+		group.OpenHours += row.OpenHours
+	}
+
+	rows := make([]UtilisationRow, 0, len(groups))
+	for _, group := range groups {
+		group.Utilisation = ratio(group.BookedHours, group.OpenHours)
+		rows = append(rows, *group)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+
+	return rows
+}
+
+func computeDecisionRates(row *DecisionStats) {
+	row.ApprovalRate = ratio(float64(row.Approved+row.NoShow), float64(row.Approved+row.NoShow+row.Rejected))
+	row.RejectionRate = ratio(float64(row.Rejected), float64(row.Approved+row.NoShow+row.Rejected))
+	row.NoShowRate = ratio(float64(row.NoShow), float64(row.Approved+row.NoShow))
+}
+
+func ratio(numerator, denominator float64) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return numerator / denominator
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxSuggestions bounds the slots and the resources suggested.
+	maxSuggestions = 3
+	// Free slots are searched by steps of suggestionStep, up to
+	// suggestionHorizon before and after the requested one.
+	suggestionStep    = 15 * time.Minute
+	suggestionHorizon = 24 * time.Hour
+)
+
+// Suggestions are offered when a resource is full for the requested period:
+// the nearest free periods of the same length on the resource, and similar
+// resources free for the requested one.
+type Suggestions struct {
+	Slots     []SlotSuggestion     `json:"slots"`
+	Resources []ResourceSuggestion `json:"resources"`
+}
+
+type SlotSuggestion struct {
+	StartAt   time.Time `json:"start_at"`
+	EndAt     time.Time `json:"end_at"`
+	Available int       `json:"available"`
+}
+
+type ResourceSuggestion struct {
+	Resource  models.Resource `json:"resource"`
+	Available int             `json:"available"`
+	// Distance is 0 in the same location as the requested resource, then
+	// grows with each level up to their common site.
+	Distance int `json:"distance"`
+}
+
+// suggestAlternatives looks for what can replace quantity units of resource
+// during [start, end).
+func suggestAlternatives(tx *gorm.DB, resource models.Resource, start, end time.Time, quantity int) (Suggestions, error) {
+	var suggestions Suggestions
+	var err error
+
+	if suggestions.Slots, err = freeSlots(tx, resource, start, end, quantity, maxSuggestions); err != nil {
+		return suggestions, err
+	}
+	if suggestions.Resources, err = similarResources(tx, resource, start, end, quantity, maxSuggestions); err != nil {
+		return suggestions, err
+	}
+	return suggestions, nil
+}
+
+// freeSlots returns up to limit periods as long as [start, end) where the
+// resource has quantity units left, turnaround included, nearest first.
+// Periods already started are skipped.
+func freeSlots(tx *gorm.DB, resource models.Resource, start, end time.Time, quantity, limit int) ([]SlotSuggestion, error) {
+	var held []models.Reservation
+	if err := overlappingReservations(tx, start.Add(-suggestionHorizon), end.Add(suggestionHorizon)).
+		Where("reservations.resource_id = ?", resource.ID).
+		Select("reservations.start_at", "reservations.end_at", "reservations.quantity").
+		Find(&held).Error; err != nil {
+		return nil, err
+	}
+
+	duration := end.Sub(start)
+	turnaround := resource.Turnaround()
+	now := time.Now()
+	slots := []SlotSuggestion{}
+	for shift := suggestionStep; shift <= suggestionHorizon && len(slots) < limit; shift += suggestionStep {
+		// Earlier first at the same distance
+		for _, candidate := range []time.Time{start.Add(-shift), start.Add(shift)} {
+			if candidate.Before(now) || len(slots) == limit {
+				continue
+			}
+
+			booked := 0
+			for _, reservation := range held {
+				if reservation.StartAt.Before(candidate.Add(duration+turnaround)) && reservation.EndAt.After(candidate.Add(-turnaround)) {
+					booked += reservation.Quantity
+				}
+			}
+			if available := resource.Capacity - booked; available >= quantity {
+				slots = append(slots, SlotSuggestion{StartAt: candidate, EndAt: candidate.Add(duration), Available: available})
+			}
+		}
+	}
+	return slots, nil
+}
+
+// similarResources returns up to limit resources of the same type and
+// category as resource, in the same site, with quantity units left during
+// [start, end). The nearest come first, then the smallest capacity so that
+// larger resources stay free for larger needs.
+func similarResources(tx *gorm.DB, resource models.Resource, start, end time.Time, quantity, limit int) ([]ResourceSuggestion, error) {
+	query := tx.Where("type = ? AND category = ? AND id <> ? AND capacity >= ?",
+		resource.Type, resource.Category, resource.ID, quantity)
+
+	var parents map[uuid.UUID]*uuid.UUID
+	var ancestors []uuid.UUID
+	if resource.LocationID != nil {
+		var locations []models.Location
+		if err := tx.Select("id", "parent_id").Find(&locations).Error; err != nil {
+			return nil, err
+		}
+		parents = make(map[uuid.UUID]*uuid.UUID, len(locations))
+		for _, location := range locations {
+			parents[location.ID] = location.ParentID
+		}
+
+		ancestors = locationAncestors(parents, *resource.LocationID)
+		site := ancestors[len(ancestors)-1]
+		query = query.Where("location_id IN (?)", tx.Raw(locationSubtreeSQL, []uuid.UUID{site}))
+	}
+
+	var candidates []models.Resource
+	if err := query.Order("name").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return []ResourceSuggestion{}, nil
+	}
+
+	ids := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		ids[i] = candidate.ID
+	}
+	booked, err := bookedByResource(tx, start, end, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []ResourceSuggestion{}
+	for _, candidate := range candidates {
+		available := candidate.Capacity - booked[candidate.ID]
+		if available < quantity {
+			continue
+		}
+
+		distance := 0
+		if candidate.LocationID != nil && ancestors != nil {
+			candidateAncestors := locationAncestors(parents, *candidate.LocationID)
+			distance = slices.IndexFunc(ancestors, func(id uuid.UUID) bool {
+				return slices.Contains(candidateAncestors, id)
+			})
+		}
+		suggestions = append(suggestions, ResourceSuggestion{Resource: candidate, Available: available, Distance: distance})
+	}
+
+	// Stable: resources at the same distance and capacity stay by name
+	slices.SortStableFunc(suggestions, func(a, b ResourceSuggestion) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.Resource.Capacity, b.Resource.Capacity))
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// locationAncestors returns a location followed by its parents, up to its
+// site.
+func locationAncestors(parents map[uuid.UUID]*uuid.UUID, id uuid.UUID) []uuid.UUID {
+	ancestors := []uuid.UUID{id}
+	// floor > building > site
+	for depth := 0; depth < 2; depth++ {
+		parent := parents[id]
+		if parent == nil {
+			break
+		}
+		id = *parent
+		ancestors = append(ancestors, id)
+	}
+	return ancestors
+}
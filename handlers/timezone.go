@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"time"
+
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/schedule"
+
+	"github.com/labstack/echo/v4"
+)
+
+// callerLocation returns the zone the caller reads times in: the tz query
+// parameter (checked by middleware.Timezone), else the timezone of the
+// authenticated user, else UTC.
+func callerLocation(c echo.Context) *time.Location {
+	name := c.QueryParam("tz")
+	if name == "" {
+		name, _ = c.Get(middleware.TimezoneContextKey).(string)
+	}
+	if loc, err := schedule.Location(name); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// localizeReservations renders the times of reservations in loc. Only the
+// representation changes: the instants are those stored, in UTC.
+func localizeReservations(reservations []models.Reservation, loc *time.Location) {
+	for i := range reservations {
+		localizeReservation(&reservations[i], loc)
+	}
+}
+
+func localizeReservation(reservation *models.Reservation, loc *time.Location) {
+	reservation.StartAt = reservation.StartAt.In(loc)
+	reservation.EndAt = reservation.EndAt.In(loc)
+	if reservation.CheckedInAt != nil {
+		checkedInAt := reservation.CheckedInAt.In(loc)
+		reservation.CheckedInAt = &checkedInAt
+	}
+	reservation.CreatedAt = reservation.CreatedAt.In(loc)
+	reservation.UpdatedAt = reservation.UpdatedAt.In(loc)
+}
+
+// respondWithReservations writes reservations with their times in the
+// caller's zone.
+func respondWithReservations(c echo.Context, status int, reservations []models.Reservation) error {
+	loc := callerLocation(c)
+	localizeReservations(reservations, loc)
+	return c.JSON(status, reservations)
+}
+
+// respondWithReservation writes a reservation with its times in the
+// caller's zone.
+func respondWithReservation(c echo.Context, status int, reservation models.Reservation) error {
+	loc := callerLocation(c)
+	localizeReservation(&reservation, loc)
+	return c.JSON(status, reservation)
+}
+
+// respondWithBookingGroup writes a booking group with its times and those of
+// its items in the caller's zone.
+func respondWithBookingGroup(c echo.Context, status int, group models.BookingGroup) error {
+	loc := callerLocation(c)
+	group.StartAt = group.StartAt.In(loc)
+	group.EndAt = group.EndAt.In(loc)
+	localizeReservations(group.Items, loc)
+	return c.JSON(status, group)
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/totp"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errTwoFactorEnabled     = apperr.Conflict("two_factor_already_enabled", "L'authentification à deux facteurs est déjà activée")
+	errTwoFactorNotEnabled  = apperr.BadRequest("two_factor_not_enabled", "L'authentification à deux facteurs n'est pas activée")
+	errTwoFactorNotEnrolled = apperr.BadRequest("two_factor_not_enrolled", "Aucune inscription à l'authentification à deux facteurs en cours")
+	errInvalidTwoFactor     = apperr.Unauthorized("invalid_two_factor_code", "Code de vérification invalide")
+	errTwoFactorMandatory   = apperr.Forbidden("two_factor_mandatory", "L'authentification à deux facteurs est obligatoire pour les administrateurs")
+	errTwoFactorFailed      = apperr.Internal("two_factor_failed", "Échec de l'authentification à deux facteurs", nil)
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+	// RecoveryCode may replace Code where a second factor is checked.
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	TwoFactorCodeRequest
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	TwoFactorCodeRequest
+}
+
+type EnrolmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+// respondWithChallenge answers a correct password of a two-factor account.
+func respondWithChallenge(c echo.Context, user models.User) error {
+	challenge, err := middleware.GenerateChallengeToken(user)
+	if err != nil {
+		return errTokenGeneration.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "auth.login_challenge",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+	})
+
+	return c.JSON(http.StatusOK, TwoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		ExpiresIn:         int(config.Get().TwoFactor.ChallengeTTL.Seconds()),
+	})
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, and
+// consumes it: a TOTP step or a recovery code is only accepted once.
+func verifySecondFactor(c echo.Context, user *models.User, req TwoFactorCodeRequest) (bool, error) {
+	if req.Code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return false, nil
+		}
+
+		// Conditional update: two concurrent requests cannot use the same step
+		result := db(c).Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, errTwoFactorFailed.Wrap(result.Error)
+		}
+		user.TOTPLastStep = step
+		return result.RowsAffected == 1, nil
+	}
+
+	if req.RecoveryCode != "" {
+		result := db(c).Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(req.RecoveryCode)).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return false, errTwoFactorFailed.Wrap(result.Error)
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	return false, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and returns new
+// ones, only stored hashed.
+func replaceRecoveryCodes(tx *gorm.DB, user models.User) ([]string, error) {
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = models.RecoveryCode{UserID: user.ID, CodeHash: hashRecoveryCode(code)}
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+/*
+POST /auth/2fa
+Public – second login step: exchanges the challenge token returned by Login
+and a TOTP (or recovery) code for a session token
+*/
+func LoginTwoFactor(c echo.Context) error {
+	var req TwoFactorLoginRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	userID, err := middleware.ParseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := db(c).Where("deleted_at IS NULL").First(&user, "id = ?", userID).Error; err != nil {
+		return lookupError(err, errUserNotFound)
+	}
+	if !user.TOTPEnabled {
+		return errTwoFactorNotEnabled
+	}
+
+	// Codes are brute-forceable: same throttling and lockout as passwords
+	guard := newLoginGuard(c, user.Email)
+	if err := guard.check(); err != nil {
+		return err
+	}
+
+	ok, err := verifySecondFactor(c, &user, req.TwoFactorCodeRequest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := guard.record(); err != nil {
+			return err
+		}
+		return errInvalidTwoFactor
+	}
+
+	if err := guard.succeed(); err != nil {
+		return err
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "auth.login",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		After:      echo.Map{"two_factor": true, "recovery_code": req.Code == ""},
+	})
+
+	return respondWithToken(c, user)
+}
+
+/*
+POST /me/2fa/enroll
+Authenticated – start the enrolment (password required): returns the secret
+and its otpauth:// URI to show as a QR code. Inactive until verified.
+*/
+func EnrollTwoFactor(c echo.Context) error {
+	var req PasswordConfirmation
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return errTwoFactorEnabled
+	}
+	if err := checkPassword(user, req.Password); err != nil {
+		return err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return errTwoFactorFailed.Wrap(err)
+	}
+
+	if err := db(c).Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return errUserUpdate.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.2fa_enroll",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+	})
+
+	return c.JSON(http.StatusOK, EnrolmentResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(config.Get().TwoFactor.Issuer, user.Email, secret),
+	})
+}
+
+/*
+POST /me/2fa/verify
+Authenticated – confirm the enrolment with a first code. Returns the
+recovery codes (shown only once) and a token of a two-factor session.
+*/
+func VerifyTwoFactor(c echo.Context) error {
+	var req TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return errTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return errTwoFactorNotEnrolled
+	}
+
+	// Recovery codes do not exist yet: only a TOTP code can confirm
+	ok, err := verifySecondFactor(c, &user, TwoFactorCodeRequest{Code: req.Code})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidTwoFactor
+	}
+
+	var codes []string
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user)
+		return err
+	})
+	if err != nil {
+		return errTwoFactorFailed.Wrap(err)
+	}
+
+	token, err := middleware.GenerateToken(user)
+	if err != nil {
+		return errTokenGeneration.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.2fa_enable",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+	})
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"recovery_codes": codes,
+		"token":          token,
+		"user":           user,
+	})
+}
+
+/*
+POST /me/2fa/recovery-codes
+Authenticated – replace the recovery codes (TOTP code required)
+*/
+func RegenerateRecoveryCodes(c echo.Context) error {
+	var req TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return errTwoFactorNotEnabled
+	}
+
+	ok, err := verifySecondFactor(c, &user, TwoFactorCodeRequest{Code: req.Code})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidTwoFactor
+	}
+
+	var codes []string
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, user)
+		return err
+	})
+	if err != nil {
+		return errTwoFactorFailed.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.2fa_recovery_codes",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+	})
+
+	return c.JSON(http.StatusOK, echo.Map{"recovery_codes": codes})
+}
+
+/*
+POST /me/2fa/disable
+Authenticated – turn two-factor off (password and code required, the code
+alone for accounts without password). Refused to admins when the policy
+requires two-factor for them.
+*/
+func DisableTwoFactor(c echo.Context) error {
+	var req DisableTwoFactorRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return errTwoFactorNotEnabled
+	}
+	if user.Role == "admin" && config.Get().TwoFactor.RequireForAdmins {
+		return errTwoFactorMandatory
+	}
+	// Accounts without password confirm with the code alone
+	if len(user.Password) > 0 {
+		if err := checkPassword(user, req.Password); err != nil {
+			return err
+		}
+	}
+
+	ok, err := verifySecondFactor(c, &user, req.TwoFactorCodeRequest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidTwoFactor
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return errTwoFactorFailed.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.2fa_disable",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+	})
+
+	return respondWithToken(c, user)
+}
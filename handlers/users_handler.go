@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
-	"spacebook/config"
+	"spacebook/apperr"
+	"spacebook/middleware"
 	"spacebook/models"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
-
 /*
 GET /admin/users
 Admin only – list all users with User
@@ -17,18 +20,197 @@ Admin only – list all users with User
 func GetUsers(c echo.Context) error {
 	var users []models.User
 
-	if err := config.DB.
+	if err := db(c).
 		Order("created_at DESC").
 		Find(&users).Error; err != nil {
 
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la récupération des utilisateurs",
-		})
+		return apperr.Internal("users_fetch_failed", "Échec de la récupération des utilisateurs", err)
 	}
 
 	return c.JSON(http.StatusOK, users)
 }
 
+type UpdateRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// updateRole changes the role and revokes the sessions carrying the old one.
+// A demoted admin loses their sites, which would otherwise apply again on a
+// later promotion.
+func updateRole(tx *gorm.DB, user *models.User, role string) error {
+	if err := tx.Model(user).Update("role", role).Error; err != nil {
+		return err
+	}
+	if role != "admin" {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.SiteAdmin{}).Error; err != nil {
+			return err
+		}
+	}
+	return revokeSessions(tx, user)
+}
+
+// globalAdmins selects the admins not restricted to sites.
+func globalAdmins(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.User{}).
+		Where("role = ? AND deleted_at IS NULL", "admin").
+		Where("NOT EXISTS (SELECT 1 FROM site_admins WHERE site_admins.user_id = users.id)")
+}
+
+// isLastAdmin tells whether user is the only remaining global
+// administrator: site admins cannot manage users.
+func isLastAdmin(c echo.Context, user models.User) (bool, error) {
+	if user.Role != "admin" {
+		return false, nil
+	}
+
+	var global, restricted int64
+	if err := globalAdmins(db(c)).Count(&global).Error; err != nil {
+		return false, apperr.Internal("user_lookup_failed", "Échec de la recherche de l'utilisateur", err)
+	}
+	if err := db(c).Model(&models.SiteAdmin{}).Where("user_id = ?", user.ID).Count(&restricted).Error; err != nil {
+		return false, apperr.Internal("user_lookup_failed", "Échec de la recherche de l'utilisateur", err)
+	}
+	return restricted == 0 && global <= 1, nil
+}
+
+/*
+PUT /admin/user/:id/role
+Admin only – change the role of a user; their current sessions are revoked
+*/
+func UpdateUserRole(c echo.Context) error {
+	var req UpdateRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+	if req.Role != "user" && req.Role != "admin" {
+		return errInvalidRole
+	}
+
+	var user models.User
+	if err := db(c).Where("deleted_at IS NULL").First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errUserNotFound)
+	}
+	if user.Role == req.Role {
+		return c.JSON(http.StatusOK, user)
+	}
+
+	if last, err := isLastAdmin(c, user); err != nil {
+		return err
+	} else if last {
+		return apperr.Conflict("last_admin_demotion", "Impossible de retirer le rôle du dernier administrateur")
+	}
+
+	before := user
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		return updateRole(tx, &user, req.Role)
+	})
+	if err != nil {
+		return errUserUpdate.Wrap(err)
+	}
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.role",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		Before:     before,
+		After:      user,
+	})
+
+	return c.JSON(http.StatusOK, user)
+}
+
+type AdminSitesRequest struct {
+	// SiteIDs restricts the admin to these sites; empty makes them global.
+	SiteIDs []uuid.UUID `json:"site_ids"`
+}
+
+/*
+PUT /admin/user/:id/sites
+Global admin only – restrict an admin to the given sites, or make them
+global again with an empty list
+*/
+func UpdateAdminSites(c echo.Context) error {
+	var req AdminSitesRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	var user models.User
+	if err := db(c).Where("deleted_at IS NULL").First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		return lookupError(err, errUserNotFound)
+	}
+	if user.Role != "admin" {
+		return apperr.BadRequest("user_not_admin", "Seuls les administrateurs peuvent être rattachés à des sites")
+	}
+
+	sites := uniqueIDs(req.SiteIDs)
+	if len(sites) > 0 {
+		var count int64
+		if err := db(c).Model(&models.Location{}).
+			Where("id IN ? AND kind = ?", sites, models.LocationSite).
+			Count(&count).Error; err != nil {
+			return errLocationsFetch.Wrap(err)
+		}
+		if int(count) != len(sites) {
+			return apperr.BadRequest("site_not_found", "Site introuvable")
+		}
+
+		if last, err := isLastAdmin(c, user); err != nil {
+			return err
+		} else if last {
+			return apperr.Conflict("last_admin_demotion", "Impossible de retirer le rôle du dernier administrateur")
+		}
+	}
+
+	var previous []uuid.UUID
+	if err := db(c).Model(&models.SiteAdmin{}).Where("user_id = ?", user.ID).Pluck("site_id", &previous).Error; err != nil {
+		return errSiteScopeCheck.Wrap(err)
+	}
+
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.SiteAdmin{}).Error; err != nil {
+			return err
+		}
+		for _, siteID := range sites {
+			if err := tx.Create(&models.SiteAdmin{UserID: user.ID, SiteID: siteID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errUserUpdate.Wrap(err)
+	}
+	// The scope is part of the cached user state
+	middleware.ForgetUser(user.ID)
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.sites",
+		EntityType: "user",
+		EntityID:   user.ID.String(),
+		Before:     AdminSitesRequest{SiteIDs: previous},
+		After:      AdminSitesRequest{SiteIDs: sites},
+	})
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"user":     user,
+		"site_ids": sites,
+	})
+}
+
+// uniqueIDs returns ids without duplicates, in their original order.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
 /*
 GET /admin/user/:id
 Admin only – Delete a user with User
@@ -37,21 +219,39 @@ func DeleteUser(c echo.Context) error {
 	id := c.Param("id")
 
 	var count int64
-	config.DB.Model(&models.Reservation{}).
+	if err := db(c).Model(&models.Reservation{}).
 		Where("user_id = ?", id).
-		Count(&count)
+		Count(&count).Error; err != nil {
+		return apperr.Internal("reservations_count_failed", "Échec de la vérification des réservations", err)
+	}
 
 	if count > 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "L'utilisateur ne peut pas être supprimé car il a des réservations",
-		})
+		return apperr.BadRequest("user_has_reservations", "L'utilisateur ne peut pas être supprimé car il a des réservations")
+	}
+
+	var user models.User
+	if err := db(c).First(&user, "id = ?", id).Error; err != nil {
+		return lookupError(err, errUserNotFound)
 	}
 
-	if err := config.DB.Delete(&models.User{}, "id = ?", id).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Échec de la suppression de l'utilisateur",
-		})
+	// Keys of a deleted service account must stop working with it
+	if err := db(c).Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return apperr.Internal("api_key_revoke_failed", "Échec de la révocation de la clé d'API", err)
 	}
 
+	if err := db(c).Delete(&models.User{}, "id = ?", id).Error; err != nil {
+		return apperr.Internal("user_delete_failed", "Échec de la suppression de l'utilisateur", err)
+	}
+	middleware.ForgetUser(user.ID)
+
+	middleware.SetAudit(c, middleware.AuditEntry{
+		Action:     "user.delete",
+		EntityType: "user",
+		EntityID:   id,
+		Before:     user,
+	})
+
 	return c.NoContent(http.StatusNoContent)
 }
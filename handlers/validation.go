@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"spacebook/apperr"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	minPasswordLength = 10
+	// bcrypt ignores everything past 72 bytes
+	maxPasswordBytes  = 72
+	maxUsernameLength = 50
+)
+
+var (
+	errInvalidEmail    = apperr.BadRequest("invalid_email", "Adresse email invalide")
+	errInvalidUsername = apperr.BadRequest("invalid_username", "Nom d'utilisateur invalide")
+	errWeakPassword    = apperr.BadRequest("weak_password", "Le mot de passe doit contenir au moins 10 caractères dont trois types parmi minuscules, majuscules, chiffres et symboles, sans reprendre l'email ou le nom d'utilisateur")
+)
+
+// commonPasswords are refused whatever their composition.
+var commonPasswords = map[string]bool{
+	"password123!": true,
+	"password1234": true,
+	"azerty123456": true,
+	"qwerty123456": true,
+	"motdepasse12": true,
+	"123456789abc": true,
+	"p@ssw0rd1234": true,
+	"welcome12345": true,
+	"spacebook123": true,
+	"changeme1234": true,
+}
+
+// normalizeEmail validates a bare address (no display name) and lowercases
+// it so that uniqueness and lookups are case-insensitive.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "", errInvalidEmail
+	}
+
+	local, domain, ok := strings.Cut(address.Address, "@")
+	if !ok || local == "" || !strings.Contains(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", errInvalidEmail
+	}
+
+	return strings.ToLower(address.Address), nil
+}
+
+// normalizeUsername trims the username and checks its length.
+func normalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || utf8.RuneCountInString(username) > maxUsernameLength {
+		return "", errInvalidUsername
+	}
+	return username, nil
+}
+
+// validatePassword enforces the password policy. The failed rules are
+// listed in the error details.
+func validatePassword(password, email, username string) error {
+	var failed []string
+
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		failed = append(failed, "min_length")
+	}
+	if len(password) > maxPasswordBytes {
+		failed = append(failed, "max_length")
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < 3 {
+		failed = append(failed, "character_classes")
+	}
+
+	lowered := strings.ToLower(password)
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	name := strings.ToLower(strings.TrimSpace(username))
+	if (len(local) >= 3 && strings.Contains(lowered, local)) || (len(name) >= 3 && strings.Contains(lowered, name)) {
+		failed = append(failed, "contains_identity")
+	}
+
+	if commonPasswords[lowered] {
+		failed = append(failed, "common_password")
+	}
+
+	if len(failed) > 0 {
+		return errWeakPassword.WithDetails(echo.Map{"failed_rules": failed})
+	}
+	return nil
+}
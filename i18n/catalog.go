@@ -0,0 +1,493 @@
+package i18n
+
+// catalogs maps a locale to its messages, keyed by the stable codes used in
+// error responses and notifications. Every code must exist in each locale.
+var catalogs = map[string]map[string]string{
+	French: {
+		// Generic and HTTP errors
+		"internal_error":      "Erreur interne du serveur",
+		"database_error":      "Erreur de base de données",
+		"http_error":          "Erreur HTTP",
+		"bad_request":         "Requête invalide",
+		"unauthorized":        "Non autorisé",
+		"forbidden":           "Accès refusé",
+		"route_not_found":     "Route introuvable",
+		"method_not_allowed":  "Méthode non autorisée",
+		"payload_too_large":   "Requête trop volumineuse",
+		"too_many_requests":   "Trop de requêtes",
+		"service_unavailable": "Service indisponible",
+		"invalid_body":        "Données invalides",
+
+		// Authentication
+		"authorization_required":  "En-tête d'autorisation requis",
+		"bearer_required":         "Token Bearer requis",
+		"invalid_token":           "Token invalide ou expiré",
+		"invalid_token_claims":    "Données du token invalides",
+		"admin_required":          "Accès administrateur requis",
+		"global_admin_required":   "Accès administrateur global requis",
+		"not_authenticated":       "Utilisateur non authentifié",
+		"invalid_credentials":     "Identifiants invalides",
+		"register_fields_missing": "Email, nom d'utilisateur et mot de passe requis",
+		"login_fields_missing":    "Email et mot de passe requis",
+		"email_taken":             "Cet email est déjà utilisé",
+		"password_hash_failed":    "Échec du hachage du mot de passe",
+		"token_generation_failed": "Échec de la génération du token",
+		"login_locked":            "Trop de tentatives de connexion échouées, réessayez plus tard",
+		"rate_limit_failed":       "Échec de la vérification des limites de connexion",
+		"session_revoked":         "Session révoquée, veuillez vous reconnecter",
+		"user_state_check_failed": "Échec de la vérification de la session",
+
+		// Two-factor authentication
+		"invalid_challenge":          "Défi de connexion invalide ou expiré",
+		"invalid_two_factor_code":    "Code de vérification invalide",
+		"two_factor_required":        "L'authentification à deux facteurs est requise pour les administrateurs",
+		"two_factor_mandatory":       "L'authentification à deux facteurs est obligatoire pour les administrateurs",
+		"two_factor_already_enabled": "L'authentification à deux facteurs est déjà activée",
+		"two_factor_not_enabled":     "L'authentification à deux facteurs n'est pas activée",
+		"two_factor_not_enrolled":    "Aucune inscription à l'authentification à deux facteurs en cours",
+		"two_factor_failed":          "Échec de l'authentification à deux facteurs",
+
+		// Single sign-on
+		"oidc_disabled":             "La connexion SSO n'est pas configurée",
+		"oidc_provider_unavailable": "Le fournisseur d'identité est injoignable",
+		"oidc_state_failed":         "Échec de la préparation de la connexion SSO",
+		"invalid_oidc_state":        "Session de connexion SSO invalide ou expirée",
+		"oidc_login_failed":         "Échec de la connexion SSO",
+		"oidc_email_missing":        "Le fournisseur d'identité n'a pas fourni d'adresse email valide",
+		"oidc_email_unverified":     "Un compte utilise déjà cet email, non vérifié par le fournisseur d'identité",
+
+		// API keys
+		"invalid_api_key":       "Clé d'API invalide, expirée ou révoquée",
+		"api_key_not_allowed":   "Cette route n'est pas accessible avec une clé d'API",
+		"insufficient_scope":    "La clé d'API n'a pas la permission requise",
+		"api_key_check_failed":  "Échec de la vérification de la clé d'API",
+		"api_key_name_required": "Le nom de la clé d'API est requis",
+		"invalid_scope":         "Permissions de clé d'API invalides",
+		"invalid_expiry":        "La date d'expiration doit être dans le futur",
+		"invalid_role":          "Rôle invalide",
+		"not_service_account":   "Les clés d'API sont réservées aux comptes de service",
+		"invalid_api_key_id":    "ID de clé d'API invalide",
+		"api_key_not_found":     "Clé d'API introuvable",
+		"api_key_create_failed": "Échec de la création de la clé d'API",
+		"api_keys_fetch_failed": "Échec de la récupération des clés d'API",
+		"api_key_revoke_failed": "Échec de la révocation de la clé d'API",
+
+		// Users
+		"user_id_required":          "userId est requis",
+		"invalid_user_id":           "ID utilisateur invalide",
+		"other_user_not_allowed":    "Seuls les administrateurs et les comptes de service peuvent consulter les données d'un autre utilisateur",
+		"user_not_found":            "Utilisateur introuvable",
+		"user_lookup_failed":        "Échec de la recherche de l'utilisateur",
+		"user_create_failed":        "Échec de la création de l'utilisateur",
+		"user_update_failed":        "Échec de la mise à jour de l'utilisateur",
+		"user_delete_failed":        "Échec de la suppression de l'utilisateur",
+		"users_fetch_failed":        "Échec de la récupération des utilisateurs",
+		"user_has_reservations":     "L'utilisateur ne peut pas être supprimé car il a des réservations",
+		"invalid_locale":            "Langue non prise en charge",
+		"invalid_email":             "Adresse email invalide",
+		"invalid_username":          "Nom d'utilisateur invalide",
+		"weak_password":             "Le mot de passe doit contenir au moins 10 caractères dont trois types parmi minuscules, majuscules, chiffres et symboles, sans reprendre l'email ou le nom d'utilisateur",
+		"invalid_current_password":  "Mot de passe actuel incorrect",
+		"reauthentication_required": "Confirmez votre identité avec un code de vérification ou en vous reconnectant",
+		"password_reused":           "Le nouveau mot de passe doit être différent de l'actuel",
+		"last_admin":                "Impossible de supprimer le dernier administrateur",
+		"last_admin_demotion":       "Impossible de retirer le rôle du dernier administrateur",
+		"user_not_admin":            "Seuls les administrateurs peuvent être rattachés à des sites",
+		"site_not_found":            "Site introuvable",
+
+		// Resources
+		"resource_not_found":            "Ressource introuvable",
+		"resources_fetch_failed":        "Échec de la récupération des ressources",
+		"resource_create_failed":        "Échec de la création de la ressource",
+		"resource_delete_failed":        "Échec de la suppression de la ressource",
+		"resource_has_reservations":     "La ressource ne peut pas être supprimée car elle a des réservations",
+		"invalid_approval_policy":       "Politique d'approbation invalide",
+		"invalid_buffer":                "Les temps de préparation et de remise en état doivent être compris entre 0 et 1440 minutes",
+		"approvers_required":            "Au moins un approbateur est requis pour une approbation déléguée",
+		"approver_not_found":            "Approbateur introuvable",
+		"approvers_fetch_failed":        "Échec de la récupération des approbateurs",
+		"approval_policy_update_failed": "Échec de la mise à jour de la politique d'approbation",
+		"resource_update_failed":        "Échec de la mise à jour de la ressource",
+
+		// Locations
+		"invalid_location_id":     "ID de lieu invalide",
+		"location_not_found":      "Lieu introuvable",
+		"location_name_required":  "Le nom du lieu est requis",
+		"invalid_location_kind":   "Type de lieu invalide (site, building, floor)",
+		"invalid_location_parent": "Un bâtiment doit être rattaché à un site et un étage à un bâtiment",
+		"invalid_timezone":        "Fuseau horaire invalide",
+		"site_not_allowed":        "Ce site ne fait pas partie de votre périmètre d'administration",
+		"site_scope_check_failed": "Échec de la vérification du périmètre d'administration",
+		"locations_fetch_failed":  "Échec de la récupération des lieux",
+		"location_create_failed":  "Échec de la création du lieu",
+		"location_update_failed":  "Échec de la mise à jour du lieu",
+		"location_delete_failed":  "Échec de la suppression du lieu",
+		"location_in_use":         "Le lieu contient encore des lieux, des ressources ou des administrateurs",
+
+		// Amenities, attributes and photos
+		"invalid_amenity_code":         "Code d'équipement invalide (minuscules, chiffres et _)",
+		"amenity_not_found":            "Équipement introuvable",
+		"amenity_label_required":       "Le libellé de l'équipement est requis",
+		"amenity_exists":               "Cet équipement existe déjà",
+		"amenities_fetch_failed":       "Échec de la récupération des équipements",
+		"amenity_create_failed":        "Échec de la création de l'équipement",
+		"amenity_delete_failed":        "Échec de la suppression de l'équipement",
+		"invalid_attributes":           "Attributs de ressource invalides",
+		"invalid_attribute_definition": "Définition d'attribut invalide",
+		"attribute_not_found":          "Attribut introuvable",
+		"attribute_exists":             "Cet attribut existe déjà pour ce type de ressource",
+		"attributes_fetch_failed":      "Échec de la récupération des attributs",
+		"attribute_create_failed":      "Échec de la création de l'attribut",
+		"attribute_delete_failed":      "Échec de la suppression de l'attribut",
+		"photo_not_found":              "Photo introuvable",
+		"photo_required":               "Le fichier photo est requis (champ photo)",
+		"photo_too_large":              "La photo dépasse la taille maximale autorisée",
+		"unsupported_image":            "Format d'image non pris en charge (JPEG, PNG ou GIF)",
+		"too_many_photos":              "Nombre maximal de photos atteint pour cette ressource",
+		"photos_fetch_failed":          "Échec de la récupération des photos",
+		"thumbnail_failed":             "Échec de la création de la miniature",
+		"photo_store_failed":           "Échec de l'enregistrement de la photo",
+		"photo_read_failed":            "Échec de la lecture de la photo",
+		"photo_delete_failed":          "Échec de la suppression de la photo",
+		"storage_unavailable":          "Stockage des fichiers indisponible",
+
+		// Reservations
+		"invalid_reservation_id":    "ID de réservation invalide",
+		"reservation_not_found":     "Réservation introuvable",
+		"invalid_period":            "La date de début doit être antérieure à la date de fin",
+		"resource_full":             "Ressource complète pour ce créneau horaire",
+		"decision_not_allowed":      "Vous n'êtes pas autorisé à décider de cette réservation",
+		"reservations_fetch_failed": "Échec de la récupération des réservations",
+		"reservations_count_failed": "Échec de la vérification des réservations",
+		"availability_check_failed": "Échec de la vérification de disponibilité",
+		"invalid_quantity":          "La quantité doit être au moins 1",
+		"quantity_exceeds_capacity": "La quantité demandée dépasse la capacité de la ressource",
+		"reservation_create_failed": "Échec de la création de la réservation",
+		"reservation_update_failed": "Échec de la mise à jour de la réservation",
+		"reservation_cancelled":     "Cette réservation a été annulée",
+		"no_show_final":             "Une absence constatée ne peut plus être modifiée",
+
+		// Booking groups
+		"invalid_booking_group_id":         "ID de groupe de réservations invalide",
+		"booking_group_not_found":          "Groupe de réservations introuvable",
+		"group_items_required":             "Le groupe doit réserver au moins une ressource",
+		"too_many_group_items":             "Le groupe réserve trop de ressources",
+		"duplicate_group_item":             "Une ressource apparaît plusieurs fois dans le groupe",
+		"invalid_group_approval_mode":      "Mode d'approbation invalide (group, item)",
+		"group_decision_required":          "Les réservations de ce groupe sont décidées ensemble",
+		"item_decision_required":           "Les réservations de ce groupe sont décidées une par une",
+		"booking_group_not_pending":        "Aucune réservation du groupe n'est à décider",
+		"booking_group_not_cancellable":    "Le groupe ne contient plus de réservation à venir",
+		"booking_group_cancel_not_allowed": "Vous n'êtes pas autorisé à annuler ce groupe",
+		"book_on_behalf_not_allowed":       "Seuls les administrateurs et les comptes de service peuvent réserver pour un autre utilisateur",
+		"booking_groups_fetch_failed":      "Échec de la récupération du groupe de réservations",
+		"booking_group_create_failed":      "Échec de la création du groupe de réservations",
+
+		// Attendees and invitations
+		"invalid_attendee_id":     "ID de participant invalide",
+		"attendee_not_found":      "Participant introuvable",
+		"attendees_required":      "Indiquez au moins un participant (user_ids ou emails)",
+		"too_many_attendees":      "Le nombre de participants dépasse la capacité de la salle",
+		"invalid_seats":           "Le nombre de places ne peut pas être négatif",
+		"not_reservation_owner":   "Seul l'organisateur peut gérer les participants",
+		"invitation_not_found":    "Invitation introuvable",
+		"reservation_closed":      "La réservation est terminée, refusée ou annulée",
+		"attendees_fetch_failed":  "Échec de la récupération des participants",
+		"attendees_update_failed": "Échec de la mise à jour des participants",
+		"calendar_failed":         "Échec de la génération du calendrier",
+
+		// Check-in and no-shows
+		"check_in_not_allowed":   "Seuls l'organisateur et les participants peuvent s'enregistrer",
+		"check_in_not_approved":  "Seule une réservation approuvée peut être enregistrée",
+		"already_checked_in":     "La présence a déjà été enregistrée",
+		"check_in_window_closed": "L'enregistrement n'est pas ouvert pour cette réservation",
+		"invalid_check_in_token": "Code de la salle invalide",
+		"check_in_token_failed":  "Échec de la génération du code de la salle",
+		"no_show_penalty":        "Trop de réservations non honorées récemment : nouvelles réservations bloquées",
+
+		// Priority reservations
+		"invalid_priority":         "La priorité doit être comprise entre 1 et 10",
+		"priority_reason_required": "Le motif de la réservation prioritaire est requis",
+		"priority_conflict":        "Les réservations en conflit ont une priorité égale ou supérieure",
+
+		// Notifications
+		"notifications_fetch_failed": "Échec de la récupération des notifications",
+		"notification_update_failed": "Échec de la mise à jour de la notification",
+		"notification_not_found":     "Notification introuvable",
+		"notification_marked_read":   "Notification marquée comme lue",
+
+		// Audit and statistics
+		"audit_fetch_failed":    "Échec de la récupération du journal d'audit",
+		"invalid_date":          "Date invalide pour le paramètre {param}",
+		"invalid_from":          "Date de début invalide",
+		"invalid_to":            "Date de fin invalide",
+		"invalid_open_from":     "Heure d'ouverture invalide",
+		"invalid_open_to":       "Heure de fermeture invalide",
+		"invalid_opening_hours": "L'heure d'ouverture doit précéder l'heure de fermeture",
+		"invalid_group_by":      "group_by doit valoir resource, type ou category",
+		"stats_failed":          "Échec du calcul des statistiques",
+		"stats_all_resources":   "Toutes les ressources",
+
+		// Notification messages
+		"reservation_requested":             "Nouvelle demande de réservation de {username} pour {resource}",
+		"reservation_auto_approved":         "Votre réservation pour {resource} a été approuvée automatiquement",
+		"reservation_approved":              "Votre réservation a été approuvée",
+		"reservation_rejected":              "Votre réservation a été refusée",
+		"booking_group_approved":            "Votre réservation groupée ({resources}) a été approuvée",
+		"booking_group_rejected":            "Votre réservation groupée ({resources}) a été refusée",
+		"meeting_invitation":                "{organizer} vous invite à une réunion : {resource}, le {start}",
+		"meeting_invitation_withdrawn":      "{organizer} a retiré votre invitation : {resource}, le {start}",
+		"meeting_confirmed":                 "La réunion de {organizer} ({resource}, le {start}) est confirmée",
+		"meeting_cancelled":                 "La réunion de {organizer} ({resource}, le {start}) est annulée",
+		"invitation_accepted":               "{attendee} a accepté votre invitation ({resource}, le {start})",
+		"invitation_declined":               "{attendee} a décliné votre invitation ({resource}, le {start})",
+		"reservation_no_show":               "Votre réservation de {resource} du {start} a été libérée faute d'enregistrement",
+		"reservation_bumped":                "Votre réservation de {resource} du {start} a été annulée par un administrateur ({reason}). Disponibles sur ce créneau : {alternatives}",
+		"reservation_bumped_no_alternative": "Votre réservation de {resource} du {start} a été annulée par un administrateur ({reason})",
+		"resource_created":                  "Une nouvelle ressource a été créée",
+	},
+
+	English: {
+		// Generic and HTTP errors
+		"internal_error":      "Internal server error",
+		"database_error":      "Database error",
+		"http_error":          "HTTP error",
+		"bad_request":         "Bad request",
+		"unauthorized":        "Unauthorized",
+		"forbidden":           "Forbidden",
+		"route_not_found":     "Route not found",
+		"method_not_allowed":  "Method not allowed",
+		"payload_too_large":   "Request entity too large",
+		"too_many_requests":   "Too many requests",
+		"service_unavailable": "Service unavailable",
+		"invalid_body":        "Invalid request body",
+
+		// Authentication
+		"authorization_required":  "Authorization header required",
+		"bearer_required":         "Bearer token required",
+		"invalid_token":           "Invalid or expired token",
+		"invalid_token_claims":    "Invalid token claims",
+		"admin_required":          "Administrator access required",
+		"global_admin_required":   "Global administrator access required",
+		"not_authenticated":       "User not authenticated",
+		"invalid_credentials":     "Invalid credentials",
+		"register_fields_missing": "Email, username and password are required",
+		"login_fields_missing":    "Email and password are required",
+		"email_taken":             "This email is already in use",
+		"password_hash_failed":    "Failed to hash the password",
+		"token_generation_failed": "Failed to generate the token",
+		"login_locked":            "Too many failed login attempts, try again later",
+		"rate_limit_failed":       "Failed to check the login limits",
+		"session_revoked":         "Session revoked, please log in again",
+		"user_state_check_failed": "Failed to check the session",
+
+		// Two-factor authentication
+		"invalid_challenge":          "Invalid or expired login challenge",
+		"invalid_two_factor_code":    "Invalid verification code",
+		"two_factor_required":        "Two-factor authentication is required for administrators",
+		"two_factor_mandatory":       "Two-factor authentication is mandatory for administrators",
+		"two_factor_already_enabled": "Two-factor authentication is already enabled",
+		"two_factor_not_enabled":     "Two-factor authentication is not enabled",
+		"two_factor_not_enrolled":    "No two-factor enrolment in progress",
+		"two_factor_failed":          "Two-factor authentication failed",
+
+		// Single sign-on
+		"oidc_disabled":             "Single sign-on is not configured",
+		"oidc_provider_unavailable": "The identity provider is unreachable",
+		"oidc_state_failed":         "Failed to prepare the single sign-on",
+		"invalid_oidc_state":        "Invalid or expired single sign-on session",
+		"oidc_login_failed":         "Single sign-on failed",
+		"oidc_email_missing":        "The identity provider did not provide a valid email address",
+		"oidc_email_unverified":     "An account already uses this email, which the identity provider has not verified",
+
+		// API keys
+		"invalid_api_key":       "Invalid, expired or revoked API key",
+		"api_key_not_allowed":   "This route cannot be used with an API key",
+		"insufficient_scope":    "The API key lacks the required permission",
+		"api_key_check_failed":  "Failed to check the API key",
+		"api_key_name_required": "The API key name is required",
+		"invalid_scope":         "Invalid API key permissions",
+		"invalid_expiry":        "The expiry date must be in the future",
+		"invalid_role":          "Invalid role",
+		"not_service_account":   "API keys are restricted to service accounts",
+		"invalid_api_key_id":    "Invalid API key ID",
+		"api_key_not_found":     "API key not found",
+		"api_key_create_failed": "Failed to create the API key",
+		"api_keys_fetch_failed": "Failed to fetch API keys",
+		"api_key_revoke_failed": "Failed to revoke the API key",
+
+		// Users
+		"user_id_required":          "userId is required",
+		"invalid_user_id":           "Invalid user ID",
+		"other_user_not_allowed":    "Only administrators and service accounts can read another user's data",
+		"user_not_found":            "User not found",
+		"user_lookup_failed":        "Failed to look up the user",
+		"user_create_failed":        "Failed to create the user",
+		"user_update_failed":        "Failed to update the user",
+		"user_delete_failed":        "Failed to delete the user",
+		"users_fetch_failed":        "Failed to fetch users",
+		"user_has_reservations":     "The user cannot be deleted because they have reservations",
+		"invalid_locale":            "Unsupported language",
+		"invalid_email":             "Invalid email address",
+		"invalid_username":          "Invalid username",
+		"weak_password":             "The password must have at least 10 characters including three of lowercase letters, uppercase letters, digits and symbols, and must not contain the email or username",
+		"invalid_current_password":  "Current password is incorrect",
+		"reauthentication_required": "Confirm your identity with a verification code or by logging in again",
+		"password_reused":           "The new password must differ from the current one",
+		"last_admin":                "The last administrator cannot be deleted",
+		"last_admin_demotion":       "The last administrator cannot lose the role",
+		"user_not_admin":            "Only administrators can be assigned to sites",
+		"site_not_found":            "Site not found",
+
+		// Resources
+		"resource_not_found":            "Resource not found",
+		"resources_fetch_failed":        "Failed to fetch resources",
+		"resource_create_failed":        "Failed to create the resource",
+		"resource_delete_failed":        "Failed to delete the resource",
+		"resource_has_reservations":     "The resource cannot be deleted because it has reservations",
+		"invalid_approval_policy":       "Invalid approval policy",
+		"invalid_buffer":                "Setup and teardown buffers must be between 0 and 1440 minutes",
+		"approvers_required":            "At least one approver is required for delegated approval",
+		"approver_not_found":            "Approver not found",
+		"approvers_fetch_failed":        "Failed to fetch approvers",
+		"approval_policy_update_failed": "Failed to update the approval policy",
+		"resource_update_failed":        "Failed to update the resource",
+
+		// Locations
+		"invalid_location_id":     "Invalid location ID",
+		"location_not_found":      "Location not found",
+		"location_name_required":  "The location name is required",
+		"invalid_location_kind":   "Invalid location kind (site, building, floor)",
+		"invalid_location_parent": "A building must belong to a site and a floor to a building",
+		"invalid_timezone":        "Invalid time zone",
+		"site_not_allowed":        "This site is outside your administration scope",
+		"site_scope_check_failed": "Failed to check the administration scope",
+		"locations_fetch_failed":  "Failed to fetch locations",
+		"location_create_failed":  "Failed to create the location",
+		"location_update_failed":  "Failed to update the location",
+		"location_delete_failed":  "Failed to delete the location",
+		"location_in_use":         "The location still contains locations, resources or administrators",
+
+		// Amenities, attributes and photos
+		"invalid_amenity_code":         "Invalid amenity code (lowercase letters, digits and _)",
+		"amenity_not_found":            "Amenity not found",
+		"amenity_label_required":       "The amenity label is required",
+		"amenity_exists":               "This amenity already exists",
+		"amenities_fetch_failed":       "Failed to fetch amenities",
+		"amenity_create_failed":        "Failed to create the amenity",
+		"amenity_delete_failed":        "Failed to delete the amenity",
+		"invalid_attributes":           "Invalid resource attributes",
+		"invalid_attribute_definition": "Invalid attribute definition",
+		"attribute_not_found":          "Attribute not found",
+		"attribute_exists":             "This attribute already exists for this resource type",
+		"attributes_fetch_failed":      "Failed to fetch attributes",
+		"attribute_create_failed":      "Failed to create the attribute",
+		"attribute_delete_failed":      "Failed to delete the attribute",
+		"photo_not_found":              "Photo not found",
+		"photo_required":               "The photo file is required (photo field)",
+		"photo_too_large":              "The photo exceeds the maximum allowed size",
+		"unsupported_image":            "Unsupported image format (JPEG, PNG or GIF)",
+		"too_many_photos":              "Maximum number of photos reached for this resource",
+		"photos_fetch_failed":          "Failed to fetch photos",
+		"thumbnail_failed":             "Failed to create the thumbnail",
+		"photo_store_failed":           "Failed to save the photo",
+		"photo_read_failed":            "Failed to read the photo",
+		"photo_delete_failed":          "Failed to delete the photo",
+		"storage_unavailable":          "File storage unavailable",
+
+		// Reservations
+		"invalid_reservation_id":    "Invalid reservation ID",
+		"reservation_not_found":     "Reservation not found",
+		"invalid_period":            "The start date must be before the end date",
+		"resource_full":             "The resource is fully booked for this time slot",
+		"decision_not_allowed":      "You are not allowed to decide on this reservation",
+		"reservations_fetch_failed": "Failed to fetch reservations",
+		"reservations_count_failed": "Failed to check reservations",
+		"availability_check_failed": "Failed to check availability",
+		"invalid_quantity":          "The quantity must be at least 1",
+		"quantity_exceeds_capacity": "The requested quantity exceeds the resource capacity",
+		"reservation_create_failed": "Failed to create the reservation",
+		"reservation_update_failed": "Failed to update the reservation",
+		"reservation_cancelled":     "This reservation was cancelled",
+		"no_show_final":             "A recorded no-show can no longer be changed",
+
+		// Booking groups
+		"invalid_booking_group_id":         "Invalid booking group ID",
+		"booking_group_not_found":          "Booking group not found",
+		"group_items_required":             "The group must book at least one resource",
+		"too_many_group_items":             "The group books too many resources",
+		"duplicate_group_item":             "A resource appears more than once in the group",
+		"invalid_group_approval_mode":      "Invalid approval mode (group, item)",
+		"group_decision_required":          "The reservations of this group are decided together",
+		"item_decision_required":           "The reservations of this group are decided one by one",
+		"booking_group_not_pending":        "No reservation of the group awaits a decision",
+		"booking_group_not_cancellable":    "The group has no upcoming reservation left",
+		"booking_group_cancel_not_allowed": "You are not allowed to cancel this group",
+		"book_on_behalf_not_allowed":       "Only admins and service accounts can book for another user",
+		"booking_groups_fetch_failed":      "Failed to fetch the booking group",
+		"booking_group_create_failed":      "Failed to create the booking group",
+
+		// Attendees and invitations
+		"invalid_attendee_id":     "Invalid attendee ID",
+		"attendee_not_found":      "Attendee not found",
+		"attendees_required":      "Give at least one attendee (user_ids or emails)",
+		"too_many_attendees":      "The number of attendees exceeds the room capacity",
+		"invalid_seats":           "The number of seats cannot be negative",
+		"not_reservation_owner":   "Only the organizer can manage attendees",
+		"invitation_not_found":    "Invitation not found",
+		"reservation_closed":      "The reservation is over, rejected or cancelled",
+		"attendees_fetch_failed":  "Failed to fetch attendees",
+		"attendees_update_failed": "Failed to update attendees",
+		"calendar_failed":         "Failed to generate the calendar",
+
+		// Check-in and no-shows
+		"check_in_not_allowed":   "Only the organizer and the attendees can check in",
+		"check_in_not_approved":  "Only an approved reservation can be checked in",
+		"already_checked_in":     "The reservation is already checked in",
+		"check_in_window_closed": "Check-in is not open for this reservation",
+		"invalid_check_in_token": "Invalid room code",
+		"check_in_token_failed":  "Failed to generate the room code",
+		"no_show_penalty":        "Too many recent no-shows: new reservations are blocked",
+
+		// Priority reservations
+		"invalid_priority":         "The priority must be between 1 and 10",
+		"priority_reason_required": "The reason for the priority reservation is required",
+		"priority_conflict":        "The conflicting reservations have an equal or higher priority",
+
+		// Notifications
+		"notifications_fetch_failed": "Failed to fetch notifications",
+		"notification_update_failed": "Failed to update the notification",
+		"notification_not_found":     "Notification not found",
+		"notification_marked_read":   "Notification marked as read",
+
+		// Audit and statistics
+		"audit_fetch_failed":    "Failed to fetch the audit log",
+		"invalid_date":          "Invalid date for parameter {param}",
+		"invalid_from":          "Invalid start date",
+		"invalid_to":            "Invalid end date",
+		"invalid_open_from":     "Invalid opening time",
+		"invalid_open_to":       "Invalid closing time",
+		"invalid_opening_hours": "The opening time must be before the closing time",
+		"invalid_group_by":      "group_by must be resource, type or category",
+		"stats_failed":          "Failed to compute statistics",
+		"stats_all_resources":   "All resources",
+
+		// Notification messages
+		"reservation_requested":             "New reservation request from {username} for {resource}",
+		"reservation_auto_approved":         "Your reservation for {resource} was automatically approved",
+		"reservation_approved":              "Your reservation has been approved",
+		"reservation_rejected":              "Your reservation has been rejected",
+		"booking_group_approved":            "Your group booking ({resources}) has been approved",
+		"booking_group_rejected":            "Your group booking ({resources}) has been rejected",
+		"meeting_invitation":                "{organizer} invites you to a meeting: {resource}, on {start}",
+		"meeting_invitation_withdrawn":      "{organizer} withdrew your invitation: {resource}, on {start}",
+		"meeting_confirmed":                 "The meeting of {organizer} ({resource}, on {start}) is confirmed",
+		"meeting_cancelled":                 "The meeting of {organizer} ({resource}, on {start}) is cancelled",
+		"invitation_accepted":               "{attendee} accepted your invitation ({resource}, on {start})",
+		"invitation_declined":               "{attendee} declined your invitation ({resource}, on {start})",
+		"reservation_no_show":               "Your reservation of {resource} on {start} was released as nobody checked in",
+		"reservation_bumped":                "Your reservation of {resource} on {start} was cancelled by an administrator ({reason}). Available for this slot: {alternatives}",
+		"reservation_bumped_no_alternative": "Your reservation of {resource} on {start} was cancelled by an administrator ({reason})",
+		"resource_created":                  "A new resource has been created",
+	},
+}
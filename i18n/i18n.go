@@ -0,0 +1,160 @@
+// Package i18n renders user-facing messages from stable codes in the
+// caller's language.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	French  = "fr"
+	English = "en"
+
+	// Default is used when no supported language can be negotiated.
+	Default = French
+)
+
+// ContextKey holds the user's preferred locale in the Echo context.
+const ContextKey = "locale"
+
+// Params are the named values substituted in a message ({name}).
+type Params map[string]string
+
+// IsSupported reports whether a catalog exists for the locale.
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Has reports whether the code is known in the default catalog.
+func Has(code string) bool {
+	_, ok := catalogs[Default][code]
+	return ok
+}
+
+// T renders the message for code in the given locale, falling back to the
+// default locale and then to the code itself.
+func T(locale, code string, params Params) string {
+	message, ok := catalogs[locale][code]
+	if !ok {
+		message, ok = catalogs[Default][code]
+	}
+	if !ok {
+		return code
+	}
+	return interpolate(message, params)
+}
+
+func interpolate(message string, params Params) string {
+	if len(params) == 0 {
+		return message
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for key, value := range params {
+		pairs = append(pairs, "{"+key+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(message)
+}
+
+// ParamsFrom converts error details (a map of any values) into Params.
+// Anything else yields nil.
+func ParamsFrom(details interface{}) Params {
+	var values map[string]interface{}
+	switch d := details.(type) {
+	case echo.Map:
+		values = d
+	case map[string]interface{}:
+		values = d
+	case Params:
+		return d
+	case map[string]string:
+		return d
+	default:
+		return nil
+	}
+
+	params := make(Params, len(values))
+	for key, value := range values {
+		params[key] = fmt.Sprint(value)
+	}
+	return params
+}
+
+// Negotiate picks the best supported locale from an Accept-Language header.
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, q := parseLanguage(part)
+		if tag == "" || q <= 0 {
+			continue
+		}
+		// "en-GB" matches the "en" catalog
+		base := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if IsSupported(base) {
+			candidates = append(candidates, candidate{base, q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Default
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].locale
+}
+
+func parseLanguage(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	tag := strings.TrimSpace(fields[0])
+	q := 1.0
+	for _, field := range fields[1:] {
+		field = strings.TrimSpace(field)
+		if value, ok := strings.CutPrefix(field, "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", 0
+			}
+			q = parsed
+		}
+	}
+	if tag == "*" {
+		return Default, q
+	}
+	return tag, q
+}
+
+// Locale returns the locale to answer in: the authenticated user's
+// preference when there is one, else the Accept-Language negotiation.
+func Locale(c echo.Context) string {
+	if locale, ok := c.Get(ContextKey).(string); ok && IsSupported(locale) {
+		return locale
+	}
+	return Negotiate(c.Request().Header.Get("Accept-Language"))
+}
+
+// Message renders code in the locale of the request.
+func Message(c echo.Context, code string, params Params) string {
+	return T(Locale(c), code, params)
+}
+
+// Codes lists the codes of a locale's catalog, sorted.
+func Codes(locale string) []string {
+	codes := make([]string, 0, len(catalogs[locale]))
+	for code := range catalogs[locale] {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -0,0 +1,113 @@
+// Package imaging checks uploaded images and makes their thumbnails with the
+// standard library decoders (JPEG, PNG, GIF).
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// maxPixels refuses images whose decoding would exhaust memory (a small
+// file can declare huge dimensions).
+const maxPixels = 40_000_000
+
+var (
+	ErrUnsupported = errors.New("imaging: unsupported image format")
+	ErrTooLarge    = errors.New("imaging: image dimensions too large")
+)
+
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// Image is a decoded upload.
+type Image struct {
+	image.Image
+	// Format is jpeg, png or gif.
+	Format      string
+	ContentType string
+}
+
+// Decode checks the dimensions announced by data, then decodes it.
+func Decode(data []byte) (Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupported
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return Image{}, ErrUnsupported
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return Image{}, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupported
+	}
+	return Image{Image: img, Format: format, ContentType: contentType}, nil
+}
+
+// Thumbnail scales img down so that its longest side is at most size,
+// averaging the source pixels covered by each thumbnail pixel. Smaller
+// images are returned unchanged.
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw <= size && sh <= size {
+		return img
+	}
+
+	dw, dh := size, sh*size/sw
+	if sh > sw {
+		dw, dh = sw*size/sh, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	src := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, max((dy+1)*sh/dh, dy*sh/dh+1)
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, max((dx+1)*sw/dw, dx*sw/dw+1)
+
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride+x0*4 : y*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			offset := dy*dst.Stride + dx*4
+			for i := range sum {
+				dst.Pix[offset+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// Encode writes img in format (GIF thumbnails are written as PNG) and
+// returns the content type written.
+func Encode(w io.Writer, img image.Image, format string) (string, error) {
+	if format == "jpeg" {
+		return contentTypes["jpeg"], jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return contentTypes["png"], png.Encode(w, img)
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Runner runs periodic background jobs and lets the server wait for them
+// to finish on shutdown.
+type Runner struct {
+	wg sync.WaitGroup
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+// Every runs fn every interval until ctx is cancelled. A run in progress is
+// allowed to complete; errors are logged and do not stop the job.
+func (r *Runner) Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := fn(ctx); err != nil && ctx.Err() == nil {
+					slog.ErrorContext(ctx, "background job failed", "job", name, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Wait blocks until every job has returned or timeout elapses, and reports
+// whether all jobs stopped in time.
+func (r *Runner) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
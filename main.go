@@ -1,11 +1,26 @@
 package main
 
 import (
-	"log"
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"spacebook/apperr"
+	"spacebook/blob"
 	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/jobs"
+	spacebookmw "spacebook/middleware"
+	"spacebook/ratelimit"
 	"spacebook/routes"
+	"spacebook/signing"
+	"spacebook/telemetry"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -14,30 +29,159 @@ import (
 
 func main() {
 	// Load environment variables
-	err := godotenv.Load()
+	if err := godotenv.Load(); err != nil {
+		slog.Info("no .env file found")
+	}
+
+	// Load and validate configuration, refusing to start on invalid settings
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(cfg.Log.Logger())
+
+	// Cancelled on SIGINT/SIGTERM to trigger the graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing, exported to the OTLP collector when one is configured
+	shutdownTracing, err := telemetry.SetupTracing(ctx, cfg.Telemetry.ServiceName, cfg.Telemetry.OTLPEndpoint, cfg.Telemetry.SampleRatio)
 	if err != nil {
-		log.Println("No .env file found")
+		slog.Error("tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	if err := config.Connect(ctx); err != nil {
+		slog.Error("database connection failed", "error", err)
+		os.Exit(1)
 	}
 
-	config.ConnectDatabase()
-	fmt.Println("Connection is successful")
+	// Background workers, stopped with ctx and drained on shutdown
+	runner := jobs.NewRunner()
+
+	// Rate limiting counters, shared between instances with the postgres store
+	if cfg.RateLimit.Store == "postgres" {
+		store := ratelimit.NewPostgresStore(config.DB)
+		ratelimit.Use(store)
+		runner.Every(ctx, "ratelimit-purge", time.Hour, func(ctx context.Context) error {
+			return store.Purge(ctx, cfg.RateLimit.LockoutMax+cfg.RateLimit.FailureWindow)
+		})
+	}
+
+	// Asymmetric token signatures: the keyring creates the first key, then
+	// rotates it on schedule (postgres shares the keys between instances)
+	if cfg.JWT.Asymmetric() {
+		var store signing.Store = signing.NewMemoryStore()
+		if cfg.JWT.KeyStore == "postgres" {
+			store = signing.NewPostgresStore(config.DB)
+		}
+		keyring := signing.NewKeyring(store, signing.Policy{
+			Algorithm:    cfg.JWT.Algorithm,
+			RotateEvery:  cfg.JWT.KeyRotation,
+			PublishAhead: cfg.JWT.KeyPublishAhead,
+			Retain:       max(cfg.JWT.TokenTTL, cfg.TwoFactor.ChallengeTTL),
+		})
+		if err := keyring.Rotate(ctx); err != nil {
+			slog.Error("signing keys unavailable", "error", err)
+			os.Exit(1)
+		}
+		signing.Use(keyring)
+		runner.Every(ctx, "signing-key-rotation", 10*time.Minute, keyring.Rotate)
+	}
+
+	// Reservations nobody checked in to are released for others
+	runner.Every(ctx, "no-show-release", cfg.CheckIn.ReleaseInterval, handlers.ReleaseNoShows)
+
+	// Uploaded files (resource photos)
+	files, err := blob.NewLocalStore(cfg.Storage.LocalDir)
+	if err != nil {
+		slog.Error("file storage unavailable", "dir", cfg.Storage.LocalDir, "error", err)
+		os.Exit(1)
+	}
+	blob.Use(files)
 
 	// Initialize Echo app
 	e := echo.New()
+	e.HideBanner = true
+	e.HTTPErrorHandler = apperr.Write
+	if cfg.TrustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
 
 	// Adding CORS middleware
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     cfg.CORS.AllowOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
 		AllowHeaders:     []string{"Content-Type", "Authorization", "Accept", "Origin"},
+		ExposeHeaders:    []string{echo.HeaderXRequestID, echo.HeaderRetryAfter},
 		AllowCredentials: true,
 	}))
 
+	// Request IDs, logs, metrics/tracing and audit log of mutating requests
+	e.Use(middleware.RequestID())
+	e.Use(spacebookmw.RequestLogger)
+	e.Use(spacebookmw.Timezone)
+	e.Use(spacebookmw.Telemetry)
+	e.Use(spacebookmw.Audit)
+
 	// Setup routes
 	routes.SetupRoutes(e)
 
+	// Prometheus metrics, on their own listener
+	var metrics *echo.Echo
+	if cfg.Telemetry.MetricsAddr != "" {
+		metrics = echo.New()
+		metrics.HideBanner = true
+		metrics.HidePort = true
+		routes.SetupMetricsRoutes(metrics, cfg.Telemetry.MetricsToken)
+	}
+
 	// Start the server
-	err = e.Start(":8000")
-	if err != nil {
-		panic("could not start server")
+	go func() {
+		slog.Info("server starting", "port", cfg.Port, "env", cfg.Env)
+		if err := e.Start(":" + strconv.Itoa(cfg.Port)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("could not start server", "error", err)
+			stop()
+		}
+	}()
+	if metrics != nil {
+		go func() {
+			slog.Info("metrics server starting", "addr", cfg.Telemetry.MetricsAddr)
+			if err := metrics.Start(cfg.Telemetry.MetricsAddr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("could not start metrics server", "error", err)
+				stop()
+			}
+		}()
 	}
+
+	<-ctx.Done()
+	slog.Info("shutting down")
+	handlers.MarkShuttingDown()
+
+	// Drain in-flight requests, then wait for the workers stopped by ctx
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP shutdown", "error", err)
+	}
+	if metrics != nil {
+		if err := metrics.Shutdown(shutdownCtx); err != nil {
+			slog.Error("metrics shutdown", "error", err)
+		}
+	}
+	if !runner.Wait(cfg.ShutdownTimeout) {
+		slog.Warn("background workers did not stop in time")
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("flushing traces", "error", err)
+	}
+	if err := config.CloseDatabase(); err != nil {
+		slog.Error("closing database", "error", err)
+	}
+
+	slog.Info("server stopped")
 }
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// API key scopes. A key only reaches the routes registered with
+// AllowAPIKeys for one of its scopes.
+const (
+	ScopeReservationsRead   = "reservations:read"
+	ScopeReservationsWrite  = "reservations:write"
+	ScopeReservationsReview = "reservations:review"
+	ScopeNotificationsRead  = "notifications:read"
+	// ScopeScheduleRead reads every reservation (room displays); the key's
+	// account must be an admin.
+	ScopeScheduleRead = "schedule:read"
+)
+
+var Scopes = []string{
+	ScopeReservationsRead,
+	ScopeReservationsWrite,
+	ScopeReservationsReview,
+	ScopeNotificationsRead,
+	ScopeScheduleRead,
+}
+
+const (
+	// APIKeyHeader carries a key; "Authorization: Bearer sbk_..." works too.
+	APIKeyHeader = "X-API-Key"
+	apiKeyPrefix = "sbk_"
+	// lastUsedResolution limits last_used_at writes to one per key and minute.
+	lastUsedResolution = time.Minute
+)
+
+var (
+	errInvalidAPIKey     = apperr.Unauthorized("invalid_api_key", "Clé d'API invalide, expirée ou révoquée")
+	errAPIKeyNotAllowed  = apperr.Forbidden("api_key_not_allowed", "Cette route n'est pas accessible avec une clé d'API")
+	errInsufficientScope = apperr.Forbidden("insufficient_scope", "La clé d'API n'a pas la permission requise")
+)
+
+// apiKeyRoutes maps "METHOD /path" to the scope a key needs on the route.
+// Filled by AllowAPIKeys when the routes are set up.
+var apiKeyRoutes = map[string]string{}
+
+// AllowAPIKeys opens routes to API keys holding scope. Routes not
+// registered here refuse keys.
+func AllowAPIKeys(scope string, routes ...*echo.Route) {
+	for _, route := range routes {
+		apiKeyRoutes[route.Method+" "+route.Path] = scope
+	}
+}
+
+func IsScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateAPIKey returns a new key, its public prefix and the hash to store.
+// The key itself is only shown once, at creation.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	raw := make([]byte, 4+24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(raw[:4])
+	key = apiKeyPrefix + prefix + "_" + hex.EncodeToString(raw[4:])
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes a key for storage. Keys are random, so a fast hash is
+// enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyFromRequest returns the API key sent with the request, if any.
+func apiKeyFromRequest(c echo.Context) string {
+	if key := c.Request().Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer "); ok && strings.HasPrefix(token, apiKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// Authenticate accepts a session token (see JWTAuth) or an API key. Both set
+// the same context values, so handlers do not tell them apart; requests
+// made with a key also carry "api_key_id".
+func Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	withJWT := JWTAuth(next)
+
+	return func(c echo.Context) error {
+		key := apiKeyFromRequest(c)
+		if key == "" {
+			return withJWT(c)
+		}
+
+		scope, ok := apiKeyRoutes[c.Request().Method+" "+c.Path()]
+		if !ok {
+			return errAPIKeyNotAllowed
+		}
+
+		apiKey, user, err := lookupAPIKey(c, key)
+		if err != nil {
+			return err
+		}
+		if !apiKey.HasScope(scope) {
+			return errInsufficientScope.WithDetails(echo.Map{"required_scope": scope})
+		}
+
+		touchAPIKey(c, apiKey)
+
+		c.Set("user_id", user.ID)
+		c.Set("email", user.Email)
+		c.Set("role", user.Role)
+		c.Set("api_key_id", apiKey.ID)
+
+		return next(c)
+	}
+}
+
+func lookupAPIKey(c echo.Context, key string) (models.APIKey, models.User, error) {
+	var apiKey models.APIKey
+	var user models.User
+
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	prefix, _, found := strings.Cut(rest, "_")
+	if !ok || !found || prefix == "" {
+		return apiKey, user, errInvalidAPIKey
+	}
+
+	db := config.DB.WithContext(c.Request().Context())
+	if err := db.Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiKey, user, errInvalidAPIKey
+		}
+		return apiKey, user, apperr.Internal("api_key_check_failed", "Échec de la vérification de la clé d'API", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(apiKey.KeyHash)) != 1 || !apiKey.Active(time.Now()) {
+		return apiKey, user, errInvalidAPIKey
+	}
+
+	if err := db.Where("deleted_at IS NULL").First(&user, "id = ?", apiKey.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiKey, user, errInvalidAPIKey
+		}
+		return apiKey, user, apperr.Internal("api_key_check_failed", "Échec de la vérification de la clé d'API", err)
+	}
+
+	return apiKey, user, nil
+}
+
+// touchAPIKey records the key use, at most once per lastUsedResolution.
+// Failing to record it does not fail the request.
+func touchAPIKey(c echo.Context, apiKey models.APIKey) {
+	now := time.Now()
+	if apiKey.LastUsedAt != nil && now.Sub(*apiKey.LastUsedAt) < lastUsedResolution {
+		return
+	}
+
+	err := config.DB.WithContext(c.Request().Context()).Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-lastUsedResolution)).
+		Update("last_used_at", now).Error
+	if err != nil {
+		slog.WarnContext(c.Request().Context(), "api key last use not recorded", "api_key_id", apiKey.ID, "error", err)
+	}
+}
+
+// APIKeyID returns the key a request authenticated with, if any.
+func APIKeyID(c echo.Context) (uuid.UUID, bool) {
+	id, ok := c.Get("api_key_id").(uuid.UUID)
+	return id, ok
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const auditContextKey = "audit_entry"
+
+// AuditEntry describes the business side of a mutating request. Handlers fill
+// it with SetAudit; the Audit middleware completes it with the request data.
+type AuditEntry struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// SetAudit attaches an audit entry to the current request.
+func SetAudit(c echo.Context, entry AuditEntry) {
+	c.Set(auditContextKey, entry)
+}
+
+// Audit appends an audit event for every mutating request once the handler
+// has run, and for read requests whose handler called SetAudit (such as the
+// SSO callback). The actor is read from the claims stored by JWTAuth.
+func Audit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		method := c.Request().Method
+		safe := method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+
+		err := next(c)
+
+		if safe && c.Get(auditContextKey) == nil {
+			return err
+		}
+
+		event := buildAuditEvent(c, err)
+		// Recorded even if the client has gone away in the meantime
+		ctx := context.WithoutCancel(c.Request().Context())
+		if dbErr := config.DB.WithContext(ctx).Create(&event).Error; dbErr != nil {
+			slog.ErrorContext(ctx, "audit: failed to record event",
+				"method", event.Method,
+				"path", event.Path,
+				"request_id", event.RequestID,
+				"error", dbErr,
+			)
+		}
+
+		return err
+	}
+}
+
+func buildAuditEvent(c echo.Context, handlerErr error) models.AuditEvent {
+	entry, _ := c.Get(auditContextKey).(AuditEntry)
+
+	if entry.Action == "" {
+		entry.Action = c.Request().Method + " " + c.Path()
+	}
+	if entry.EntityType == "" {
+		entry.EntityType = entityTypeFromPath(c.Path())
+	}
+	if entry.EntityID == "" {
+		entry.EntityID = c.Param("id")
+	}
+
+	event := requestAuditEvent(c, entry)
+	event.Status = c.Response().Status
+	if handlerErr != nil && !c.Response().Committed {
+		event.Status = apperr.From(handlerErr).Status
+	}
+	return event
+}
+
+// auditPath is the route of the request, its parameters left as placeholders:
+// some are secrets, such as the tokens of invitation links.
+func auditPath(c echo.Context) string {
+	if path := c.Path(); path != "" {
+		return path
+	}
+	return c.Request().URL.Path
+}
+
+// requestAuditEvent is the event of entry made by the request's actor.
+func requestAuditEvent(c echo.Context, entry AuditEntry) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     toJSON(entry.Before),
+		After:      toJSON(entry.After),
+		Method:     c.Request().Method,
+		Path:       auditPath(c),
+		IP:         c.RealIP(),
+		RequestID:  c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+	event.Diff = diffJSON(event.Before, event.After)
+
+	if userID, ok := c.Get("user_id").(uuid.UUID); ok {
+		event.ActorID = &userID
+	}
+	if role, ok := c.Get("role").(string); ok {
+		event.ActorRole = role
+	}
+	if apiKeyID, ok := APIKeyID(c); ok {
+		event.APIKeyID = &apiKeyID
+	}
+
+	return event
+}
+
+// RecordAudit appends, within tx, an audit event for a change a request
+// makes besides the one given to SetAudit (such as the reservations bumped
+// by a priority reservation). It is only kept if tx commits, so its status
+// is the success of the change.
+func RecordAudit(c echo.Context, tx *gorm.DB, entry AuditEntry) error {
+	event := requestAuditEvent(c, entry)
+	event.Status = http.StatusOK
+	return tx.Create(&event).Error
+}
+
+// RecordSystemAudit appends an audit event for a change made by a background
+// job rather than a request; its actor role is "system".
+func RecordSystemAudit(tx *gorm.DB, entry AuditEntry) error {
+	event := models.AuditEvent{
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     toJSON(entry.Before),
+		After:      toJSON(entry.After),
+		ActorRole:  "system",
+	}
+	event.Diff = diffJSON(event.Before, event.After)
+	return tx.Create(&event).Error
+}
+
+// entityTypeFromPath guesses the entity from the route, e.g.
+// "/admin/reservations/:id/approve" -> "reservations".
+func entityTypeFromPath(path string) string {
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" && segment != "admin" && !strings.HasPrefix(segment, ":") {
+			return segment
+		}
+	}
+	return ""
+}
+
+func toJSON(value interface{}) models.JSON {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// diffJSON lists the top-level fields that differ between two JSON objects
+// as {"field": {"from": old, "to": new}}.
+func diffJSON(before, after models.JSON) models.JSON {
+	if before == nil && after == nil {
+		return nil
+	}
+
+	var from, to map[string]interface{}
+	if before != nil {
+		if err := json.Unmarshal(before, &from); err != nil {
+			return nil
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &to); err != nil {
+			return nil
+		}
+	}
+
+	diff := map[string]map[string]interface{}{}
+	for key, oldValue := range from {
+		if newValue, ok := to[key]; !ok || !reflect.DeepEqual(oldValue, newValue) {
+			diff[key] = map[string]interface{}{"from": oldValue, "to": to[key]}
+		}
+	}
+	for key, newValue := range to {
+		if _, ok := from[key]; !ok {
+			diff[key] = map[string]interface{}{"from": nil, "to": newValue}
+		}
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+	return toJSON(diff)
+}
@@ -1,11 +1,16 @@
 package middleware
 
 import (
-	"net/http"
-	"os"
+	"context"
 	"strings"
 	"time"
 
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/i18n"
+	"spacebook/models"
+	"spacebook/signing"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -15,69 +20,228 @@ type JWTClaims struct {
 	UserID uuid.UUID `json:"user_id"`
 	Email  string    `json:"email"`
 	Role   string    `json:"role"`
+	Locale string    `json:"locale,omitempty"`
+	// Timezone is the zone the user reads times in, "" for UTC.
+	Timezone string `json:"tz,omitempty"`
+	// MFA is true when the session was opened with a second factor.
+	MFA bool `json:"mfa,omitempty"`
+	// AuthTime is when the user last proved their identity (password, code
+	// or identity provider); renewed tokens carry it over.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// Version must match the user's token version (see checkUserState).
+	Version int `json:"ver"`
+	// Purpose marks restricted tokens (such as the two-factor login
+	// challenge) that JWTAuth must not accept.
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// PurposeTwoFactor identifies the token exchanged for a session once the
+// second factor is verified.
+const PurposeTwoFactor = "2fa_challenge"
+
+var (
+	errInvalidToken     = apperr.Unauthorized("invalid_token", "Token invalide ou expiré")
+	errInvalidChallenge = apperr.Unauthorized("invalid_challenge", "Défi de connexion invalide ou expiré")
+)
+
 func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "default-secret-change-in-production"
-	}
-	return []byte(secret)
+	return []byte(config.Get().JWT.Secret)
+}
+
+// GenerateToken issues a session token. A session of a user with two-factor
+// enabled is always second-factor verified: Login only issues it after the
+// code, and enrolment requires one.
+func GenerateToken(user models.User) (string, error) {
+	return generateSessionToken(user, user.TOTPEnabled, time.Now())
 }
 
-func GenerateToken(userID uuid.UUID, email, role string) (string, error) {
+// GenerateSSOToken issues a session opened through the identity provider;
+// mfa tells whether the provider checked a second factor.
+func GenerateSSOToken(user models.User, mfa bool) (string, error) {
+	return generateSessionToken(user, mfa || user.TOTPEnabled, time.Now())
+}
+
+// RenewToken issues a new token for the session of c, whose claims reflect
+// an update of the user. The authentication time and a second factor checked
+// by the identity provider are kept: renewing a token does not prove the
+// identity again.
+func RenewToken(c echo.Context, user models.User) (string, error) {
+	authTime, _ := AuthTime(c)
+	mfa, _ := c.Get("mfa").(bool)
+	return generateSessionToken(user, mfa || user.TOTPEnabled, authTime)
+}
+
+// AuthTime returns when the user of a session token last proved their
+// identity; ok is false for other credentials and for tokens that do not
+// tell it.
+func AuthTime(c echo.Context) (time.Time, bool) {
+	authTime, ok := c.Get(AuthTimeContextKey).(time.Time)
+	return authTime, ok
+}
+
+// AuthTimeContextKey holds the AuthTime of the session token.
+const AuthTimeContextKey = "auth_time"
+
+func generateSessionToken(user models.User, mfa bool, authTime time.Time) (string, error) {
 	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:   user.ID,
+		Email:    user.Email,
+		Role:     user.Role,
+		Locale:   user.Locale,
+		Timezone: user.Timezone,
+		MFA:      mfa,
+		Version:  user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.Get().JWT.TokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+	return signToken(claims)
+}
+
+// GenerateChallengeToken issues the short-lived token returned by Login when
+// the password is correct but a second factor is required.
+func GenerateChallengeToken(user models.User) (string, error) {
+	return signToken(JWTClaims{
+		UserID:  user.ID,
+		Purpose: PurposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.Get().TwoFactor.ChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+}
+
+// signToken sets the issuer and audience, then signs with the shared
+// secret or with the active key of the keyring, named by the kid header.
+func signToken(claims JWTClaims) (string, error) {
+	cfg := config.Get().JWT
+	claims.Issuer = cfg.Issuer
+	if cfg.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{cfg.Audience}
+	}
+
+	if !cfg.Asymmetric() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(getJWTSecret())
+	}
+
+	keyring := signing.Current()
+	if keyring == nil {
+		return "", signing.ErrNoSigningKey
+	}
+	key, err := keyring.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// ParseChallengeToken returns the user a two-factor challenge was issued to.
+func ParseChallengeToken(tokenString string) (uuid.UUID, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil || claims.Purpose != PurposeTwoFactor {
+		return uuid.Nil, errInvalidChallenge
+	}
+	return claims.UserID, nil
+}
+
+func parseToken(tokenString string) (*JWTClaims, error) {
+	cfg := config.Get().JWT
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(getJWTSecret())
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})}
+	if cfg.Asymmetric() {
+		options = []jwt.ParserOption{jwt.WithValidMethods([]string{signing.RS256, signing.EdDSA})}
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, verificationKey, options...)
+	if err != nil || !token.Valid {
+		return nil, errInvalidToken
+	}
+
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok {
+		return nil, apperr.Unauthorized("invalid_token_claims", "Données du token invalides")
+	}
+	return claims, nil
+}
+
+// verificationKey returns the shared secret, or the published key named by
+// the kid header. The key must match the algorithm of the token.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if !config.Get().JWT.Asymmetric() {
+		return getJWTSecret(), nil
+	}
+
+	keyring := signing.Current()
+	kid, _ := token.Header["kid"].(string)
+	if keyring == nil || kid == "" {
+		return nil, errInvalidToken
+	}
+
+	key, ok := keyring.Lookup(context.Background(), kid)
+	if !ok || key.Algorithm != token.Method.Alg() {
+		return nil, errInvalidToken
+	}
+	return key.Public(), nil
 }
 
 func JWTAuth(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		authHeader := c.Request().Header.Get("Authorization")
 		if authHeader == "" {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "En-tête d'autorisation requis",
-			})
+			return apperr.Unauthorized("authorization_required", "En-tête d'autorisation requis")
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "Token Bearer requis",
-			})
+			return apperr.Unauthorized("bearer_required", "Token Bearer requis")
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return getJWTSecret(), nil
-		})
-
-		if err != nil || !token.Valid {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "Token invalide ou expiré",
-			})
+		claims, err := parseToken(tokenString)
+		if err != nil {
+			return err
+		}
+		if claims.Purpose != "" {
+			return errInvalidToken
 		}
 
-		claims, ok := token.Claims.(*JWTClaims)
-		if !ok {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "Données du token invalides",
-			})
+		// Deleted users and revoked sessions are refused; the live role
+		// prevails over the one in the token
+		state, err := checkUserState(c.Request().Context(), claims)
+		if err != nil {
+			return err
 		}
 
 		// Store user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
+		c.Set("role", state.Role)
+		if len(state.Sites) > 0 {
+			c.Set("admin_sites", state.Sites)
+		}
+		c.Set("mfa", claims.MFA)
+		if claims.AuthTime != nil {
+			c.Set(AuthTimeContextKey, claims.AuthTime.Time)
+		}
+		if claims.Locale != "" {
+			c.Set(i18n.ContextKey, claims.Locale)
+		}
+		if claims.Timezone != "" {
+			c.Set(TimezoneContextKey, claims.Timezone)
+		}
 
 		return next(c)
 	}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// RequestLogger writes one structured log line per request, tagged with the
+// request ID set by Echo's RequestID middleware.
+func RequestLogger(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+
+		err := next(c)
+		if err != nil {
+			// Render the error now so that the logged status is the real one
+			c.Error(err)
+		}
+
+		req := c.Request()
+		status := c.Response().Status
+
+		attrs := []any{
+			"method", req.Method,
+			"path", req.URL.Path,
+			"route", c.Path(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"bytes", c.Response().Size,
+			"ip", c.RealIP(),
+			"request_id", c.Response().Header().Get(echo.HeaderXRequestID),
+		}
+		if userID, ok := c.Get("user_id").(uuid.UUID); ok {
+			attrs = append(attrs, "user_id", userID.String())
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		slog.Log(req.Context(), level, "request", attrs...)
+
+		return nil
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/ratelimit"
+	"spacebook/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// TooManyRequests sets Retry-After and returns the 429 error for limiter.
+func TooManyRequests(c echo.Context, limiter string, err *apperr.Error, retryAfter time.Duration) error {
+	seconds := ratelimit.RetryAfterSeconds(retryAfter)
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	telemetry.RateLimited.WithLabelValues(limiter).Inc()
+	return err.WithDetails(echo.Map{"retry_after": seconds})
+}
+
+// RateLimit applies the API token bucket, keyed by the authenticated user
+// (set by JWTAuth) or by client IP for anonymous requests. The limiter fails
+// open: a store error is logged and the request goes through.
+func RateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cfg := config.Get().RateLimit
+		if cfg.APIRequestsPerMinute == 0 {
+			return next(c)
+		}
+
+		key := "api:ip:" + c.RealIP()
+		if userID, ok := c.Get("user_id").(uuid.UUID); ok {
+			key = "api:user:" + userID.String()
+		}
+
+		limit := ratelimit.PerMinute(cfg.APIRequestsPerMinute, cfg.APIBurst)
+		decision, err := ratelimit.Current().Allow(c.Request().Context(), key, limit)
+		if err != nil {
+			slog.WarnContext(c.Request().Context(), "rate limiter unavailable", "error", err)
+			return next(c)
+		}
+		if !decision.Allowed {
+			return TooManyRequests(c, "api",
+				apperr.TooManyRequests("too_many_requests", "Trop de requêtes"), decision.RetryAfter)
+		}
+
+		return next(c)
+	}
+}
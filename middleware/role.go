@@ -1,8 +1,10 @@
 package middleware
 
 import (
-	"net/http"
+	"spacebook/apperr"
+	"spacebook/config"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -10,9 +12,33 @@ func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		role, ok := c.Get("role").(string)
 		if !ok || role != "admin" {
-			return c.JSON(http.StatusForbidden, map[string]string{
-				"error": "Accès administrateur requis",
-			})
+			return apperr.Forbidden("admin_required", "Accès administrateur requis")
+		}
+
+		// Admins must have logged in with a second factor when the policy
+		// requires it (enrolment stays reachable under /me/2fa). API keys
+		// are issued by such an admin and have no interactive login.
+		_, viaAPIKey := APIKeyID(c)
+		if mfa, _ := c.Get("mfa").(bool); config.Get().TwoFactor.RequireForAdmins && !mfa && !viaAPIKey {
+			return apperr.Forbidden("two_factor_required", "L'authentification à deux facteurs est requise pour les administrateurs")
+		}
+		return next(c)
+	}
+}
+
+// AdminSites returns the sites an admin is restricted to; restricted is false
+// for global admins (and API keys, issued by them).
+func AdminSites(c echo.Context) (sites []uuid.UUID, restricted bool) {
+	sites, _ = c.Get("admin_sites").([]uuid.UUID)
+	return sites, len(sites) > 0
+}
+
+// GlobalAdminOnly guards, after AdminOnly, the administration that is not
+// scoped by site: users, API keys, audit log, statistics.
+func GlobalAdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, restricted := AdminSites(c); restricted {
+			return apperr.Forbidden("global_admin_required", "Accès administrateur global requis")
 		}
 		return next(c)
 	}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"spacebook/telemetry"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Telemetry opens a server span per request, continuing any trace propagated
+// by the caller, and records the request count and latency per route. The
+// span travels in the request context down to the database queries.
+func Telemetry(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		route := routeLabel(c)
+
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := telemetry.Tracer().Start(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", req.URL.Path),
+				attribute.String("client.address", c.RealIP()),
+			),
+		)
+		defer span.End()
+
+		c.SetRequest(req.WithContext(ctx))
+		start := time.Now()
+
+		err := next(c)
+		if err != nil {
+			// Let Echo render the error now so that the recorded status is the real one
+			c.Error(err)
+		}
+
+		status := c.Response().Status
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if requestID := c.Response().Header().Get(echo.HeaderXRequestID); requestID != "" {
+			span.SetAttributes(attribute.String("http.request.id", requestID))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		labels := []string{req.Method, route, strconv.Itoa(status)}
+		telemetry.HTTPRequests.WithLabelValues(labels...).Inc()
+		telemetry.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+		return nil
+	}
+}
+
+// routeLabel returns the route template of the request, or "unmatched" when
+// no route matched (Echo then reports the raw URL path, which would explode
+// the metrics cardinality).
+func routeLabel(c echo.Context) string {
+	path := c.Path()
+	for _, route := range c.Echo().Routes() {
+		if route.Path == path {
+			return path
+		}
+	}
+	return "unmatched"
+}
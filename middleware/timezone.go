@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"spacebook/apperr"
+	"spacebook/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TimezoneContextKey holds the timezone of the authenticated user.
+const TimezoneContextKey = "timezone"
+
+var errInvalidTimezone = apperr.BadRequest("invalid_timezone", "Fuseau horaire invalide")
+
+// Timezone refuses the requests whose tz query parameter, the zone to
+// render times in, is not an IANA timezone, so that handlers can use it
+// without checking.
+func Timezone(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if name := c.QueryParam("tz"); name != "" && !models.IsValidTimezone(name) {
+			return errInvalidTimezone.WithDetails(echo.Map{"tz": name})
+		}
+		return next(c)
+	}
+}
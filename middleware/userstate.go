@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"spacebook/apperr"
+	"spacebook/config"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserState is what JWTAuth checks on every request: a token is refused
+// once its user is deleted or its version is outdated.
+type UserState struct {
+	Role         string
+	TokenVersion int
+	Deleted      bool
+	// Sites restricts an admin to these sites; empty for global admins.
+	Sites []uuid.UUID
+}
+
+// UserStateLoader returns the live state of a user; found is false when the
+// user no longer exists.
+type UserStateLoader func(ctx context.Context, id uuid.UUID) (state UserState, found bool, err error)
+
+var (
+	errSessionRevoked  = apperr.Unauthorized("session_revoked", "Session révoquée, veuillez vous reconnecter")
+	errUserStateFailed = apperr.Internal("user_state_check_failed", "Échec de la vérification de la session", nil)
+)
+
+var userStates = struct {
+	sync.Mutex
+	load    UserStateLoader
+	entries map[uuid.UUID]userStateEntry
+}{load: loadUserState, entries: map[uuid.UUID]userStateEntry{}}
+
+type userStateEntry struct {
+	state     UserState
+	found     bool
+	expiresAt time.Time
+}
+
+// UseUserStateLoader replaces the loader (tests) and returns the previous
+// one. The cache is emptied.
+func UseUserStateLoader(loader UserStateLoader) UserStateLoader {
+	userStates.Lock()
+	defer userStates.Unlock()
+
+	previous := userStates.load
+	userStates.load = loader
+	userStates.entries = map[uuid.UUID]userStateEntry{}
+	return previous
+}
+
+// ForgetUser drops the cached state of a user after a change revoking its
+// sessions, so that this instance refuses them immediately. Other instances
+// follow within jwt.user_state_cache_ttl.
+func ForgetUser(id uuid.UUID) {
+	userStates.Lock()
+	delete(userStates.entries, id)
+	userStates.Unlock()
+}
+
+// checkUserState refuses the claims of a deleted user or of an outdated
+// token version, and returns the live state.
+func checkUserState(ctx context.Context, claims *JWTClaims) (UserState, error) {
+	state, found, err := cachedUserState(ctx, claims.UserID)
+	if err != nil {
+		return state, errUserStateFailed.Wrap(err)
+	}
+	if !found || state.Deleted || state.TokenVersion != claims.Version {
+		return state, errSessionRevoked
+	}
+	return state, nil
+}
+
+func cachedUserState(ctx context.Context, id uuid.UUID) (UserState, bool, error) {
+	ttl := config.Get().JWT.UserStateCacheTTL
+	now := time.Now()
+
+	userStates.Lock()
+	entry, ok := userStates.entries[id]
+	load := userStates.load
+	userStates.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		return entry.state, entry.found, nil
+	}
+
+	state, found, err := load(ctx, id)
+	if err != nil {
+		return state, false, err
+	}
+
+	if ttl > 0 {
+		userStates.Lock()
+		userStates.entries[id] = userStateEntry{state: state, found: found, expiresAt: now.Add(ttl)}
+		// Keep the cache bounded: expired entries are dropped as it grows
+		if len(userStates.entries) > 10000 {
+			for key, e := range userStates.entries {
+				if now.After(e.expiresAt) {
+					delete(userStates.entries, key)
+				}
+			}
+		}
+		userStates.Unlock()
+	}
+	return state, found, nil
+}
+
+func loadUserState(ctx context.Context, id uuid.UUID) (UserState, bool, error) {
+	var user models.User
+	err := config.DB.WithContext(ctx).
+		Select("role", "token_version", "deleted_at").
+		First(&user, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return UserState{}, false, nil
+	}
+	if err != nil {
+		return UserState{}, false, err
+	}
+
+	state := UserState{
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		Deleted:      user.DeletedAt != nil,
+	}
+	if user.Role == "admin" {
+		if err := config.DB.WithContext(ctx).Model(&models.SiteAdmin{}).
+			Where("user_id = ?", id).
+			Pluck("site_id", &state.Sites).Error; err != nil {
+			return UserState{}, false, err
+		}
+	}
+	return state, true, nil
+}
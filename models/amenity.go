@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Amenity is a feature resources are tagged with and filtered by
+// (projector, whiteboard...). Code is the stable identifier used in
+// requests; Label is shown to users.
+type Amenity struct {
+	ID    uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Code  string    `gorm:"not null;uniqueIndex" json:"code"`
+	Label string    `gorm:"not null" json:"label"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultAmenities are created at migration when missing.
+var DefaultAmenities = []Amenity{
+	{Code: "projector", Label: "Vidéoprojecteur"},
+	{Code: "whiteboard", Label: "Tableau blanc"},
+	{Code: "accessible", Label: "Accessible PMR"},
+	{Code: "video_conferencing", Label: "Visioconférence"},
+}
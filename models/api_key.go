@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey authenticates an integration (room display, script) as its user,
+// usually a service account. Only a SHA-256 hash of the key is stored; the
+// prefix identifies the key without revealing it.
+type APIKey struct {
+	ID     uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Name   string    `gorm:"not null" json:"name"`
+	Prefix string    `gorm:"uniqueIndex;not null" json:"prefix"`
+	// KeyHash is the hex SHA-256 of the full key.
+	KeyHash string    `gorm:"not null" json:"-"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	// Scopes is a space-separated list, as in OAuth.
+	Scopes string `gorm:"not null" json:"scopes"`
+
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	CreatedBy uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (k APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active tells whether the key can still authenticate at t.
+func (k APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invitation statuses of an attendee.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// Attendee is a person invited to the meeting held by a reservation: a
+// registered user, or an external guest known by email only. External
+// guests answer with a token sent to them; only its SHA-256 is stored.
+type Attendee struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+
+	ReservationID uuid.UUID    `gorm:"type:uuid;not null;uniqueIndex:idx_attendee_email" json:"reservation_id"`
+	Reservation   *Reservation `gorm:"foreignKey:ReservationID;references:ID;constraint:OnDelete:CASCADE" json:"reservation,omitempty"`
+
+	UserID *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	User   *User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"-"`
+	Email  string     `gorm:"not null;uniqueIndex:idx_attendee_email" json:"email"`
+	Name   string     `json:"name,omitempty"`
+
+	Status      string     `gorm:"not null;default:pending" json:"status"`
+	TokenHash   string     `gorm:"index" json:"-"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+
+	// Token is the invitation token of an external guest, only returned
+	// when the invitation is created.
+	Token string `gorm:"-" json:"token,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// External reports whether the attendee has no account.
+func (a Attendee) External() bool {
+	return a.UserID == nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Value types of custom resource attributes.
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum" // one of Options
+)
+
+// AttributeDefinition declares a custom attribute of the resources of a
+// type, e.g. "seats" (number) for rooms or "os" (enum) for laptops. Values
+// are kept in Resource.Attributes and checked against the definitions.
+type AttributeDefinition struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	ResourceType string    `gorm:"not null;uniqueIndex:idx_attribute_definitions_type_key" json:"resource_type"`
+	Key          string    `gorm:"not null;uniqueIndex:idx_attribute_definitions_type_key" json:"key"`
+	Label        string    `json:"label"`
+	ValueType    string    `gorm:"not null" json:"value_type"`
+	// Options lists the allowed values of an enum (JSON array of strings).
+	Options  JSON `json:"options,omitempty"`
+	Required bool `json:"required"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func IsValidAttributeType(valueType string) bool {
+	switch valueType {
+	case AttributeString, AttributeNumber, AttributeBoolean, AttributeEnum:
+		return true
+	}
+	return false
+}
+
+// OptionList returns the allowed values of an enum.
+func (d AttributeDefinition) OptionList() []string {
+	var options []string
+	json.Unmarshal(d.Options, &options)
+	return options
+}
+
+// Accepts reports whether a decoded JSON value fits the definition.
+func (d AttributeDefinition) Accepts(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		if d.ValueType == AttributeEnum {
+			for _, option := range d.OptionList() {
+				if option == v {
+					return true
+				}
+			}
+			return false
+		}
+		return d.ValueType == AttributeString
+	case float64:
+		return d.ValueType == AttributeNumber
+	case bool:
+		return d.ValueType == AttributeBoolean
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrAuditAppendOnly = errors.New("audit events are append-only")
+
+// AuditEvent records one mutating request: who did what, on which entity,
+// and how the entity changed.
+type AuditEvent struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+
+	ActorID   *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	ActorRole string     `json:"actor_role,omitempty"`
+	// APIKeyID is set when the actor authenticated with an API key.
+	APIKeyID *uuid.UUID `gorm:"type:uuid;index" json:"api_key_id,omitempty"`
+
+	Action     string `gorm:"index;not null" json:"action"`
+	EntityType string `gorm:"index" json:"entity_type,omitempty"`
+	EntityID   string `gorm:"index" json:"entity_id,omitempty"`
+
+	Before JSON `json:"before,omitempty"`
+	After  JSON `json:"after,omitempty"`
+	Diff   JSON `json:"diff,omitempty"`
+
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+	IP        string `json:"ip"`
+	RequestID string `gorm:"index" json:"request_id,omitempty"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
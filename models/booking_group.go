@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Approval modes of a booking group.
+const (
+	GroupApprovalGroup = "group" // one decision for all the items
+	GroupApprovalItem  = "item"  // each item is decided on its own
+)
+
+// GroupStatusPartial is the status of a group whose items do not all share
+// the same status.
+const GroupStatusPartial = "partial"
+
+// BookingGroup books several resources for the same window (a room, its
+// projector and a video kit). Its items are created all or none.
+type BookingGroup struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+
+	UserID uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	User   User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"-"`
+
+	StartAt      time.Time `json:"start_at"`
+	EndAt        time.Time `json:"end_at"`
+	ApprovalMode string    `gorm:"not null;default:group" json:"approval_mode"`
+
+	Items []Reservation `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"items"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsValidGroupApprovalMode reports whether mode is a known approval mode.
+func IsValidGroupApprovalMode(mode string) bool {
+	return mode == GroupApprovalGroup || mode == GroupApprovalItem
+}
+
+// Status is the status shared by all the items, GroupStatusPartial when
+// they differ.
+func (g BookingGroup) Status() string {
+	if len(g.Items) == 0 {
+		return ""
+	}
+	status := g.Items[0].Status
+	for _, item := range g.Items[1:] {
+		if item.Status != status {
+			return GroupStatusPartial
+		}
+	}
+	return status
+}
+
+// MarshalJSON adds the status of the group.
+func (g BookingGroup) MarshalJSON() ([]byte, error) {
+	type group BookingGroup
+	return json.Marshal(struct {
+		group
+		Status string `json:"status"`
+	}{group(g), g.Status()})
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+	// Zones are embedded so that validation does not depend on the host
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+)
+
+// Location kinds, from the widest to the narrowest: a site contains
+// buildings, which contain floors. Resources are attached to any of them.
+const (
+	LocationSite     = "site"
+	LocationBuilding = "building"
+	LocationFloor    = "floor"
+)
+
+type Location struct {
+	ID       uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Name     string     `gorm:"not null" json:"name"`
+	Kind     string     `gorm:"not null" json:"kind"`
+	ParentID *uuid.UUID `gorm:"type:uuid;index" json:"parent_id,omitempty"`
+	// Timezone is the IANA zone of a site (Europe/Paris); buildings and
+	// floors use the one of their site.
+	Timezone string `json:"timezone,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ParentKind returns the kind of location a location of the given kind is
+// attached to, "" for a site. ok is false for an unknown kind.
+func ParentKind(kind string) (parent string, ok bool) {
+	switch kind {
+	case LocationSite:
+		return "", true
+	case LocationBuilding:
+		return LocationSite, true
+	case LocationFloor:
+		return LocationBuilding, true
+	}
+	return "", false
+}
+
+// IsValidTimezone reports whether name is an IANA time zone. "UTC" is
+// accepted, "" and "Local" are not.
+func IsValidTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// SiteAdmin restricts an admin to the locations, resources and reservations
+// of a site. Admins without any SiteAdmin row manage every site.
+type SiteAdmin struct {
+	UserID uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	User   User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"-"`
+	SiteID uuid.UUID `gorm:"type:uuid;primaryKey" json:"site_id"`
+	Site   Location  `gorm:"foreignKey:SiteID;references:ID;constraint:OnDelete:CASCADE" json:"site"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
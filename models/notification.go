@@ -10,8 +10,16 @@ type Notification struct {
 	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
 
 	UserID *uuid.UUID `gorm:"type:uuid" json:"user_id,omitempty"`
+	// LocationID is the location of the resource an admin notification is
+	// about, which scopes it to the admins of its site.
+	LocationID *uuid.UUID `gorm:"type:uuid;index" json:"location_id,omitempty"`
 
-	Type    string `json:"type"`
+	Type string `json:"type"`
+	// Code and Params identify the message in the i18n catalog so it can be
+	// rendered in the reader's language. Message keeps the French rendering
+	// for notifications created before codes existed.
+	Code    string `json:"code,omitempty"`
+	Params  JSON   `json:"params,omitempty"`
 	Message string `json:"message"`
 	IsRead  bool   `json:"is_read"`
 
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RateLimitBucket is a token bucket of the Postgres rate-limit store.
+type RateLimitBucket struct {
+	Key        string `gorm:"primaryKey"`
+	Tokens     float64
+	RefilledAt time.Time
+}
+
+// LoginFailure counts recent failed logins for an account or an IP.
+type LoginFailure struct {
+	Key           string `gorm:"primaryKey"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
@@ -1,11 +1,31 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Reservation statuses.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	StatusNoShow   = "no_show"
+	// StatusCancelled reservations were withdrawn by their owner and no
+	// longer hold capacity.
+	StatusCancelled = "cancelled"
+	// StatusBumped reservations gave way to a priority reservation made by
+	// an admin (BumpedByID) and no longer hold capacity.
+	StatusBumped = "bumped"
+)
+
+// MaxPriority is the highest priority of a reservation. Those made by users
+// have priority 0; admins give a priority to theirs so that they bump the
+// conflicting reservations of lower priority.
+const MaxPriority = 10
+
 type Reservation struct {
 	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
 
@@ -18,7 +38,59 @@ type Reservation struct {
 	StartAt time.Time `json:"start_at"`
 	EndAt   time.Time `json:"end_at"`
 	Status  string    `json:"status"`
+	// Quantity is the number of units of the resource booked (laptops of a
+	// pool); it never exceeds the resource's Capacity.
+	Quantity int `gorm:"not null;default:1" json:"quantity"`
+	// GroupID is set for the items of a BookingGroup.
+	GroupID *uuid.UUID `gorm:"type:uuid;index" json:"group_id,omitempty"`
+	// CheckedInAt is set when the organizer or an attendee checks in.
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty"`
+	Priority    int        `gorm:"not null;default:0" json:"priority"`
+	BumpedByID  *uuid.UUID `gorm:"type:uuid" json:"bumped_by_id,omitempty"`
+
+	Attendees []Attendee `gorm:"foreignKey:ReservationID" json:"attendees,omitempty"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// PeakQuantity is the most units the reservations hold at the same time
+// during [start, end). Each holds its Quantity from turnaround before its
+// start to turnaround after its end, so that back-to-back reservations of
+// one unit only hold one unit when there is no turnaround.
+func PeakQuantity(reservations []Reservation, turnaround time.Duration, start, end time.Time) int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	events := make([]event, 0, 2*len(reservations))
+	for _, reservation := range reservations {
+		from := reservation.StartAt.Add(-turnaround)
+		if from.Before(start) {
+			from = start
+		}
+		to := reservation.EndAt.Add(turnaround)
+		if to.After(end) {
+			to = end
+		}
+		if from.Before(to) {
+			events = append(events, event{from, reservation.Quantity}, event{to, -reservation.Quantity})
+		}
+	}
+
+	// Periods are half-open: units released at an instant are free for
+	// those taken at the same instant
+	slices.SortFunc(events, func(a, b event) int {
+		if c := a.at.Compare(b.at); c != 0 {
+			return c
+		}
+		return a.delta - b.delta
+	})
+
+	held, peak := 0, 0
+	for _, e := range events {
+		held += e.delta
+		peak = max(peak, held)
+	}
+	return peak
+}
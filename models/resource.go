@@ -1,14 +1,80 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Approval policies for a resource's reservations.
+const (
+	ApprovalAuto      = "auto"      // approved immediately if capacity allows
+	ApprovalManual    = "manual"    // approved by any admin
+	ApprovalDelegated = "delegated" // approved by the resource's designated approvers
+)
 
 type Resource struct {
-	ID          string    `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Name        string    `gorm:"not null"`
-	Type        string    `gorm:"not null"`
-	Category    string    `gorm:"default:none"`
-	Capacity    int
-	Status      string    `gorm:"default:available"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID             string `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name           string `gorm:"not null"`
+	Type           string `gorm:"not null"`
+	Category       string `gorm:"default:none"`
+	Capacity       int
+	Status         string `gorm:"default:available"`
+	ApprovalPolicy string `gorm:"default:manual"`
+
+	// Seats is the number of people a room holds, organiser included; 0
+	// when not limited. Rooms are booked whole (Capacity 1), Seats bounds
+	// their attendees.
+	Seats int
+	// CheckInRequired releases the reservations nobody checked in to as
+	// no-shows. CheckInToken, when set, must be given to check in: it is
+	// printed as a QR code in the room, proving presence.
+	CheckInRequired bool   `gorm:"not null;default:false"`
+	CheckInToken    string `json:"-"`
+
+	// SetupMinutes and TeardownMinutes are kept free before and after each
+	// reservation (cleaning a room, recharging equipment). They count in
+	// the overlap and capacity checks but are not part of the booked time.
+	SetupMinutes    int `gorm:"not null;default:0"`
+	TeardownMinutes int `gorm:"not null;default:0"`
+
+	// LocationID attaches the resource to a site, building or floor.
+	LocationID *uuid.UUID `gorm:"type:uuid;index"`
+	Location   *Location  `gorm:"foreignKey:LocationID;references:ID" json:",omitempty"`
+
+	Description string
+	// Attributes holds the custom attributes defined for the resource's
+	// Type (see AttributeDefinition), as a JSON object.
+	Attributes JSON
+	Amenities  []Amenity       `gorm:"many2many:resource_amenities"`
+	Photos     []ResourcePhoto `gorm:"foreignKey:ResourceID" json:",omitempty"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ResourceApprover designates a user allowed to approve reservations of a
+// resource whose policy is ApprovalDelegated.
+type ResourceApprover struct {
+	ResourceID string    `gorm:"type:uuid;primaryKey" json:"resource_id"`
+	UserID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"user"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MaxBufferMinutes bounds the setup and teardown buffers of a resource.
+const MaxBufferMinutes = 24 * 60
+
+// Turnaround is the time needed between two reservations of the resource:
+// the teardown of the first and the setup of the second.
+func (r Resource) Turnaround() time.Duration {
+	return time.Duration(r.SetupMinutes+r.TeardownMinutes) * time.Minute
+}
+
+func IsValidApprovalPolicy(policy string) bool {
+	switch policy {
+	case ApprovalAuto, ApprovalManual, ApprovalDelegated:
+		return true
+	}
+	return false
 }
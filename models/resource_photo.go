@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResourcePhoto is an image of a resource. The original and its thumbnail
+// are kept in the blob store; the API serves them.
+type ResourcePhoto struct {
+	ID                   uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	ResourceID           string    `gorm:"type:uuid;not null;index" json:"resource_id"`
+	ContentType          string    `gorm:"not null" json:"content_type"`
+	Size                 int64     `json:"size"`
+	Width                int       `json:"width"`
+	Height               int       `json:"height"`
+	ThumbnailContentType string    `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Key is the blob store key of the original image.
+func (p ResourcePhoto) Key() string {
+	return "resources/" + p.ResourceID + "/photos/" + p.ID.String()
+}
+
+// ThumbnailKey is the blob store key of the thumbnail.
+func (p ResourcePhoto) ThumbnailKey() string {
+	return p.Key() + "-thumbnail"
+}
+
+// URL is the API path serving the original image.
+func (p ResourcePhoto) URL() string {
+	return "/resources/" + p.ResourceID + "/photos/" + p.ID.String()
+}
+
+// MarshalJSON adds the URLs of the image and its thumbnail.
+func (p ResourcePhoto) MarshalJSON() ([]byte, error) {
+	type photo ResourcePhoto
+	return json.Marshal(struct {
+		photo
+		URL          string `json:"url"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}{photo(p), p.URL(), p.URL() + "/thumbnail"})
+}
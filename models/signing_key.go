@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SigningKey is a private key signing session tokens, shared by every
+// instance. Its public part is published at /.well-known/jwks.json.
+type SigningKey struct {
+	// ID is the kid written in token headers.
+	ID        string `gorm:"primaryKey" json:"id"`
+	Algorithm string `gorm:"not null" json:"algorithm"`
+	// PrivateKey is PKCS #8 DER.
+	PrivateKey []byte `gorm:"not null" json:"-"`
+	// ActiveFrom is when the key starts signing; it is published before.
+	ActiveFrom time.Time `gorm:"not null;index" json:"active_from"`
+	CreatedAt  time.Time `json:"created_at"`
+}
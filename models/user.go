@@ -7,12 +7,42 @@ import (
 )
 
 type User struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
-	Email     string    `gorm:"unique" json:"email"`
-	Username  string    `json:"username"`
-	Password  []byte    `json:"-"`
-	Role      string    `json:"role"`
+	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Email    string    `gorm:"unique" json:"email"`
+	Username string    `json:"username"`
+	Password []byte    `json:"-"`
+	Role     string    `json:"role"`
+	// Locale is the preferred language (fr, en); empty means negotiated
+	// from Accept-Language.
+	Locale string `json:"locale"`
+	// Timezone is the IANA zone times are shown in (Europe/Paris); empty
+	// means UTC. Times are always stored in UTC.
+	Timezone string `json:"timezone"`
+
+	// Two-factor authentication. The secret is set at enrolment and only
+	// active once a first code is verified. TOTPLastStep blocks code replays.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	TOTPLastStep int64  `json:"-"`
+
+	// OIDCSubject links the account to the identity provider's subject for
+	// single sign-on. Accounts created by SSO have no password.
+	OIDCSubject *string `gorm:"uniqueIndex" json:"-"`
+
+	// ServiceAccount marks accounts created for API keys; they have no
+	// password and cannot log in.
+	ServiceAccount bool `json:"service_account"`
+
+	// TokenVersion is copied into session tokens and incremented to revoke
+	// them all (role or password change).
+	TokenVersion int `gorm:"not null;default:0" json:"-"`
+
+	// NoShows counts the reservations released because nobody checked in.
+	NoShows int `gorm:"not null;default:0" json:"no_shows"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set when users delete their own account while past
+	// reservations still reference it: the account is then anonymised.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
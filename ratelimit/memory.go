@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	tokens     float64
+	refilledAt time.Time
+	limit      Limit
+}
+
+type memoryFailures struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+	window      time.Duration
+}
+
+// MemoryStore keeps the counters in process. Limits are per instance.
+type MemoryStore struct {
+	// Clock returns the current time; tests may replace it.
+	Clock func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	failures  map[string]*memoryFailures
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Clock:    time.Now,
+		buckets:  make(map[string]*memoryBucket),
+		failures: make(map[string]*memoryFailures),
+	}
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, limit Limit) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(limit.Burst), refilledAt: now}
+		s.buckets[key] = bucket
+	}
+
+	var decision Decision
+	bucket.tokens, decision = take(bucket.tokens, bucket.refilledAt, now, limit)
+	bucket.refilledAt = now
+	bucket.limit = limit
+	return decision, nil
+}
+
+func (s *MemoryStore) LockedUntil(_ context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.failures[key]; ok && f.lockedUntil.After(s.Clock()) {
+		return f.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) RecordFailure(_ context.Context, key string, policy LockoutPolicy) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+	if !ok {
+		f = &memoryFailures{}
+		s.failures[key] = f
+	}
+
+	now := s.Clock()
+	f.failures, f.lockedUntil = fail(f.failures, f.lastFailure, now, policy)
+	f.lastFailure = now
+	f.window = policy.Window
+	return f.lockedUntil, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// sweep drops the full buckets and the expired failure counters so that the
+// maps do not grow with every client ever seen. Called with mu held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.refilledAt).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if now.After(f.lockedUntil) && now.Sub(f.lastFailure) > f.window {
+			delete(s.failures, key)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"spacebook/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore keeps the counters in Postgres so that every instance
+// shares them. Rows are locked while updated.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	var decision Decision
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		bucket := models.RateLimitBucket{Key: key, Tokens: float64(limit.Burst), RefilledAt: now}
+
+		if err := lockRow(tx, &bucket, key); err != nil {
+			return err
+		}
+
+		bucket.Tokens, decision = take(bucket.Tokens, bucket.RefilledAt, now, limit)
+		bucket.RefilledAt = now
+		return tx.Save(&bucket).Error
+	})
+	return decision, err
+}
+
+func (s *PostgresStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var row models.LoginFailure
+	err := s.db.WithContext(ctx).First(&row, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if row.LockedUntil.After(time.Now()) {
+		return row.LockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, policy LockoutPolicy) (time.Time, error) {
+	var lockedUntil time.Time
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		row := models.LoginFailure{Key: key}
+		if err := lockRow(tx, &row, key); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		row.Failures, row.LockedUntil = fail(row.Failures, row.LastFailureAt, now, policy)
+		row.LastFailureAt = now
+		lockedUntil = row.LockedUntil
+		return tx.Save(&row).Error
+	})
+	return lockedUntil, err
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Delete(&models.LoginFailure{}, "key = ?", key).Error
+}
+
+// Purge deletes the rows that no longer carry any state.
+func (s *PostgresStore) Purge(ctx context.Context, olderThan time.Duration) error {
+	cutoff := time.Now().Add(-olderThan)
+	db := s.db.WithContext(ctx)
+
+	if err := db.Where("refilled_at < ?", cutoff).Delete(&models.RateLimitBucket{}).Error; err != nil {
+		return err
+	}
+	return db.Where("last_failure_at < ? AND locked_until < ?", cutoff, time.Now()).
+		Delete(&models.LoginFailure{}).Error
+}
+
+// lockRow inserts row if key is new, then loads it FOR UPDATE into row.
+func lockRow(tx *gorm.DB, row interface{}, key string) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(row, "key = ?", key).Error
+}
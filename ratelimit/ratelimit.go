@@ -0,0 +1,103 @@
+// Package ratelimit provides token-bucket rate limiting and exponential
+// lockout after repeated failures, backed by memory or Postgres.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second, holding at
+// most Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute builds a limit allowing n requests per minute.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Allowed bool
+	// RetryAfter is how long to wait for a token when not allowed.
+	RetryAfter time.Duration
+}
+
+// LockoutPolicy locks a key once MaxFailures failures are recorded within
+// Window, for Base doubled on each further failure, up to Max.
+type LockoutPolicy struct {
+	MaxFailures int
+	Base        time.Duration
+	Max         time.Duration
+	Window      time.Duration
+}
+
+// Store keeps buckets and failure counters.
+type Store interface {
+	// Allow takes a token from the bucket identified by key.
+	Allow(ctx context.Context, key string, limit Limit) (Decision, error)
+	// LockedUntil returns the end of the key's lockout, zero if not locked.
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	// RecordFailure counts a failure and returns the resulting lockout end,
+	// zero while the threshold is not reached.
+	RecordFailure(ctx context.Context, key string, policy LockoutPolicy) (time.Time, error)
+	// Reset forgets the failures of key.
+	Reset(ctx context.Context, key string) error
+}
+
+var current Store = NewMemoryStore()
+
+// Use replaces the store used by the application.
+func Use(store Store) {
+	current = store
+}
+
+// Current returns the store used by the application (in memory by default).
+func Current() Store {
+	return current
+}
+
+// take refills a bucket holding tokens at refilledAt, then takes one token
+// if possible. It returns the new token count and the decision.
+func take(tokens float64, refilledAt, now time.Time, limit Limit) (float64, Decision) {
+	if elapsed := now.Sub(refilledAt).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+	}
+
+	if tokens >= 1 {
+		return tokens - 1, Decision{Allowed: true}
+	}
+
+	wait := time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	return tokens, Decision{RetryAfter: wait}
+}
+
+// fail updates a failure counter and returns the new count and lockout end.
+func fail(failures int, lastFailure, now time.Time, policy LockoutPolicy) (int, time.Time) {
+	if now.Sub(lastFailure) > policy.Window {
+		failures = 0
+	}
+	failures++
+
+	if failures < policy.MaxFailures {
+		return failures, time.Time{}
+	}
+	return failures, now.Add(policy.lockout(failures))
+}
+
+func (p LockoutPolicy) lockout(failures int) time.Duration {
+	d := p.Base
+	for i := p.MaxFailures; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds for a Retry-After header.
+func RetryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
@@ -3,18 +3,20 @@ package routes
 import (
 	"spacebook/handlers"
 	"spacebook/middleware"
+	"spacebook/telemetry"
 
 	"github.com/labstack/echo/v4"
 )
 
 func SetupRoutes(e *echo.Echo) {
 
-	// Health check
-	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(200, map[string]string{
-			"status": "API is running",
-		})
-	})
+	// Health checks
+	e.GET("/livez", handlers.Livez)
+	e.GET("/readyz", handlers.Readyz)
+	e.GET("/health", handlers.Readyz)
+
+	// Public keys of the token signatures
+	e.GET("/.well-known/jwks.json", handlers.GetJWKS)
 
 	// =====================
 	// Auth routes (public)
@@ -23,46 +25,156 @@ func SetupRoutes(e *echo.Echo) {
 	auth := e.Group("/auth")
 	auth.POST("/register", handlers.Register)
 	auth.POST("/login", handlers.Login)
+	auth.POST("/2fa", handlers.LoginTwoFactor)
+	auth.GET("/oidc/login", handlers.OIDCLogin)
+	auth.GET("/oidc/callback", handlers.OIDCCallback)
 
 	// =====================
 	// Public routes
 	// =====================
 
-	e.GET("/resources", handlers.GetResources)
+	e.GET("/resources", handlers.GetResources, middleware.RateLimit)
+	e.GET("/resources/availability", handlers.GetResourceAvailability, middleware.RateLimit)
+	e.GET("/resources/:id/photos/:photo_id", handlers.GetResourcePhoto, middleware.RateLimit)
+	e.GET("/resources/:id/photos/:photo_id/thumbnail", handlers.GetResourcePhotoThumbnail, middleware.RateLimit)
+	e.GET("/locations", handlers.GetLocations, middleware.RateLimit)
+	e.GET("/amenities", handlers.GetAmenities, middleware.RateLimit)
+	e.GET("/attributes", handlers.GetAttributeDefinitions, middleware.RateLimit)
+
+	// Invitations of external guests, identified by their token
+	e.GET("/invitations/:token/ics", handlers.GetInvitationCalendar, middleware.RateLimit)
+	e.PUT("/invitations/:token/accept", handlers.AcceptInvitationByToken, middleware.RateLimit)
+	e.PUT("/invitations/:token/decline", handlers.DeclineInvitationByToken, middleware.RateLimit)
 
 	// =====================
 	// Protected routes (authenticated users)
 	// =====================
 
 	protected := e.Group("")
-	protected.Use(middleware.JWTAuth)
-
-	protected.POST("/reservations", handlers.CreateReservation)
-	protected.GET("/reservations", handlers.GetUserReservations)
-	protected.GET("/notifications", handlers.GetUserNotifications)
+	protected.Use(middleware.Authenticate)
+	protected.Use(middleware.RateLimit)
+
+	// Routes also reachable with an API key holding the given scope
+	middleware.AllowAPIKeys(middleware.ScopeReservationsWrite,
+		protected.POST("/reservations", handlers.CreateReservation),
+		protected.POST("/reservations/groups", handlers.CreateBookingGroup),
+		protected.PUT("/reservations/groups/:id/cancel", handlers.CancelBookingGroup),
+		protected.POST("/reservations/:id/check-in", handlers.CheckIn),
+	)
+	middleware.AllowAPIKeys(middleware.ScopeReservationsRead,
+		protected.GET("/reservations", handlers.GetUserReservations),
+		protected.GET("/reservations/groups/:id", handlers.GetBookingGroup),
+		protected.GET("/reservations/:id/ics", handlers.GetReservationCalendar),
+	)
+	middleware.AllowAPIKeys(middleware.ScopeNotificationsRead,
+		protected.GET("/notifications", handlers.GetUserNotifications),
+	)
+
+	// Own account
+	protected.GET("/me", handlers.GetMe)
+	protected.PATCH("/me", handlers.UpdateMe)
+	protected.PUT("/me/password", handlers.ChangePassword)
+	protected.PUT("/me/locale", handlers.UpdateMyLocale)
+	protected.DELETE("/me", handlers.DeleteMe)
+
+	// Meeting attendees and invitations
+	protected.POST("/reservations/:id/attendees", handlers.AddAttendees)
+	protected.DELETE("/reservations/:id/attendees/:attendee_id", handlers.RemoveAttendee)
+	protected.GET("/me/invitations", handlers.GetMyInvitations)
+	protected.PUT("/me/invitations/:id/accept", handlers.AcceptInvitation)
+	protected.PUT("/me/invitations/:id/decline", handlers.DeclineInvitation)
+
+	// Two-factor authentication (reachable by admins before enrolment)
+	protected.POST("/me/2fa/enroll", handlers.EnrollTwoFactor)
+	protected.POST("/me/2fa/verify", handlers.VerifyTwoFactor)
+	protected.POST("/me/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+	protected.POST("/me/2fa/disable", handlers.DisableTwoFactor)
+
+	// Delegated approvers (admin or designated owner, checked by the handlers)
+	middleware.AllowAPIKeys(middleware.ScopeReservationsReview,
+		protected.GET("/reservations/approvals", handlers.GetApproverReservations),
+		protected.PUT("/reservations/:id/approve", handlers.ApproveReservation),
+		protected.PUT("/reservations/:id/reject", handlers.RejectReservation),
+		protected.PUT("/reservations/groups/:id/approve", handlers.ApproveBookingGroup),
+		protected.PUT("/reservations/groups/:id/reject", handlers.RejectBookingGroup),
+	)
 
 	// =====================
 	// Admin routes (authenticated + admin role)
 	// =====================
 
 	admin := e.Group("/admin")
-	admin.Use(middleware.JWTAuth)
+	admin.Use(middleware.Authenticate)
 	admin.Use(middleware.AdminOnly)
+	admin.Use(middleware.RateLimit)
+
+	// Locations (site admins manage those of their sites, checked by the handlers)
+	admin.POST("/locations", handlers.CreateLocation)
+	admin.PUT("/locations/:id", handlers.UpdateLocation)
+	admin.DELETE("/locations/:id", handlers.DeleteLocation)
 
 	// Resources
 	admin.POST("/resources", handlers.CreateResource)
 	admin.DELETE("/resources/:id", handlers.DeleteResource)
+	admin.PUT("/resources/:id/approval", handlers.UpdateApprovalPolicy)
+	admin.PUT("/resources/:id/location", handlers.UpdateResourceLocation)
+	admin.PUT("/resources/:id/details", handlers.UpdateResourceDetails)
+	admin.POST("/resources/:id/photos", handlers.UploadResourcePhoto)
+	admin.DELETE("/resources/:id/photos/:photo_id", handlers.DeleteResourcePhoto)
+	admin.GET("/resources/:id/check-in-token", handlers.GetCheckInToken)
+	admin.POST("/resources/:id/check-in-token", handlers.RotateCheckInToken)
+	admin.DELETE("/resources/:id/check-in-token", handlers.DeleteCheckInToken)
 
 	// Reservations
-	admin.GET("/reservations", handlers.GetAdminReservations)
+	middleware.AllowAPIKeys(middleware.ScopeScheduleRead,
+		admin.GET("/reservations", handlers.GetAdminReservations),
+	)
+	admin.POST("/reservations/priority", handlers.CreatePriorityReservation)
 	admin.PUT("/reservations/:id/approve", handlers.ApproveReservation)
 	admin.PUT("/reservations/:id/reject", handlers.RejectReservation)
+	admin.PUT("/reservations/groups/:id/approve", handlers.ApproveBookingGroup)
+	admin.PUT("/reservations/groups/:id/reject", handlers.RejectBookingGroup)
 
-	// Users
-	admin.GET("/users", handlers.GetUsers)
-	admin.DELETE("/user/:id", handlers.DeleteUser)
-
-	// Notifications
+	// Notifications (site admins see those of their sites)
 	admin.GET("/notifications", handlers.GetAdminNotifications)
 	admin.PUT("/notifications/:id/read", handlers.MarkNotificationAsRead)
+
+	// =====================
+	// Global admin routes (not scoped by site)
+	// =====================
+
+	global := admin.Group("")
+	global.Use(middleware.GlobalAdminOnly)
+
+	// Amenities and custom attributes, shared by all sites
+	global.POST("/amenities", handlers.CreateAmenity)
+	global.DELETE("/amenities/:id", handlers.DeleteAmenity)
+	global.POST("/attributes", handlers.CreateAttributeDefinition)
+	global.DELETE("/attributes/:id", handlers.DeleteAttributeDefinition)
+
+	// API keys and service accounts
+	global.POST("/api-keys", handlers.CreateAPIKey)
+	global.GET("/api-keys", handlers.GetAPIKeys)
+	global.DELETE("/api-keys/:id", handlers.RevokeAPIKey)
+
+	// Users
+	global.GET("/users", handlers.GetUsers)
+	global.DELETE("/user/:id", handlers.DeleteUser)
+	global.PUT("/user/:id/role", handlers.UpdateUserRole)
+	global.PUT("/user/:id/sites", handlers.UpdateAdminSites)
+
+	// Audit log
+	global.GET("/audit", handlers.GetAuditEvents)
+
+	// Usage analytics
+	global.GET("/stats/utilisation", handlers.GetUtilisationStats)
+	global.GET("/stats/heatmap", handlers.GetHeatmapStats)
+	global.GET("/stats/decisions", handlers.GetDecisionStats)
+	global.GET("/stats/top-users", handlers.GetTopUsersStats)
+}
+
+// SetupMetricsRoutes serves the Prometheus metrics, on a listener of their
+// own so that they are not exposed with the API.
+func SetupMetricsRoutes(e *echo.Echo, token string) {
+	e.GET("/metrics", echo.WrapHandler(telemetry.MetricsHandler(token)))
 }
@@ -0,0 +1,85 @@
+// Package schedule holds the timezone rules of the application: instants are
+// stored and compared in UTC, and only converted to a zone to be read by
+// people (the caller's) or to apply wall-clock rules such as opening hours
+// (which follow daylight saving time).
+package schedule
+
+import (
+	"time"
+	// Zones are embedded so that the rules do not depend on the host
+	_ "time/tzdata"
+)
+
+// Layout renders an instant for people, with the abbreviation of its zone.
+// Notifications store their times with it in UTC.
+const Layout = "2006-01-02 15:04 MST"
+
+const dateLayout = "2006-01-02"
+
+// Location returns the zone of an IANA name, UTC for "".
+func Location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// Format renders t in loc with Layout.
+func Format(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(Layout)
+}
+
+// Localize renders in loc a time formatted with Layout; ok is false when
+// value is not such a time.
+func Localize(value string, loc *time.Location) (string, bool) {
+	t, err := time.Parse(Layout, value)
+	// Parse only knows the offset of UTC and of the local zone
+	if err != nil || t.Location() != time.UTC {
+		return value, false
+	}
+	return Format(t, loc), true
+}
+
+// ParseDate reads an RFC 3339 instant, or a date (YYYY-MM-DD) meaning its
+// midnight in loc.
+func ParseDate(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(dateLayout, value, loc)
+}
+
+// OpenDuration sums the overlap between [from, to) and the daily opening
+// hours openFrom-openTo (offsets from midnight on the wall clock of loc),
+// skipping Saturdays and Sundays unless weekends is set. On the days daylight
+// saving time starts or ends, the opening hours keep their wall-clock times.
+func OpenDuration(from, to time.Time, loc *time.Location, openFrom, openTo time.Duration, weekends bool) time.Duration {
+	var total time.Duration
+
+	local := from.In(loc)
+	for day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !weekends && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+			continue
+		}
+
+		open := wallClock(day, openFrom)
+		close := wallClock(day, openTo)
+		if open.Before(from) {
+			open = from
+		}
+		if close.After(to) {
+			close = to
+		}
+		if close.After(open) {
+			total += close.Sub(open)
+		}
+	}
+
+	return total
+}
+
+// wallClock is the instant the wall clock of day's zone shows offset after
+// midnight, which is not day.Add(offset) when the clock changes in between.
+func wallClock(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset/time.Minute), 0, 0, day.Location())
+}
@@ -0,0 +1,48 @@
+package signing
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps the keys in process: they are lost on restart, which
+// invalidates the sessions, and differ between instances.
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]Key
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]Key)}
+}
+
+func (s *MemoryStore) Load(ctx context.Context) ([]Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(), nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, fn func(keys []Key) ([]Key, []string, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	add, remove, err := fn(s.list())
+	if err != nil {
+		return err
+	}
+	for _, key := range add {
+		s.keys[key.ID] = key
+	}
+	for _, id := range remove {
+		delete(s.keys, id)
+	}
+	return nil
+}
+
+func (s *MemoryStore) list() []Key {
+	keys := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
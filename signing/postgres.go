@@ -0,0 +1,96 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+
+	"spacebook/models"
+
+	"gorm.io/gorm"
+)
+
+// rotationLock is the advisory lock serialising the rotations of the
+// instances sharing the database.
+const rotationLock = 0x5350424b // "SPBK"
+
+// PostgresStore shares the keys between instances. Private keys are stored
+// in PKCS #8 DER: access to the table must be restricted like the secret.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Load(ctx context.Context) ([]Key, error) {
+	return load(s.db.WithContext(ctx))
+}
+
+func (s *PostgresStore) Update(ctx context.Context, fn func(keys []Key) ([]Key, []string, error)) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", rotationLock).Error; err != nil {
+			return err
+		}
+
+		keys, err := load(tx)
+		if err != nil {
+			return err
+		}
+
+		add, remove, err := fn(keys)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range add {
+			der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+			if err != nil {
+				return err
+			}
+			row := models.SigningKey{
+				ID:         key.ID,
+				Algorithm:  key.Algorithm,
+				PrivateKey: der,
+				ActiveFrom: key.ActiveFrom,
+				CreatedAt:  key.CreatedAt,
+			}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		if len(remove) > 0 {
+			return tx.Where("id IN ?", remove).Delete(&models.SigningKey{}).Error
+		}
+		return nil
+	})
+}
+
+func load(db *gorm.DB) ([]Key, error) {
+	var rows []models.SigningKey
+	if err := db.Order("active_from").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(rows))
+	for _, row := range rows {
+		private, err := x509.ParsePKCS8PrivateKey(row.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("signing: key %s: %w", row.ID, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("signing: key %s cannot sign", row.ID)
+		}
+		keys = append(keys, Key{
+			ID:         row.ID,
+			Algorithm:  row.Algorithm,
+			Private:    signer,
+			ActiveFrom: row.ActiveFrom,
+			CreatedAt:  row.CreatedAt,
+		})
+	}
+	return keys, nil
+}
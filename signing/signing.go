@@ -0,0 +1,297 @@
+// Package signing manages the asymmetric keys signing session tokens: key
+// generation, scheduled rotation and the JWKS publishing the public keys.
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Supported algorithms, named as in JWT headers.
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+const (
+	rsaBits = 2048
+	// refreshOnMissInterval limits the reloads triggered by unknown kids,
+	// e.g. a key just created by another instance.
+	refreshOnMissInterval = 10 * time.Second
+)
+
+var ErrNoSigningKey = errors.New("signing: no active key")
+
+// Key is a signing key. It is published as soon as it exists and signs from
+// ActiveFrom until a newer key becomes active.
+type Key struct {
+	ID         string
+	Algorithm  string
+	Private    crypto.Signer
+	ActiveFrom time.Time
+	CreatedAt  time.Time
+}
+
+func (k Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// Generate creates a key of the given algorithm with a random kid.
+func Generate(algorithm string, now, activeFrom time.Time) (Key, error) {
+	var private crypto.Signer
+	var err error
+
+	switch algorithm {
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return Key{}, fmt.Errorf("signing: unsupported algorithm %q", algorithm)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		ID:         base64.RawURLEncoding.EncodeToString(id),
+		Algorithm:  algorithm,
+		Private:    private,
+		ActiveFrom: activeFrom,
+		CreatedAt:  now,
+	}, nil
+}
+
+// Store keeps the keys.
+type Store interface {
+	Load(ctx context.Context) ([]Key, error)
+	// Update passes the stored keys to fn and applies the returned changes
+	// atomically: concurrent instances do not rotate twice.
+	Update(ctx context.Context, fn func(keys []Key) (add []Key, remove []string, err error)) error
+}
+
+// Policy drives the rotation.
+type Policy struct {
+	Algorithm string
+	// RotateEvery is the lifetime of a signing key; 0 keeps the first key.
+	RotateEvery time.Duration
+	// PublishAhead is how long a new key is published before it signs, so
+	// that verifiers caching the JWKS know it in time.
+	PublishAhead time.Duration
+	// Retain is how long a superseded key stays published: at least the
+	// lifetime of the tokens it signed.
+	Retain time.Duration
+}
+
+// Keyring caches the keys of a store and applies the rotation policy.
+type Keyring struct {
+	// Clock returns the current time; tests may replace it.
+	Clock func() time.Time
+
+	store  Store
+	policy Policy
+
+	mu          sync.RWMutex
+	keys        []Key
+	lastRefresh time.Time
+}
+
+func NewKeyring(store Store, policy Policy) *Keyring {
+	return &Keyring{Clock: time.Now, store: store, policy: policy}
+}
+
+var current *Keyring
+
+// Use sets the keyring used by the application.
+func Use(keyring *Keyring) {
+	current = keyring
+}
+
+// Current returns the keyring used by the application, nil when tokens
+// are signed with a shared secret.
+func Current() *Keyring {
+	return current
+}
+
+// Rotate creates the first key, or the next one when the current key is
+// due for rotation, and removes the keys no token can still use.
+func (r *Keyring) Rotate(ctx context.Context) error {
+	now := r.Clock()
+	err := r.store.Update(ctx, func(keys []Key) ([]Key, []string, error) {
+		return plan(keys, now, r.policy)
+	})
+	if err != nil {
+		return err
+	}
+	return r.Refresh(ctx)
+}
+
+func plan(keys []Key, now time.Time, policy Policy) ([]Key, []string, error) {
+	sortKeys(keys)
+
+	active := activeIndex(keys, now)
+	var add []Key
+
+	switch {
+	case len(keys) == 0:
+		key, err := Generate(policy.Algorithm, now, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		add = append(add, key)
+
+	case active == len(keys)-1:
+		// No successor yet: prepare one when the active key is due, or as
+		// soon as the configured algorithm has changed
+		key := keys[active]
+		due := policy.RotateEvery > 0 && !now.Before(key.ActiveFrom.Add(policy.RotateEvery-policy.PublishAhead))
+		if due || key.Algorithm != policy.Algorithm {
+			next, err := Generate(policy.Algorithm, now, now.Add(policy.PublishAhead))
+			if err != nil {
+				return nil, nil, err
+			}
+			add = append(add, next)
+		}
+	}
+
+	// A key is superseded when the next one becomes active
+	var remove []string
+	for i := 0; i < active; i++ {
+		if now.Sub(keys[i+1].ActiveFrom) > policy.Retain {
+			remove = append(remove, keys[i].ID)
+		}
+	}
+
+	return add, remove, nil
+}
+
+// Refresh reloads the keys from the store.
+func (r *Keyring) Refresh(ctx context.Context) error {
+	keys, err := r.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	sortKeys(keys)
+
+	r.mu.Lock()
+	r.keys = keys
+	r.lastRefresh = r.Clock()
+	r.mu.Unlock()
+	return nil
+}
+
+// SigningKey returns the key to sign with now.
+func (r *Keyring) SigningKey() (Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := activeIndex(r.keys, r.Clock()); i >= 0 {
+		return r.keys[i], nil
+	}
+	return Key{}, ErrNoSigningKey
+}
+
+// Lookup returns the published key identified by kid, reloading the store
+// once in a while when the kid is unknown.
+func (r *Keyring) Lookup(ctx context.Context, kid string) (Key, bool) {
+	if key, ok := r.find(kid); ok {
+		return key, true
+	}
+
+	r.mu.RLock()
+	stale := r.Clock().Sub(r.lastRefresh) >= refreshOnMissInterval
+	r.mu.RUnlock()
+	if !stale || r.Refresh(ctx) != nil {
+		return Key{}, false
+	}
+	return r.find(kid)
+}
+
+func (r *Keyring) find(kid string) (Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// sortKeys orders keys by activation, oldest first.
+func sortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ActiveFrom.Before(keys[j].ActiveFrom)
+	})
+}
+
+// activeIndex returns the index of the newest key active at now, or -1.
+func activeIndex(keys []Key, now time.Time) int {
+	active := -1
+	for i, key := range keys {
+		if !key.ActiveFrom.After(now) {
+			active = i
+		}
+	}
+	return active
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 (RFC 8037)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every published key, including those not active yet.
+func (r *Keyring) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(r.keys))}
+	for _, key := range r.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+
+		switch public := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
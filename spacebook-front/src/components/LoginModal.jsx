@@ -29,7 +29,7 @@ export default function LoginModal({ onClose, onSwitchToRegister }) {
         navigate("/admin/resources/create");
       }
     } catch (err) {
-      setError(err.response?.data?.error || "Erreur de connexion");
+      setError(err.response?.data?.message || "Erreur de connexion");
     } finally {
       setLoading(false);
     }
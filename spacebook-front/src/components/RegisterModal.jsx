@@ -23,7 +23,7 @@ export default function RegisterModal({ onClose, onSwitchToLogin }) {
       login(response.data.user, response.data.token);
       onClose();
     } catch (err) {
-      setError(err.response?.data?.error || "Erreur lors de l'inscription");
+      setError(err.response?.data?.message || "Erreur lors de l'inscription");
     } finally {
       setLoading(false);
     }
@@ -23,7 +23,7 @@ export default function AdminCreateResource() {
       setSuccess(true);
       setTimeout(() => navigate("/admin/resources"), 1500);
     } catch (err) {
-      setError(err.response?.data?.error || "Erreur lors de la creation");
+      setError(err.response?.data?.message || "Erreur lors de la creation");
     }
   };
 
@@ -48,7 +48,7 @@ export default function AdminReservations() {
       await approveReservation(id);
       load();
     } catch (err) {
-      alert(err.response?.data?.error || "Erreur lors de l'approbation");
+      alert(err.response?.data?.message || "Erreur lors de l'approbation");
     }
   };
 
@@ -57,7 +57,7 @@ export default function AdminReservations() {
       await rejectReservation(id);
       load();
     } catch (err) {
-      alert(err.response?.data?.error || "Erreur lors du refus");
+      alert(err.response?.data?.message || "Erreur lors du refus");
     }
   };
 
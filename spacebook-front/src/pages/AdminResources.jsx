@@ -28,7 +28,7 @@ export default function AdminResources() {
       await deleteAdminResource(resourceId);
       load();
     } catch (err) {
-      alert(err.response?.data?.error || "Echec de la suppression");
+      alert(err.response?.data?.message || "Echec de la suppression");
     }
   };
 
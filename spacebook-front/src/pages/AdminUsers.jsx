@@ -35,7 +35,7 @@ export default function AdminUsers() {
       await deleteAdminUser(userId);
       load();
     } catch (err) {
-      alert(err.response?.data?.error || "Erreur lors de la suppression");
+      alert(err.response?.data?.message || "Erreur lors de la suppression");
     }
   };
 
@@ -37,7 +37,7 @@ export default function Reservations() {
       setSuccess(true);
       setTimeout(() => navigate("/mes-reservations"), 1500);
     } catch (err) {
-      setError(err.response?.data?.error || "Erreur lors de la reservation");
+      setError(err.response?.data?.message || "Erreur lors de la reservation");
     }
   };
 
@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const startedAtKey = "telemetry:started_at"
+
+// GormPlugin times every query into DBQueryDuration and records it as a span,
+// child of the span carried by the statement context (see DB.WithContext).
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "spacebook:telemetry"
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+	name := p.Name()
+	cb := db.Callback()
+
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register(name+":before_create", before("create")),
+		cb.Create().After("gorm:create").Register(name+":after_create", after("create")),
+		cb.Query().Before("gorm:query").Register(name+":before_query", before("query")),
+		cb.Query().After("gorm:query").Register(name+":after_query", after("query")),
+		cb.Update().Before("gorm:update").Register(name+":before_update", before("update")),
+		cb.Update().After("gorm:update").Register(name+":after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register(name+":before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register(name+":after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register(name+":before_row", before("row")),
+		cb.Row().After("gorm:row").Register(name+":after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register(name+":before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register(name+":after_raw", after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, _ := Tracer().Start(db.Statement.Context, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "postgresql")),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(startedAtKey, time.Now())
+	}
+}
+
+func after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		table := db.Statement.Table
+		if table == "" {
+			table = "raw"
+		}
+
+		if startedAt, ok := db.InstanceGet(startedAtKey); ok {
+			DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(startedAt.(time.Time)).Seconds())
+		}
+
+		span := trace.SpanFromContext(db.Statement.Context)
+		span.SetAttributes(
+			attribute.String("db.sql.table", table),
+			attribute.String("db.statement", db.Statement.SQL.String()),
+			attribute.Int64("db.rows_affected", db.RowsAffected),
+		)
+		if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+			span.RecordError(db.Error)
+			span.SetStatus(codes.Error, db.Error.Error())
+		}
+		span.End()
+	}
+}
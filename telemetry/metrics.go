@@ -0,0 +1,103 @@
+package telemetry
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every SpaceBook metric, exposed on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spacebook_http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spacebook_http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	ReservationsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spacebook_reservations_created_total",
+		Help: "Reservations created, by initial status.",
+	}, []string{"status"})
+
+	ReservationDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spacebook_reservation_decisions_total",
+		Help: "Reservations approved or rejected.",
+	}, []string{"decision"})
+
+	CapacityConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spacebook_capacity_conflicts_total",
+		Help: "Reservation attempts refused because the resource was full.",
+	})
+
+	NoShows = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spacebook_no_shows_total",
+		Help: "Reservations released because nobody checked in.",
+	})
+
+	ReservationsBumped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spacebook_reservations_bumped_total",
+		Help: "Reservations bumped by an admin priority reservation.",
+	})
+
+	LoginsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spacebook_logins_failed_total",
+		Help: "Failed login attempts.",
+	})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spacebook_rate_limited_total",
+		Help: "Requests refused with 429, by limiter (api, login, lockout).",
+	}, []string{"limiter"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spacebook_db_query_duration_seconds",
+		Help:    "Database query latency by operation and table.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		ReservationsCreated,
+		ReservationDecisions,
+		CapacityConflicts,
+		NoShows,
+		ReservationsBumped,
+		LoginsFailed,
+		RateLimited,
+		DBQueryDuration,
+	)
+}
+
+// MetricsHandler serves the registry in the Prometheus exposition format.
+// When token is set, scrapers must send it as a bearer token.
+func MetricsHandler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAccount(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("Correct-Horse-42"), bcrypt.DefaultCost)
+	user := models.User{
+		ID:       uuid.New(),
+		Email:    "accounttest@test.com",
+		Username: "accounttest",
+		Password: hashedPassword,
+		Role:     "user",
+	}
+	config.DB.Create(&user)
+
+	resource := createTestResource(t, 1)
+
+	defer func() {
+		config.DB.Where("user_id = ?", user.ID).Delete(&models.Reservation{})
+		config.DB.Where("id = ?", resource.ID).Delete(&models.Resource{})
+		config.DB.Where("id = ?", user.ID).Delete(&models.User{})
+	}()
+
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
+		c.Set("role", user.Role)
+
+		switch {
+		case method == http.MethodPatch:
+			call(c, handlers.UpdateMe)
+		case method == http.MethodPut:
+			call(c, handlers.ChangePassword)
+		case method == http.MethodDelete:
+			call(c, handlers.DeleteMe)
+		default:
+			call(c, handlers.GetMe)
+		}
+		return rec
+	}
+
+	t.Run("change password requires the current one", func(t *testing.T) {
+		rec := send(http.MethodPut, "/me/password", map[string]string{
+			"current_password": "wrong",
+			"new_password":     "Another-Horse-43",
+		})
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+		}
+
+		rec = send(http.MethodPut, "/me/password", map[string]string{
+			"current_password": "Correct-Horse-42",
+			"new_password":     "short",
+		})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for a weak password, got %d", http.StatusBadRequest, rec.Code)
+		}
+
+		rec = send(http.MethodPut, "/me/password", map[string]string{
+			"current_password": "Correct-Horse-42",
+			"new_password":     "Another-Horse-43",
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var updated models.User
+		config.DB.First(&updated, "id = ?", user.ID)
+		if bcrypt.CompareHashAndPassword(updated.Password, []byte("Another-Horse-43")) != nil {
+			t.Error("Expected the new password to be stored")
+		}
+		if updated.TokenVersion != user.TokenVersion+1 {
+			t.Error("Expected the other sessions to be revoked")
+		}
+	})
+
+	t.Run("update profile", func(t *testing.T) {
+		rec := send(http.MethodPatch, "/me", map[string]string{
+			"email": "AccountTest2@Test.com",
+		})
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected an email change without password to be refused, got %d", rec.Code)
+		}
+
+		rec = send(http.MethodPatch, "/me", map[string]string{
+			"username":         "  renamed  ",
+			"email":            "AccountTest2@Test.com",
+			"current_password": "Another-Horse-43",
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var response handlers.AuthResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if response.User.Email != "accounttest2@test.com" || response.User.Username != "renamed" {
+			t.Errorf("Unexpected profile after update: %+v", response.User)
+		}
+		if response.Token == "" {
+			t.Error("Expected a new token")
+		}
+	})
+
+	t.Run("self-deletion anonymises an account with past reservations", func(t *testing.T) {
+		past := models.Reservation{
+			ID:         uuid.New(),
+			UserID:     user.ID,
+			ResourceID: uuid.MustParse(resource.ID),
+			StartAt:    time.Now().Add(-48 * time.Hour),
+			EndAt:      time.Now().Add(-47 * time.Hour),
+			Status:     models.StatusApproved,
+		}
+		upcoming := models.Reservation{
+			ID:         uuid.New(),
+			UserID:     user.ID,
+			ResourceID: uuid.MustParse(resource.ID),
+			StartAt:    time.Now().Add(24 * time.Hour),
+			EndAt:      time.Now().Add(25 * time.Hour),
+			Status:     models.StatusPending,
+		}
+		config.DB.Create(&past)
+		config.DB.Create(&upcoming)
+
+		rec := send(http.MethodDelete, "/me", map[string]string{"password": "wrong"})
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+		}
+
+		rec = send(http.MethodDelete, "/me", map[string]string{"password": "Another-Horse-43"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var cancelled models.Reservation
+		config.DB.First(&cancelled, "id = ?", upcoming.ID)
+		if cancelled.Status != models.StatusCancelled {
+			t.Errorf("Expected the upcoming reservation to be cancelled, got %q", cancelled.Status)
+		}
+		var count int64
+		config.DB.Model(&models.Reservation{}).Where("id = ?", past.ID).Count(&count)
+		if count != 1 {
+			t.Error("Expected the past reservation to be kept")
+		}
+
+		var deleted models.User
+		config.DB.First(&deleted, "id = ?", user.ID)
+		if deleted.DeletedAt == nil || deleted.Username != "" || len(deleted.Password) != 0 {
+			t.Errorf("Expected the account to be anonymised, got %+v", deleted)
+		}
+
+		if rec := send(http.MethodGet, "/me", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected the deleted account to be gone, got %d", rec.Code)
+		}
+	})
+
+	t.Run("accounts without password confirm with a recent login", func(t *testing.T) {
+		subject := "sso-" + uuid.NewString()
+		sso := models.User{
+			ID:          uuid.New(),
+			Email:       "accountsso@test.com",
+			Username:    "accountsso",
+			Role:        "user",
+			OIDCSubject: &subject,
+		}
+		config.DB.Create(&sso)
+		defer config.DB.Where("id = ?", sso.ID).Delete(&models.User{})
+
+		deleteMe := func(authTime time.Time) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodDelete, "/me", bytes.NewReader([]byte(`{}`)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user_id", sso.ID)
+			c.Set("role", sso.Role)
+			c.Set(middleware.AuthTimeContextKey, authTime)
+
+			call(c, handlers.DeleteMe)
+			return rec
+		}
+
+		rec := deleteMe(time.Now().Add(-time.Hour))
+		if rec.Code != http.StatusForbidden || !bytes.Contains(rec.Body.Bytes(), []byte("reauthentication_required")) {
+			t.Errorf("Expected a stale session to be asked to log in again, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		if rec := deleteMe(time.Now().Add(-time.Minute)); rec.Code != http.StatusOK {
+			t.Errorf("Expected a recent login to confirm the deletion, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestResourceAttributes(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	ram := models.AttributeDefinition{ResourceType: "test-laptop", Key: "ram_gb", ValueType: models.AttributeNumber, Required: true}
+	options, _ := json.Marshal([]string{"linux", "windows"})
+	system := models.AttributeDefinition{ResourceType: "test-laptop", Key: "os", ValueType: models.AttributeEnum, Options: options}
+	config.DB.Create(&ram)
+	config.DB.Create(&system)
+
+	var projector models.Amenity
+	if err := config.DB.FirstOrCreate(&projector, models.Amenity{Code: "projector", Label: "Vidéoprojecteur"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		config.DB.Exec("DELETE FROM resource_amenities WHERE resource_id IN (SELECT id FROM resources WHERE type = ?)", "test-laptop")
+		config.DB.Where("type = ?", "test-laptop").Delete(&models.Resource{})
+		config.DB.Where("resource_type = ?", "test-laptop").Delete(&models.AttributeDefinition{})
+	}()
+
+	create := func(payload map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/admin/resources", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("role", "admin")
+		call(c, handlers.CreateResource)
+		return rec
+	}
+
+	t.Run("attributes checked against their definitions", func(t *testing.T) {
+		cases := []map[string]interface{}{
+			{"ram_gb": "sixteen"},
+			{"os": "linux"},
+			{"ram_gb": 16, "os": "macos"},
+			{"ram_gb": 16, "colour": "grey"},
+		}
+		for _, attributes := range cases {
+			rec := create(map[string]interface{}{"name": "Laptop", "type": "test-laptop", "capacity": 1, "attributes": attributes})
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_attributes") {
+				t.Errorf("Expected %v to be refused, got %d: %s", attributes, rec.Code, rec.Body.String())
+			}
+		}
+	})
+
+	t.Run("filter by amenities", func(t *testing.T) {
+		rec := create(map[string]interface{}{
+			"name": "Laptop A", "type": "test-laptop", "capacity": 2,
+			"description": "Portable 14 pouces",
+			"attributes":  map[string]interface{}{"ram_gb": 16, "os": "linux"},
+			"amenities":   []string{"projector"},
+		})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		create(map[string]interface{}{"name": "Laptop B", "type": "test-laptop", "capacity": 2, "attributes": map[string]interface{}{"ram_gb": 8}})
+
+		if rec := create(map[string]interface{}{"name": "Laptop C", "type": "test-laptop", "attributes": map[string]interface{}{"ram_gb": 8}, "amenities": []string{"teleporter"}}); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected an unknown amenity to be refused, got %d", rec.Code)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/resources?type=test-laptop&amenities=projector", nil)
+		rec = httptest.NewRecorder()
+		call(e.NewContext(req, rec), handlers.GetResources)
+
+		var resources []models.Resource
+		json.Unmarshal(rec.Body.Bytes(), &resources)
+		if len(resources) != 1 || resources[0].Name != "Laptop A" || len(resources[0].Amenities) != 1 || resources[0].Description == "" {
+			t.Errorf("Expected only Laptop A, got %s", rec.Body.String())
+		}
+	})
+}
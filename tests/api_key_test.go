@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// newAPIKeyEcho serves a probe route echoing the authenticated identity,
+// open to keys with the reservations:read scope, and one closed to keys.
+func newAPIKeyEcho() *echo.Echo {
+	e := newTestEcho()
+	whoami := func(c echo.Context) error {
+		_, viaKey := middleware.APIKeyID(c)
+		return c.JSON(http.StatusOK, echo.Map{
+			"user_id": c.Get("user_id"),
+			"role":    c.Get("role"),
+			"api_key": viaKey,
+		})
+	}
+	middleware.AllowAPIKeys(middleware.ScopeReservationsRead,
+		e.GET("/probe/keys", whoami, middleware.Authenticate),
+	)
+	e.GET("/probe/sessions", whoami, middleware.Authenticate)
+	e.GET("/probe/admin", whoami, middleware.Authenticate, middleware.AdminOnly)
+	middleware.AllowAPIKeys(middleware.ScopeScheduleRead,
+		e.GET("/probe/schedule", whoami, middleware.Authenticate, middleware.AdminOnly),
+	)
+	return e
+}
+
+func probe(e *echo.Echo, path string, header, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIKeyRouting(t *testing.T) {
+	e := newAPIKeyEcho()
+
+	t.Run("session tokens still accepted", func(t *testing.T) {
+		user := models.User{ID: uuid.New(), Email: "session@test.com", Role: "user"}
+		stubUserStates(t, user)
+		token, _ := middleware.GenerateToken(user)
+
+		rec := probe(e, "/probe/sessions", "Authorization", "Bearer "+token)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), user.ID.String()) {
+			t.Errorf("Expected the session to be accepted, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("routes closed to keys by default", func(t *testing.T) {
+		rec := probe(e, "/probe/sessions", middleware.APIKeyHeader, "sbk_0000_0000")
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "api_key_not_allowed") {
+			t.Errorf("Expected api_key_not_allowed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("malformed key", func(t *testing.T) {
+		rec := probe(e, "/probe/keys", "Authorization", "Bearer sbk_malformed")
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "invalid_api_key") {
+			t.Errorf("Expected invalid_api_key, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("key format", func(t *testing.T) {
+		key, prefix, hash, err := middleware.GenerateAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(key, "sbk_"+prefix+"_") || hash != middleware.HashAPIKey(key) || strings.Contains(hash, key) {
+			t.Errorf("Unexpected key %q, prefix %q, hash %q", key, prefix, hash)
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	setupTestDB()
+
+	e := newAPIKeyEcho()
+	admin := models.User{ID: uuid.New(), Email: "apikey-admin@test.com", Username: "apikey-admin", Role: "admin"}
+	config.DB.Create(&admin)
+
+	var created []handlers.CreateAPIKeyResponse
+	defer func() {
+		for _, resp := range created {
+			config.DB.Delete(&models.APIKey{}, "id = ?", resp.APIKey.ID)
+			config.DB.Delete(&models.User{}, "id = ?", resp.User.ID)
+		}
+		config.DB.Delete(&models.User{}, "id = ?", admin.ID)
+	}()
+
+	create := func(payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/admin/api-keys", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", admin.ID)
+		c.Set("role", admin.Role)
+		call(c, handlers.CreateAPIKey)
+
+		if rec.Code == http.StatusCreated {
+			var resp handlers.CreateAPIKeyResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			created = append(created, resp)
+		}
+		return rec
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		if rec := create(map[string]interface{}{"name": "display", "scopes": []string{"everything"}}); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected an unknown scope to be refused, got %d", rec.Code)
+		}
+		if rec := create(map[string]interface{}{"name": "display", "scopes": []string{}}); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected a key without scope to be refused, got %d", rec.Code)
+		}
+		past := time.Now().Add(-time.Hour)
+		if rec := create(map[string]interface{}{"name": "display", "scopes": []string{"reservations:read"}, "expires_at": past}); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected a past expiry to be refused, got %d", rec.Code)
+		}
+		if rec := create(map[string]interface{}{"name": "display", "scopes": []string{"reservations:read"}, "user_id": admin.ID}); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected a key for a person to be refused, got %d", rec.Code)
+		}
+	})
+
+	t.Run("authenticates as the service account", func(t *testing.T) {
+		rec := create(map[string]interface{}{"name": "Hall display", "scopes": []string{"reservations:read"}})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		resp := created[len(created)-1]
+		if !resp.User.ServiceAccount || resp.User.Role != "user" || strings.Contains(rec.Body.String(), resp.APIKey.KeyHash) {
+			t.Errorf("Unexpected creation response: %s", rec.Body.String())
+		}
+
+		rec = probe(e, "/probe/keys", middleware.APIKeyHeader, resp.Key)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), resp.User.ID.String()) {
+			t.Fatalf("Expected the key to authenticate, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var key models.APIKey
+		config.DB.First(&key, "id = ?", resp.APIKey.ID)
+		if key.LastUsedAt == nil {
+			t.Error("Expected the last use to be recorded")
+		}
+
+		if rec := probe(e, "/probe/schedule", middleware.APIKeyHeader, resp.Key); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "insufficient_scope") {
+			t.Errorf("Expected insufficient_scope, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := probe(e, "/probe/keys", middleware.APIKeyHeader, resp.Key+"x"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a wrong key to be refused, got %d", rec.Code)
+		}
+	})
+
+	t.Run("admin service account", func(t *testing.T) {
+		rec := create(map[string]interface{}{"name": "Schedule export", "scopes": []string{"schedule:read"}, "role": "admin"})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		resp := created[len(created)-1]
+
+		// The two-factor policy applies to people, not to keys
+		cfg := config.Get()
+		previous := cfg.TwoFactor.RequireForAdmins
+		cfg.TwoFactor.RequireForAdmins = true
+		defer func() { cfg.TwoFactor.RequireForAdmins = previous }()
+
+		if rec := probe(e, "/probe/schedule", "Authorization", "Bearer "+resp.Key); rec.Code != http.StatusOK {
+			t.Errorf("Expected the admin key to be accepted, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := probe(e, "/probe/admin", "Authorization", "Bearer "+resp.Key); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected admin routes without a scope to refuse keys, got %d", rec.Code)
+		}
+	})
+
+	t.Run("revoked and expired keys", func(t *testing.T) {
+		rec := create(map[string]interface{}{"name": "Script", "scopes": []string{"reservations:read"}})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+		}
+		resp := created[len(created)-1]
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec = httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(resp.APIKey.ID.String())
+		call(c, handlers.RevokeAPIKey)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Revoke: expected status %d, got %d", http.StatusNoContent, rec.Code)
+		}
+		if rec := probe(e, "/probe/keys", middleware.APIKeyHeader, resp.Key); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a revoked key to be refused, got %d", rec.Code)
+		}
+
+		rec = create(map[string]interface{}{"name": "Expiring", "scopes": []string{"reservations:read"}, "expires_at": time.Now().Add(time.Hour)})
+		resp = created[len(created)-1]
+		config.DB.Model(&models.APIKey{}).Where("id = ?", resp.APIKey.ID).Update("expires_at", time.Now().Add(-time.Minute))
+		if rec := probe(e, "/probe/keys", middleware.APIKeyHeader, resp.Key); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected an expired key to be refused, got %d", rec.Code)
+		}
+	})
+}
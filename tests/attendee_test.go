@@ -0,0 +1,283 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spacebook/calendar"
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCalendar(t *testing.T) {
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.FixedZone("CET", 3600))
+	event := calendar.Event{
+		UID:       "42@spacebook",
+		Start:     start,
+		End:       start.Add(time.Hour),
+		Stamp:     start,
+		Summary:   "Salle A; étage 2, aile nord",
+		Status:    calendar.StatusConfirmed,
+		Organizer: &calendar.Person{Email: "alice@test.com", Name: "Alice"},
+		Attendees: []calendar.Person{
+			{Email: "bob@test.com", Name: "Bob", Status: calendar.Accepted},
+			{Email: "guest@example.com"},
+		},
+		Description: strings.Repeat("Réunion d'équipe hebdomadaire ", 5),
+	}
+
+	var out bytes.Buffer
+	if err := calendar.Write(&out, event); err != nil {
+		t.Fatal(err)
+	}
+	ics := out.String()
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20250310T080000Z\r\n",
+		"SUMMARY:Salle A\\; étage 2\\, aile nord\r\n",
+		`ORGANIZER;CN="Alice":mailto:alice@test.com`,
+		`ATTENDEE;CN="Bob";ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED:mailto:bob@test.com`,
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:guest@example.com",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("Expected %q in:\n%s", want, ics)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines to be folded at 75 octets, got %d: %q", len(line), line)
+		}
+	}
+	if !strings.Contains(ics, "\r\n ") {
+		t.Errorf("Expected the long description to be folded")
+	}
+}
+
+func TestAttendees(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	organizer := createTestUser(t)
+	guest := models.User{ID: uuid.New(), Email: "attendeetest@test.com", Username: "attendeetest", Role: "user"}
+	config.DB.Create(&guest)
+	room := models.Resource{ID: uuid.New().String(), Name: "Attendee Room", Type: "room", Capacity: 1, Seats: 3, Status: "available"}
+	config.DB.Create(&room)
+	defer func() {
+		cleanupTestData(organizer.Email, room.Name)
+		config.DB.Where("user_id = ?", guest.ID).Delete(&models.Notification{})
+		config.DB.Delete(&guest)
+	}()
+
+	startAt := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	reservation := models.Reservation{ID: uuid.New(), UserID: organizer.ID, ResourceID: uuid.MustParse(room.ID),
+		StartAt: startAt, EndAt: startAt.Add(time.Hour), Status: models.StatusPending, Quantity: 1}
+	config.DB.Create(&reservation)
+
+	// request runs h as the given user
+	request := func(method string, payload interface{}, h echo.HandlerFunc, userID uuid.UUID, params ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", userID)
+		c.Set("role", "user")
+		for i := 0; i+1 < len(params); i += 2 {
+			c.SetParamNames(append(c.ParamNames(), params[i])...)
+			c.SetParamValues(append(c.ParamValues(), params[i+1])...)
+		}
+		call(c, h)
+		return rec
+	}
+
+	var invited []models.Attendee
+	t.Run("invitations", func(t *testing.T) {
+		if rec := request(http.MethodPost, map[string]interface{}{"emails": []string{"x@example.com"}},
+			handlers.AddAttendees, guest.ID, "id", reservation.ID.String()); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected only the organizer to invite, got %d", rec.Code)
+		}
+
+		rec := request(http.MethodPost, map[string]interface{}{
+			"user_ids": []uuid.UUID{guest.ID},
+			"emails":   []string{"Guest@Example.com", guest.Email, organizer.Email},
+		}, handlers.AddAttendees, organizer.ID, "id", reservation.ID.String())
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		json.Unmarshal(rec.Body.Bytes(), &invited)
+		if len(invited) != 2 {
+			t.Fatalf("Expected the guest and the external email once each, got %+v", invited)
+		}
+		if invited[0].UserID == nil || invited[0].Token != "" || invited[1].Email != "guest@example.com" || invited[1].Token == "" {
+			t.Errorf("Expected a token for the external guest only, got %+v", invited)
+		}
+
+		// 3 seats: the organizer and two attendees
+		rec = request(http.MethodPost, map[string]interface{}{"emails": []string{"third@example.com"}},
+			handlers.AddAttendees, organizer.ID, "id", reservation.ID.String())
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "too_many_attendees") {
+			t.Errorf("Expected too_many_attendees, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var notifications int64
+		config.DB.Model(&models.Notification{}).Where("user_id = ? AND code = ?", guest.ID, "meeting_invitation").Count(&notifications)
+		if notifications != 1 {
+			t.Errorf("Expected the guest to be notified once, got %d", notifications)
+		}
+	})
+
+	t.Run("answers", func(t *testing.T) {
+		if len(invited) != 2 {
+			t.Skip("no invitation")
+		}
+
+		rec := request(http.MethodPut, nil, handlers.AcceptInvitation, guest.ID, "id", invited[0].ID.String())
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"accepted"`) {
+			t.Fatalf("Expected the invitation to be accepted, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodPut, nil, handlers.AcceptInvitation, organizer.ID, "id", invited[0].ID.String()); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected others not to answer an invitation, got %d", rec.Code)
+		}
+
+		rec = request(http.MethodPut, nil, handlers.DeclineInvitationByToken, uuid.Nil, "token", invited[1].Token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected the external guest to decline, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodPut, nil, handlers.AcceptInvitationByToken, uuid.Nil, "token", "wrong"); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected an unknown token to be refused, got %d", rec.Code)
+		}
+
+		// The declined seat is free again
+		rec = request(http.MethodPost, map[string]interface{}{"emails": []string{"third@example.com"}},
+			handlers.AddAttendees, organizer.ID, "id", reservation.ID.String())
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected the declined seat to be reused, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodPut, nil, handlers.AcceptInvitationByToken, uuid.Nil, "token", invited[1].Token); rec.Code != http.StatusConflict {
+			t.Errorf("Expected no seat left to accept again, got %d", rec.Code)
+		}
+	})
+
+	t.Run("attendees see the meeting", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/reservations", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", guest.ID)
+		call(c, handlers.GetUserReservations)
+		var reservations []models.Reservation
+		json.Unmarshal(rec.Body.Bytes(), &reservations)
+		if len(reservations) != 1 || reservations[0].ID != reservation.ID || len(reservations[0].Attendees) != 3 {
+			t.Errorf("Expected the meeting in the guest's list, got %s", rec.Body.String())
+		}
+
+		rec = request(http.MethodGet, nil, handlers.GetReservationCalendar, guest.ID, "id", reservation.ID.String())
+		ics := strings.ReplaceAll(rec.Body.String(), "\r\n ", "")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/calendar") {
+			t.Fatalf("Expected an iCalendar file, got %d: %s", rec.Code, ics)
+		}
+		for _, want := range []string{"STATUS:TENTATIVE", "PARTSTAT=ACCEPTED:mailto:" + guest.Email, "PARTSTAT=DECLINED:mailto:guest@example.com"} {
+			if !strings.Contains(ics, want) {
+				t.Errorf("Expected %q in:\n%s", want, ics)
+			}
+		}
+		if rec := request(http.MethodGet, nil, handlers.GetReservationCalendar, uuid.New(), "id", reservation.ID.String()); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected strangers not to get the calendar, got %d", rec.Code)
+		}
+	})
+
+	t.Run("attendees are told about the decision", func(t *testing.T) {
+		rec := request(http.MethodPut, nil, handlers.ApproveReservation, uuid.New(), "id", reservation.ID.String())
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("Expected users not to approve, got %d", rec.Code)
+		}
+
+		req := httptest.NewRequest(http.MethodPut, "/", nil)
+		rec = httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("role", "admin")
+		c.SetParamNames("id")
+		c.SetParamValues(reservation.ID.String())
+		call(c, handlers.ApproveReservation)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var notifications int64
+		config.DB.Model(&models.Notification{}).Where("user_id = ? AND code = ?", guest.ID, "meeting_confirmed").Count(&notifications)
+		if notifications != 1 {
+			t.Errorf("Expected the accepted guest to be told, got %d notifications", notifications)
+		}
+	})
+
+	t.Run("attendees are only added by invitation", func(t *testing.T) {
+		meetingAt := startAt.Add(48 * time.Hour)
+		rec := request(http.MethodPost, map[string]interface{}{
+			"user_id":     organizer.ID,
+			"resource_id": room.ID,
+			"start_at":    meetingAt,
+			"end_at":      meetingAt.Add(time.Hour),
+			"attendees": []map[string]interface{}{
+				{"email": "forged@example.com", "status": models.InvitationAccepted},
+			},
+		}, handlers.CreateReservation, organizer.ID)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		var meeting models.Reservation
+		json.Unmarshal(rec.Body.Bytes(), &meeting)
+
+		var forged int64
+		config.DB.Model(&models.Attendee{}).Where("reservation_id = ?", meeting.ID).Count(&forged)
+		if forged != 0 {
+			t.Errorf("Expected no attendee from the reservation body, got %d", forged)
+		}
+
+		// The token of an external guest is returned, not audited
+		audited := middleware.Audit(handlers.AddAttendees)
+		rec = request(http.MethodPost, map[string]interface{}{"emails": []string{"audited@example.com"}},
+			audited, organizer.ID, "id", meeting.ID.String())
+		var added []models.Attendee
+		json.Unmarshal(rec.Body.Bytes(), &added)
+		if len(added) != 1 || added[0].Token == "" {
+			t.Fatalf("Expected a token for the external guest, got %d: %s", rec.Code, rec.Body.String())
+		}
+		defer config.DB.Exec("DELETE FROM audit_events WHERE entity_id = ?", meeting.ID.String())
+
+		var event models.AuditEvent
+		if err := config.DB.Where("entity_id = ? AND action = ?", meeting.ID.String(), "reservation.attendees_add").First(&event).Error; err != nil {
+			t.Fatalf("Expected the invitation to be audited: %v", err)
+		}
+		if raw, _ := json.Marshal(event); strings.Contains(string(raw), added[0].Token) {
+			t.Errorf("Expected the audit event not to hold the token, got %s", raw)
+		}
+
+		// Nor is the token of an invitation link
+		router := newTestEcho()
+		router.PUT("/invitations/:token/decline", handlers.DeclineInvitationByToken, middleware.Audit)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/invitations/"+added[0].Token+"/decline", nil))
+		defer config.DB.Exec("DELETE FROM audit_events WHERE action = ?", "PUT /invitations/:token/decline")
+
+		var link models.AuditEvent
+		if err := config.DB.Where("action = ?", "PUT /invitations/:token/decline").Order("created_at DESC").First(&link).Error; err != nil {
+			t.Fatalf("Expected the answer to be audited: %v", err)
+		}
+		if link.Path != "/invitations/:token/decline" {
+			t.Errorf("Expected the route to be audited without the token, got %q", link.Path)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetAuditEvents(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	event := models.AuditEvent{
+		Action:     "test.audit",
+		EntityType: "test",
+		EntityID:   "audit-test-entity",
+		Method:     http.MethodPut,
+		Path:       "/admin/test",
+		Status:     http.StatusOK,
+		IP:         "127.0.0.1",
+	}
+	config.DB.Create(&event)
+
+	defer config.DB.Exec("DELETE FROM audit_events WHERE action = ?", "test.audit")
+
+	t.Run("filter by action", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?action=test.audit", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handlers.GetAuditEvents(c)
+		if err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		var events []models.AuditEvent
+		json.Unmarshal(rec.Body.Bytes(), &events)
+
+		if len(events) != 1 || events[0].EntityID != "audit-test-entity" {
+			t.Errorf("Expected the test audit event, got %v", events)
+		}
+	})
+
+	t.Run("csv export", func(t *testing.T) {
+		formula := models.AuditEvent{
+			Action:     "test.audit",
+			EntityType: "test",
+			EntityID:   `=HYPERLINK("http://example.com")`,
+			Method:     http.MethodPut,
+			Path:       "/admin/test",
+			Status:     http.StatusOK,
+			IP:         "127.0.0.1",
+		}
+		config.DB.Create(&formula)
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?action=test.audit&format=csv", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		call(c, handlers.GetAuditEvents)
+
+		if !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/csv") {
+			t.Errorf("Expected CSV content type, got %s", rec.Header().Get(echo.HeaderContentType))
+		}
+
+		if !strings.Contains(rec.Body.String(), "audit-test-entity") {
+			t.Error("Expected the test audit event in the CSV export")
+		}
+		if !strings.Contains(rec.Body.String(), `'=HYPERLINK(`) {
+			t.Error("Expected formula cells to be escaped in the CSV export")
+		}
+	})
+
+	t.Run("audit events are append-only", func(t *testing.T) {
+		err := config.DB.Model(&event).Update("action", "tampered").Error
+		if err == nil {
+			t.Error("Expected update of an audit event to fail")
+		}
+	})
+}
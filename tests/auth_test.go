@@ -3,13 +3,17 @@ package tests
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"spacebook/apperr"
 	"spacebook/config"
 	"spacebook/handlers"
 	"spacebook/models"
+	"spacebook/ratelimit"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -22,17 +26,32 @@ func setupTestDB() {
 	}
 }
 
+// newTestEcho returns an Echo instance rendering errors like the server does.
+func newTestEcho() *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = apperr.Write
+	return e
+}
+
+// call runs a handler and renders the error it returns, if any, into the
+// response recorder.
+func call(c echo.Context, h echo.HandlerFunc) {
+	if err := h(c); err != nil {
+		c.Echo().HTTPErrorHandler(err, c)
+	}
+}
+
 func TestRegister(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	// Test successful registration
 	t.Run("successful registration", func(t *testing.T) {
 		payload := map[string]string{
 			"email":    "testregister@test.com",
 			"username": "testregister",
-			"password": "password123",
+			"password": "Correct-Horse-42",
 		}
 		body, _ := json.Marshal(payload)
 
@@ -73,7 +92,7 @@ func TestRegister(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		handlers.Register(c)
+		call(c, handlers.Register)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
@@ -86,7 +105,7 @@ func TestRegister(t *testing.T) {
 		payload := map[string]string{
 			"email":    "duplicate@test.com",
 			"username": "duplicate1",
-			"password": "password123",
+			"password": "Correct-Horse-42",
 		}
 		body, _ := json.Marshal(payload)
 
@@ -94,7 +113,7 @@ func TestRegister(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
-		handlers.Register(c)
+		call(c, handlers.Register)
 
 		// Try to create second user with same email
 		payload["username"] = "duplicate2"
@@ -104,40 +123,112 @@ func TestRegister(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec = httptest.NewRecorder()
 		c = e.NewContext(req, rec)
-		handlers.Register(c)
+		call(c, handlers.Register)
 
 		if rec.Code != http.StatusConflict {
 			t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
 		}
 
+		// Uniqueness ignores the case
+		payload["email"] = "  Duplicate@TEST.com "
+		body, _ = json.Marshal(payload)
+
+		req = httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+		call(c, handlers.Register)
+
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Expected status %d for a differently cased email, got %d", http.StatusConflict, rec.Code)
+		}
+
 		// Cleanup
 		config.DB.Where("email = ?", "duplicate@test.com").Delete(&models.User{})
 	})
 }
 
+// Validation happens before any database access
+func TestRegisterValidation(t *testing.T) {
+	e := newTestEcho()
+
+	register := func(email, username, password string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]string{
+			"email":    email,
+			"username": username,
+			"password": password,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		call(e.NewContext(req, rec), handlers.Register)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q / %q, got %d", http.StatusBadRequest, email, password, rec.Code)
+		}
+		var response map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return response
+	}
+
+	for _, email := range []string{"not-an-email", "Alice <alice@test.com>", "alice@localhost", "@test.com"} {
+		if response := register(email, "alice", "Correct-Horse-42"); response["code"] != "invalid_email" {
+			t.Errorf("Expected invalid_email for %q, got %v", email, response["code"])
+		}
+	}
+
+	if response := register("alice@test.com", "   ", "Correct-Horse-42"); response["code"] != "invalid_username" {
+		t.Errorf("Expected invalid_username, got %v", response["code"])
+	}
+
+	cases := map[string]string{
+		"a":                        "min_length",
+		"alllowercaseletters":      "character_classes",
+		"Alice-Secret-42":          "contains_identity",
+		"Password1234":             "common_password",
+		strings.Repeat("Ab1!", 20): "max_length",
+	}
+	for password, rule := range cases {
+		response := register("alice@test.com", "alice", password)
+		if response["code"] != "weak_password" {
+			t.Errorf("Expected weak_password for %q, got %v", password, response["code"])
+			continue
+		}
+		details, _ := response["details"].(map[string]interface{})
+		rules, _ := details["failed_rules"].([]interface{})
+		found := false
+		for _, r := range rules {
+			found = found || r == rule
+		}
+		if !found {
+			t.Errorf("Expected rule %s to fail for %q, got %v", rule, password, rules)
+		}
+	}
+}
+
 func TestLogin(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	// Create test user
 	payload := map[string]string{
 		"email":    "testlogin@test.com",
 		"username": "testlogin",
-		"password": "password123",
+		"password": "Correct-Horse-42",
 	}
 	body, _ := json.Marshal(payload)
 	req := httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewReader(body))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
-	handlers.Register(c)
+	call(c, handlers.Register)
 
 	// Test successful login
 	t.Run("successful login", func(t *testing.T) {
 		loginPayload := map[string]string{
 			"email":    "testlogin@test.com",
-			"password": "password123",
+			"password": "Correct-Horse-42",
 		}
 		body, _ := json.Marshal(loginPayload)
 
@@ -176,7 +267,7 @@ func TestLogin(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		handlers.Login(c)
+		call(c, handlers.Login)
 
 		if rec.Code != http.StatusUnauthorized {
 			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
@@ -187,7 +278,7 @@ func TestLogin(t *testing.T) {
 	t.Run("non-existent user", func(t *testing.T) {
 		loginPayload := map[string]string{
 			"email":    "nonexistent@test.com",
-			"password": "password123",
+			"password": "Correct-Horse-42",
 		}
 		body, _ := json.Marshal(loginPayload)
 
@@ -196,13 +287,56 @@ func TestLogin(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		handlers.Login(c)
+		call(c, handlers.Login)
 
 		if rec.Code != http.StatusUnauthorized {
 			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
 		}
 	})
 
+	// Test lockout after repeated failures
+	t.Run("account lockout", func(t *testing.T) {
+		previous := ratelimit.Current()
+		ratelimit.Use(ratelimit.NewMemoryStore())
+		defer ratelimit.Use(previous)
+
+		attempt := func(i int, password string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(map[string]string{
+				"email":    "testlogin@test.com",
+				"password": password,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			// A different IP for each attempt: only the account limit applies
+			req.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", i)
+			rec := httptest.NewRecorder()
+			call(e.NewContext(req, rec), handlers.Login)
+			return rec
+		}
+
+		maxFailures := config.Get().RateLimit.MaxFailuresPerAccount
+		for i := 0; i < maxFailures; i++ {
+			if rec := attempt(i, "wrongpassword"); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("Attempt %d: expected status %d, got %d", i, http.StatusUnauthorized, rec.Code)
+			}
+		}
+
+		// Even the right password is refused while locked
+		rec := attempt(maxFailures, "Correct-Horse-42")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Error("Expected a Retry-After header")
+		}
+
+		var response map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if response["code"] != "login_locked" {
+			t.Errorf("Expected code login_locked, got %v", response["code"])
+		}
+	})
+
 	// Cleanup
 	config.DB.Where("email = ?", "testlogin@test.com").Delete(&models.User{})
 }
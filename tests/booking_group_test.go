@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestBookingGroups(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	room := models.Resource{ID: uuid.New().String(), Name: "Group Room", Type: "room", Capacity: 1, Status: "available"}
+	projector := models.Resource{ID: uuid.New().String(), Name: "Group Projector", Type: "equipment", Capacity: 1,
+		Status: "available", ApprovalPolicy: models.ApprovalAuto}
+	config.DB.Create(&room)
+	config.DB.Create(&projector)
+	defer func() {
+		cleanupTestData(user.Email, room.Name)
+		cleanupTestData(user.Email, projector.Name)
+	}()
+
+	// request runs h as the given user and role
+	request := func(method string, payload interface{}, h echo.HandlerFunc, userID uuid.UUID, role string, params ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", userID)
+		c.Set("role", role)
+		if len(params) == 2 {
+			c.SetParamNames(params[0])
+			c.SetParamValues(params[1])
+		}
+		call(c, h)
+		return rec
+	}
+
+	startAt := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+	book := func(mode string) (models.BookingGroup, *httptest.ResponseRecorder) {
+		rec := request(http.MethodPost, map[string]interface{}{
+			"start_at":      startAt.Format(time.RFC3339),
+			"end_at":        startAt.Add(time.Hour).Format(time.RFC3339),
+			"approval_mode": mode,
+			"items": []map[string]interface{}{
+				{"resource_id": room.ID},
+				{"resource_id": projector.ID},
+			},
+		}, handlers.CreateBookingGroup, user.ID, "user")
+		var group models.BookingGroup
+		json.Unmarshal(rec.Body.Bytes(), &group)
+		return group, rec
+	}
+	statuses := func(group models.BookingGroup) map[uuid.UUID]string {
+		var items []models.Reservation
+		config.DB.Where("group_id = ?", group.ID).Find(&items)
+		got := map[uuid.UUID]string{}
+		for _, item := range items {
+			got[item.ResourceID] = item.Status
+		}
+		return got
+	}
+	roomID, projectorID := uuid.MustParse(room.ID), uuid.MustParse(projector.ID)
+
+	t.Run("all or nothing", func(t *testing.T) {
+		taken := models.Reservation{ID: uuid.New(), UserID: user.ID, ResourceID: projectorID,
+			StartAt: startAt, EndAt: startAt.Add(time.Hour), Status: models.StatusApproved, Quantity: 1}
+		config.DB.Create(&taken)
+		defer config.DB.Delete(&taken)
+
+		_, rec := book(models.GroupApprovalGroup)
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), projector.ID) {
+			t.Fatalf("Expected the full projector to refuse the group, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var count int64
+		config.DB.Model(&models.Reservation{}).Where("resource_id = ?", room.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("Expected the room not to be booked, got %d reservations", count)
+		}
+	})
+
+	t.Run("one decision for the group", func(t *testing.T) {
+		group, rec := book(models.GroupApprovalGroup)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		// The projector approves automatically but waits for the room
+		if got := statuses(group); got[roomID] != models.StatusPending || got[projectorID] != models.StatusPending {
+			t.Fatalf("Expected both items to be pending, got %v", got)
+		}
+
+		item := group.Items[0].ID.String()
+		if rec := request(http.MethodPut, nil, handlers.ApproveReservation, uuid.New(), "admin", "id", item); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "group_decision_required") {
+			t.Errorf("Expected group_decision_required, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodPut, nil, handlers.ApproveBookingGroup, user.ID, "user", "id", group.ID.String()); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected the owner not to approve their group, got %d", rec.Code)
+		}
+
+		rec = request(http.MethodPut, nil, handlers.ApproveBookingGroup, uuid.New(), "admin", "id", group.ID.String())
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if got := statuses(group); got[roomID] != models.StatusApproved || got[projectorID] != models.StatusApproved {
+			t.Errorf("Expected both items to be approved, got %v", got)
+		}
+
+		// Cancelling frees both resources
+		if rec := request(http.MethodPut, nil, handlers.CancelBookingGroup, uuid.New(), "user", "id", group.ID.String()); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected another user not to cancel the group, got %d", rec.Code)
+		}
+		rec = request(http.MethodPut, nil, handlers.CancelBookingGroup, user.ID, "user", "id", group.ID.String())
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"cancelled"`) {
+			t.Fatalf("Expected the group to be cancelled, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodPut, nil, handlers.CancelBookingGroup, user.ID, "user", "id", group.ID.String()); rec.Code != http.StatusConflict {
+			t.Errorf("Expected a cancelled group not to be cancelled twice, got %d", rec.Code)
+		}
+	})
+
+	t.Run("decisions per item", func(t *testing.T) {
+		group, rec := book(models.GroupApprovalItem)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected the cancelled group to have freed the resources, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := statuses(group); got[roomID] != models.StatusPending || got[projectorID] != models.StatusApproved {
+			t.Fatalf("Expected the projector only to be approved, got %v", got)
+		}
+
+		if rec := request(http.MethodPut, nil, handlers.ApproveBookingGroup, uuid.New(), "admin", "id", group.ID.String()); rec.Code != http.StatusConflict {
+			t.Errorf("Expected item_decision_required, got %d", rec.Code)
+		}
+
+		for _, item := range group.Items {
+			if item.ResourceID == roomID {
+				rec := request(http.MethodPut, nil, handlers.RejectReservation, uuid.New(), "admin", "id", item.ID.String())
+				if rec.Code != http.StatusOK {
+					t.Fatalf("Expected the room to be rejected on its own, got %d: %s", rec.Code, rec.Body.String())
+				}
+			}
+		}
+		if got := statuses(group); got[roomID] != models.StatusRejected || got[projectorID] != models.StatusApproved {
+			t.Errorf("Expected the projector to be kept, got %v", got)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		cases := []map[string]interface{}{
+			{"start_at": startAt, "end_at": startAt.Add(time.Hour)},
+			{"start_at": startAt, "end_at": startAt.Add(time.Hour), "approval_mode": "each",
+				"items": []map[string]interface{}{{"resource_id": room.ID}}},
+			{"start_at": startAt, "end_at": startAt.Add(time.Hour),
+				"items": []map[string]interface{}{{"resource_id": room.ID}, {"resource_id": room.ID}}},
+		}
+		for _, payload := range cases {
+			if rec := request(http.MethodPost, payload, handlers.CreateBookingGroup, user.ID, "user"); rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected %v to be refused, got %d", payload, rec.Code)
+			}
+		}
+	})
+
+	t.Run("booking for another user", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"user_id":  user.ID,
+			"start_at": startAt.Add(24 * time.Hour),
+			"end_at":   startAt.Add(25 * time.Hour),
+			"items":    []map[string]interface{}{{"resource_id": projector.ID}},
+		}
+		rec := request(http.MethodPost, payload, handlers.CreateBookingGroup, uuid.New(), "user")
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "book_on_behalf_not_allowed") {
+			t.Errorf("Expected a user not to book for another one, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		rec = request(http.MethodPost, payload, handlers.CreateBookingGroup, uuid.New(), "admin")
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected an admin to book for another user, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var group models.BookingGroup
+		json.Unmarshal(rec.Body.Bytes(), &group)
+
+		// A plain reservation cannot join the group of another user
+		rec = request(http.MethodPost, map[string]interface{}{
+			"user_id":     user.ID,
+			"resource_id": room.ID,
+			"group_id":    group.ID,
+			"start_at":    startAt.Add(24 * time.Hour),
+			"end_at":      startAt.Add(25 * time.Hour),
+		}, handlers.CreateReservation, user.ID, "user")
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		var reservation models.Reservation
+		json.Unmarshal(rec.Body.Bytes(), &reservation)
+		config.DB.First(&reservation, "id = ?", reservation.ID)
+		if reservation.GroupID != nil {
+			t.Errorf("Expected the reservation to stay out of the group, got %v", *reservation.GroupID)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCheckIn(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	room := models.Resource{ID: uuid.New().String(), Name: "Check-in Room", Type: "room", Capacity: 1,
+		Status: "available", CheckInRequired: true, CheckInToken: "room-code"}
+	config.DB.Create(&room)
+	defer func() {
+		config.DB.Where("user_id = ?", user.ID).Delete(&models.Notification{})
+		cleanupTestData(user.Email, room.Name)
+	}()
+
+	// request runs h as the given user
+	request := func(payload interface{}, h echo.HandlerFunc, userID uuid.UUID, params ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", userID)
+		c.Set("role", "user")
+		if len(params) == 2 {
+			c.SetParamNames(params[0])
+			c.SetParamValues(params[1])
+		}
+		call(c, h)
+		return rec
+	}
+	reserve := func(startAt time.Time) models.Reservation {
+		reservation := models.Reservation{ID: uuid.New(), UserID: user.ID, ResourceID: uuid.MustParse(room.ID),
+			StartAt: startAt, EndAt: startAt.Add(time.Hour), Status: models.StatusApproved, Quantity: 1}
+		config.DB.Create(&reservation)
+		return reservation
+	}
+
+	t.Run("check-in", func(t *testing.T) {
+		now := reserve(time.Now().Add(5 * time.Minute))
+		id := now.ID.String()
+
+		if rec := request(map[string]string{"token": "wrong"}, handlers.CheckIn, user.ID, "id", id); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a wrong room code to be refused, got %d", rec.Code)
+		}
+		if rec := request(map[string]string{"token": "room-code"}, handlers.CheckIn, uuid.New(), "id", id); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected strangers not to check in, got %d", rec.Code)
+		}
+
+		rec := request(map[string]string{"token": "room-code"}, handlers.CheckIn, user.ID, "id", id)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "checked_in_at") {
+			t.Fatalf("Expected the reservation to be checked in, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(map[string]string{"token": "room-code"}, handlers.CheckIn, user.ID, "id", id); rec.Code != http.StatusConflict {
+			t.Errorf("Expected already_checked_in, got %d", rec.Code)
+		}
+
+		later := reserve(time.Now().Add(3 * time.Hour))
+		rec = request(map[string]string{"token": "room-code"}, handlers.CheckIn, user.ID, "id", later.ID.String())
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "opens_at") {
+			t.Errorf("Expected the check-in window to be closed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("no-shows are released", func(t *testing.T) {
+		missed := reserve(time.Now().Add(-time.Hour))
+
+		if err := handlers.ReleaseNoShows(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var reservation models.Reservation
+		config.DB.First(&reservation, "id = ?", missed.ID)
+		if reservation.Status != models.StatusNoShow {
+			t.Errorf("Expected the reservation to be released as no_show, got %s", reservation.Status)
+		}
+
+		var owner models.User
+		config.DB.First(&owner, "id = ?", user.ID)
+		if owner.NoShows != 1 {
+			t.Errorf("Expected the no-show to be counted, got %d", owner.NoShows)
+		}
+
+		var notifications int64
+		config.DB.Model(&models.Notification{}).Where("user_id = ? AND code = ?", user.ID, "reservation_no_show").Count(&notifications)
+		if notifications != 1 {
+			t.Errorf("Expected the owner to be notified once, got %d", notifications)
+		}
+	})
+
+	t.Run("repeated no-shows block new bookings", func(t *testing.T) {
+		limit := config.Get().CheckIn.NoShowLimit
+		for i := 1; i < limit; i++ {
+			missed := reserve(time.Now().Add(-time.Duration(i+1) * time.Hour))
+			config.DB.Model(&missed).Update("status", models.StatusNoShow)
+		}
+
+		startAt := time.Now().Add(24 * time.Hour)
+		rec := request(map[string]interface{}{
+			"user_id":     user.ID,
+			"resource_id": room.ID,
+			"start_at":    startAt,
+			"end_at":      startAt.Add(time.Hour),
+		}, handlers.CreateReservation, user.ID)
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "no_show_penalty") {
+			t.Errorf("Expected no_show_penalty, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"spacebook/config"
+)
+
+func TestConfigValidation(t *testing.T) {
+	t.Run("defaults are valid in development", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Database.Name = "spacebook"
+
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected default configuration to be valid, got %v", err)
+		}
+	})
+
+	t.Run("production refuses the default JWT secret", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Env = "production"
+		cfg.Database.Name = "spacebook"
+		cfg.Database.SSLMode = "require"
+		cfg.CORS.AllowOrigins = []string{"https://spacebook.example.com"}
+
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected production configuration with default secret to be rejected")
+		}
+
+		cfg.JWT.Secret = "a-very-long-and-random-production-secret"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected production configuration to be valid, got %v", err)
+		}
+	})
+
+	t.Run("invalid sslmode", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Database.Name = "spacebook"
+		cfg.Database.SSLMode = "sometimes"
+
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected invalid sslmode to be rejected")
+		}
+	})
+
+	t.Run("invalid rate limits", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Database.Name = "spacebook"
+		cfg.RateLimit.Store = "redis"
+		cfg.RateLimit.LockoutMax = time.Second
+
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an unknown store and lockout_max below lockout_base to be rejected")
+		}
+	})
+
+	t.Run("invalid token signing", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Database.Name = "spacebook"
+		cfg.JWT.Algorithm = "none"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an unknown algorithm to be rejected")
+		}
+
+		cfg.JWT.Algorithm = "RS256"
+		cfg.JWT.KeyRotation = time.Hour
+		cfg.JWT.KeyPublishAhead = 2 * time.Hour
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected a rotation shorter than the publication delay to be rejected")
+		}
+	})
+
+	t.Run("invalid storage", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Database.Name = "spacebook"
+		cfg.Storage.Backend = "s3"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an unknown storage backend to be rejected")
+		}
+
+		cfg.Storage.Backend = "local"
+		cfg.Storage.MaxUploadSize = 0
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an empty upload size to be rejected")
+		}
+	})
+
+	t.Run("invalid check-in", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Database.Name = "spacebook"
+		cfg.CheckIn.GracePeriod = 0
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an empty grace period to be rejected")
+		}
+
+		cfg.CheckIn.GracePeriod = 15 * time.Minute
+		cfg.CheckIn.NoShowWindow = 0
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected a no-show limit without window to be rejected")
+		}
+
+		cfg.CheckIn.NoShowLimit = 0
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected the penalty to be disabled, got %v", err)
+		}
+	})
+}
+
+func TestConfigLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	yaml := `
+port: 9000
+database:
+  host: db.internal
+  name: spacebook
+  max_open_conns: 10
+jwt:
+  token_ttl: 2h
+cors:
+  allow_origins: ["http://localhost:5173"]
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_HOST", "")
+	t.Setenv("DB_NAME", "")
+	t.Setenv("PORT", "9100")
+
+	previous := config.App
+	defer func() { config.App = previous }()
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.Port != 9100 {
+		t.Errorf("Expected PORT to override the file, got %d", cfg.Port)
+	}
+	if cfg.Database.Host != "db.internal" || cfg.Database.MaxOpenConns != 10 {
+		t.Errorf("Expected database settings from the file, got %+v", cfg.Database)
+	}
+	if cfg.JWT.TokenTTL != 2*time.Hour {
+		t.Errorf("Expected token TTL of 2h, got %v", cfg.JWT.TokenTTL)
+	}
+	if len(cfg.CORS.AllowOrigins) != 1 || cfg.CORS.AllowOrigins[0] != "http://localhost:5173" {
+		t.Errorf("Expected CORS origins from the file, got %v", cfg.CORS.AllowOrigins)
+	}
+}
+
+func TestConfigConnectRetries(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Name = "spacebook"
+	cfg.Database.ConnectAttempts = 0
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected zero connection attempts to be rejected")
+	}
+}
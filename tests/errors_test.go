@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spacebook/apperr"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	e := newTestEcho()
+	e.Use(middleware.RequestID())
+	e.GET("/conflict", func(c echo.Context) error {
+		return apperr.Conflict("resource_full", "Ressource complète pour ce créneau horaire").WithDetails(echo.Map{"available": 0})
+	})
+	e.GET("/failure", func(c echo.Context) error {
+		return errors.New("pq: connection refused")
+	})
+
+	serve := func(path string) (*httptest.ResponseRecorder, apperr.Body) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var body apperr.Body
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec, body
+	}
+
+	t.Run("domain error", func(t *testing.T) {
+		rec, body := serve("/conflict")
+
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+		}
+		if body.Code != "resource_full" || body.Message != "Ressource complète pour ce créneau horaire" {
+			t.Errorf("Unexpected error body: %+v", body)
+		}
+		if body.Details == nil {
+			t.Error("Expected details in the error body")
+		}
+		if body.RequestID == "" || body.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+			t.Errorf("Expected request ID %q in the body, got %q", rec.Header().Get(echo.HeaderXRequestID), body.RequestID)
+		}
+	})
+
+	t.Run("unexpected error is not leaked", func(t *testing.T) {
+		rec, body := serve("/failure")
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+		}
+		if body.Code != "internal_error" || strings.Contains(rec.Body.String(), "connection refused") {
+			t.Errorf("Expected a generic internal error, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		rec, body := serve("/nowhere")
+
+		if rec.Code != http.StatusNotFound || body.Code != "route_not_found" {
+			t.Errorf("Expected route_not_found, got %d %+v", rec.Code, body)
+		}
+	})
+}
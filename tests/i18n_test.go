@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spacebook/apperr"
+	"spacebook/i18n"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestI18nCatalog(t *testing.T) {
+	t.Run("every code is translated", func(t *testing.T) {
+		fr, en := i18n.Codes(i18n.French), i18n.Codes(i18n.English)
+		if strings.Join(fr, ",") != strings.Join(en, ",") {
+			t.Errorf("French and English catalogs differ:\nfr: %v\nen: %v", fr, en)
+		}
+	})
+
+	t.Run("parameters are substituted", func(t *testing.T) {
+		got := i18n.T(i18n.English, "reservation_requested", i18n.Params{"username": "alice", "resource": "Salle A"})
+		if got != "New reservation request from alice for Salle A" {
+			t.Errorf("Unexpected message %q", got)
+		}
+	})
+
+	t.Run("fallbacks", func(t *testing.T) {
+		if got := i18n.T("de", "invalid_credentials", nil); got != "Identifiants invalides" {
+			t.Errorf("Expected the default locale for an unsupported one, got %q", got)
+		}
+		if got := i18n.T(i18n.English, "unknown_code", nil); got != "unknown_code" {
+			t.Errorf("Expected the code for an unknown message, got %q", got)
+		}
+	})
+}
+
+func TestI18nNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                        i18n.French,
+		"en":                      i18n.English,
+		"en-GB,en;q=0.9":          i18n.English,
+		"de-DE,de;q=0.9,en;q=0.5": i18n.English,
+		"fr;q=0.4,en;q=0.8":       i18n.English,
+		"en;q=0.3,fr-CA;q=0.7":    i18n.French,
+		"de, it":                  i18n.French,
+		"en;q=0":                  i18n.French,
+		"en;q=invalid,fr;q=0.1":   i18n.French,
+		"*":                       i18n.French,
+	}
+
+	for header, want := range cases {
+		if got := i18n.Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestI18nErrorMessages(t *testing.T) {
+	e := newTestEcho()
+	e.GET("/login", func(c echo.Context) error {
+		return apperr.Unauthorized("invalid_credentials", "Identifiants invalides")
+	})
+	e.GET("/preference", func(c echo.Context) error {
+		c.Set(i18n.ContextKey, i18n.English)
+		return apperr.BadRequest("invalid_date", "Date invalide").WithDetails(echo.Map{"param": "from"})
+	})
+
+	serve := func(path, acceptLanguage string) apperr.Body {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var body apperr.Body
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return body
+	}
+
+	if body := serve("/login", ""); body.Message != "Identifiants invalides" {
+		t.Errorf("Expected the French message by default, got %q", body.Message)
+	}
+	if body := serve("/login", "en-US,en;q=0.9"); body.Message != "Invalid credentials" || body.Code != "invalid_credentials" {
+		t.Errorf("Expected the English message, got %+v", body)
+	}
+	if body := serve("/preference", "fr"); body.Message != "Invalid date for parameter from" {
+		t.Errorf("Expected the user preference to win over Accept-Language, got %q", body.Message)
+	}
+}
@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"spacebook/jobs"
+)
+
+func TestRunner(t *testing.T) {
+	t.Run("jobs run periodically and stop with the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		runner := jobs.NewRunner()
+
+		var runs atomic.Int32
+		runner.Every(ctx, "test", 10*time.Millisecond, func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		})
+
+		time.Sleep(55 * time.Millisecond)
+		cancel()
+
+		if !runner.Wait(time.Second) {
+			t.Fatal("Expected the runner to stop after cancellation")
+		}
+		if runs.Load() == 0 {
+			t.Error("Expected the job to have run at least once")
+		}
+	})
+}
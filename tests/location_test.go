@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSiteAdminRouting(t *testing.T) {
+	global := models.User{ID: uuid.New(), Email: "global@test.com", Role: "admin"}
+	site := models.User{ID: uuid.New(), Email: "site@test.com", Role: "admin"}
+	states := stubUserStates(t, global, site)
+	states.sites[site.ID] = []uuid.UUID{uuid.New()}
+
+	e := newTestEcho()
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/probe/scoped", ok, middleware.Authenticate, middleware.AdminOnly)
+	e.GET("/probe/global", ok, middleware.Authenticate, middleware.AdminOnly, middleware.GlobalAdminOnly)
+
+	globalToken, _ := middleware.GenerateToken(global)
+	siteToken, _ := middleware.GenerateToken(site)
+
+	if rec := probe(e, "/probe/global", "Authorization", "Bearer "+globalToken); rec.Code != http.StatusOK {
+		t.Errorf("Expected a global admin to be accepted, got %d", rec.Code)
+	}
+	if rec := probe(e, "/probe/scoped", "Authorization", "Bearer "+siteToken); rec.Code != http.StatusOK {
+		t.Errorf("Expected a site admin to reach site-scoped routes, got %d", rec.Code)
+	}
+	if rec := probe(e, "/probe/global", "Authorization", "Bearer "+siteToken); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "global_admin_required") {
+		t.Errorf("Expected global_admin_required, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLocations(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	var locations []uuid.UUID
+	resource := createTestResource(t, 3)
+	user := createTestUser(t)
+	defer func() {
+		cleanupTestData(user.Email, resource.Name)
+		for i := len(locations) - 1; i >= 0; i-- {
+			config.DB.Delete(&models.Location{}, "id = ?", locations[i])
+		}
+	}()
+
+	// request runs h as an admin, restricted to sites when given
+	request := func(method string, payload interface{}, h echo.HandlerFunc, sites []uuid.UUID, params ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("role", "admin")
+		if len(sites) > 0 {
+			c.Set("admin_sites", sites)
+		}
+		if len(params) == 2 {
+			c.SetParamNames(params[0])
+			c.SetParamValues(params[1])
+		}
+		call(c, h)
+		return rec
+	}
+
+	create := func(payload map[string]interface{}, sites ...uuid.UUID) (models.Location, *httptest.ResponseRecorder) {
+		rec := request(http.MethodPost, payload, handlers.CreateLocation, sites)
+		var location models.Location
+		if rec.Code == http.StatusCreated {
+			json.Unmarshal(rec.Body.Bytes(), &location)
+			locations = append(locations, location.ID)
+		}
+		return location, rec
+	}
+
+	paris, rec := create(map[string]interface{}{"name": "Paris", "kind": "site", "timezone": "Europe/Paris"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	lyon, _ := create(map[string]interface{}{"name": "Lyon", "kind": "site", "timezone": "Europe/Paris"})
+	building, _ := create(map[string]interface{}{"name": "Bâtiment A", "kind": "building", "parent_id": paris.ID})
+	floor, rec := create(map[string]interface{}{"name": "1er étage", "kind": "floor", "parent_id": building.ID})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	t.Run("hierarchy validation", func(t *testing.T) {
+		cases := []map[string]interface{}{
+			{"name": "Nowhere", "kind": "site", "timezone": "Mars/Olympus"},
+			{"name": "Nowhere", "kind": "site"},
+			{"name": "Floor", "kind": "floor", "parent_id": paris.ID},
+			{"name": "Building", "kind": "building"},
+			{"name": "Wing", "kind": "wing", "parent_id": paris.ID},
+		}
+		for _, payload := range cases {
+			if _, rec := create(payload); rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected %v to be refused, got %d", payload, rec.Code)
+			}
+		}
+	})
+
+	t.Run("site admins stay in their sites", func(t *testing.T) {
+		if _, rec := create(map[string]interface{}{"name": "Marseille", "kind": "site", "timezone": "Europe/Paris"}, paris.ID); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a site admin not to create sites, got %d", rec.Code)
+		}
+		if _, rec := create(map[string]interface{}{"name": "Bâtiment B", "kind": "building", "parent_id": paris.ID}, lyon.ID); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a site admin not to create buildings elsewhere, got %d", rec.Code)
+		}
+		if _, rec := create(map[string]interface{}{"name": "2e étage", "kind": "floor", "parent_id": building.ID}, paris.ID); rec.Code != http.StatusCreated {
+			t.Errorf("Expected a site admin to create floors of their site, got %d", rec.Code)
+		}
+
+		move := map[string]interface{}{"location_id": floor.ID}
+		if rec := request(http.MethodPut, move, handlers.UpdateResourceLocation, []uuid.UUID{lyon.ID}, "id", resource.ID); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a resource without location to be out of a site admin's scope, got %d", rec.Code)
+		}
+		if rec := request(http.MethodPut, move, handlers.UpdateResourceLocation, nil, "id", resource.ID); rec.Code != http.StatusOK {
+			t.Fatalf("Expected the resource to be attached, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodDelete, nil, handlers.DeleteResource, []uuid.UUID{lyon.ID}, "id", resource.ID); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a site admin not to delete resources elsewhere, got %d", rec.Code)
+		}
+	})
+
+	startAt := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	config.DB.Create(&models.Reservation{
+		ID: uuid.New(), UserID: user.ID, ResourceID: uuid.MustParse(resource.ID),
+		StartAt: startAt, EndAt: startAt.Add(time.Hour), Status: models.StatusPending,
+	})
+
+	t.Run("resources filtered by location", func(t *testing.T) {
+		names := func(locationID uuid.UUID) []string {
+			req := httptest.NewRequest(http.MethodGet, "/resources?location_id="+locationID.String(), nil)
+			rec := httptest.NewRecorder()
+			call(e.NewContext(req, rec), handlers.GetResources)
+			var resources []models.Resource
+			json.Unmarshal(rec.Body.Bytes(), &resources)
+			var names []string
+			for _, r := range resources {
+				names = append(names, r.Name)
+			}
+			return names
+		}
+		if got := names(paris.ID); len(got) != 1 || got[0] != resource.Name {
+			t.Errorf("Expected the site to include the resources of its floors, got %v", got)
+		}
+		if got := names(lyon.ID); len(got) != 0 {
+			t.Errorf("Expected no resource in another site, got %v", got)
+		}
+	})
+
+	t.Run("availability", func(t *testing.T) {
+		query := "/resources/availability?location_id=" + building.ID.String() +
+			"&from=" + startAt.Format(time.RFC3339) + "&to=" + startAt.Add(2*time.Hour).Format(time.RFC3339)
+		req := httptest.NewRequest(http.MethodGet, query, nil)
+		rec := httptest.NewRecorder()
+		call(e.NewContext(req, rec), handlers.GetResourceAvailability)
+
+		var resp struct {
+			Resources []handlers.ResourceAvailability `json:"resources"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if len(resp.Resources) != 1 {
+			t.Fatalf("Expected one resource, got %d: %s", len(resp.Resources), rec.Body.String())
+		}
+		if got := resp.Resources[0]; got.Booked != 1 || got.Available != 2 || got.Timezone != "Europe/Paris" {
+			t.Errorf("Unexpected availability: %+v", got)
+		}
+	})
+
+	t.Run("admin reservations scoped by site", func(t *testing.T) {
+		count := func(sites ...uuid.UUID) int {
+			rec := request(http.MethodGet, nil, handlers.GetAdminReservations, sites)
+			var reservations []models.Reservation
+			json.Unmarshal(rec.Body.Bytes(), &reservations)
+			n := 0
+			for _, r := range reservations {
+				if r.UserID == user.ID {
+					n++
+				}
+			}
+			return n
+		}
+		if count(paris.ID) != 1 || count(lyon.ID) != 0 {
+			t.Errorf("Expected the reservation to be listed for Paris admins only")
+		}
+	})
+
+	t.Run("locations in use are kept", func(t *testing.T) {
+		if rec := request(http.MethodDelete, nil, handlers.DeleteLocation, nil, "id", floor.ID.String()); rec.Code != http.StatusConflict {
+			t.Errorf("Expected a floor with resources to be kept, got %d", rec.Code)
+		}
+		if rec := request(http.MethodDelete, nil, handlers.DeleteLocation, []uuid.UUID{paris.ID}, "id", paris.ID.String()); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a site admin not to delete their site, got %d", rec.Code)
+		}
+	})
+}
@@ -11,13 +11,12 @@ import (
 	"spacebook/models"
 
 	"github.com/google/uuid"
-	"github.com/labstack/echo/v4"
 )
 
 func TestGetUserNotifications(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	// Create test user
 	userID := uuid.New()
@@ -45,9 +44,10 @@ func TestGetUserNotifications(t *testing.T) {
 	}()
 
 	t.Run("get user notifications", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodGet, "/notifications?userId="+userID.String(), nil)
+		req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", userID)
 
 		err := handlers.GetUserNotifications(c)
 		if err != nil {
@@ -66,12 +66,68 @@ func TestGetUserNotifications(t *testing.T) {
 		}
 	})
 
+	t.Run("coded notifications are rendered in the reader's language", func(t *testing.T) {
+		coded := models.Notification{
+			UserID:  &userID,
+			Type:    "reservation",
+			Code:    "reservation_auto_approved",
+			Params:  models.JSON(`{"resource":"Salle A"}`),
+			Message: "Votre réservation pour Salle A a été approuvée automatiquement",
+		}
+		config.DB.Create(&coded)
+
+		req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
+		req.Header.Set("Accept-Language", "en")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", userID)
+
+		if err := handlers.GetUserNotifications(c); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+
+		var notifications []models.Notification
+		json.Unmarshal(rec.Body.Bytes(), &notifications)
+
+		found := false
+		for _, n := range notifications {
+			if n.ID == coded.ID {
+				found = true
+				if n.Message != "Your reservation for Salle A was automatically approved" {
+					t.Errorf("Unexpected message %q", n.Message)
+				}
+			}
+		}
+		if !found {
+			t.Error("Expected the coded notification in the list")
+		}
+	})
+
+	t.Run("only admins and service accounts read another user's", func(t *testing.T) {
+		read := func(role string) int {
+			req := httptest.NewRequest(http.MethodGet, "/notifications?userId="+userID.String(), nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user_id", uuid.New())
+			c.Set("role", role)
+			call(c, handlers.GetUserNotifications)
+			return rec.Code
+		}
+
+		if code := read("user"); code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, code)
+		}
+		if code := read("admin"); code != http.StatusOK {
+			t.Errorf("Expected status %d for an admin, got %d", http.StatusOK, code)
+		}
+	})
+
 	t.Run("missing userId parameter", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		handlers.GetUserNotifications(c)
+		call(c, handlers.GetUserNotifications)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
@@ -82,7 +138,7 @@ func TestGetUserNotifications(t *testing.T) {
 func TestGetAdminNotifications(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	// Create test notification without user (admin notification)
 	notification := models.Notification{
@@ -115,12 +171,29 @@ func TestGetAdminNotifications(t *testing.T) {
 			t.Error("Expected at least one notification")
 		}
 	})
+
+	t.Run("site admins only get those of their sites", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/notifications", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("admin_sites", []uuid.UUID{uuid.New()})
+
+		call(c, handlers.GetAdminNotifications)
+
+		var notifications []models.Notification
+		json.Unmarshal(rec.Body.Bytes(), &notifications)
+		for _, n := range notifications {
+			if n.ID == notification.ID {
+				t.Error("Expected a notification without location to be out of a site admin's scope")
+			}
+		}
+	})
 }
 
 func TestMarkNotificationAsRead(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	// Create test notification
 	notification := models.Notification{
@@ -164,7 +237,7 @@ func TestMarkNotificationAsRead(t *testing.T) {
 		c.SetParamNames("id")
 		c.SetParamValues(uuid.New().String())
 
-		handlers.MarkNotificationAsRead(c)
+		call(c, handlers.MarkNotificationAsRead)
 
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
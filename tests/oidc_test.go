@@ -0,0 +1,334 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// mockProvider is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint checking the PKCE verifier.
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		grant, ok := p.codes[r.PostForm.Get("code")]
+		delete(p.codes, r.PostForm.Get("code"))
+		p.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+		token.Header["kid"] = "test-key"
+		idToken, _ := token.SignedString(key)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// authorize plays the user logging in at the provider: it returns the code
+// the provider would send back with the redirection.
+func (p *mockProvider) authorize(t *testing.T, authURL *url.URL, clientID string, claims jwt.MapClaims) string {
+	query := authURL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("expected a PKCE S256 challenge, got %s", authURL.RawQuery)
+	}
+
+	now := time.Now()
+	full := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code := "code-" + query.Get("state")[:8]
+	p.mu.Lock()
+	p.codes[code] = mockGrant{challenge: query.Get("code_challenge"), claims: full}
+	p.mu.Unlock()
+	return code
+}
+
+// useOIDC points the configuration to the provider for the test duration.
+func useOIDC(t *testing.T, p *mockProvider, groupRoles map[string]string) {
+	cfg := config.Get()
+	previous := cfg.OIDC
+	cfg.OIDC = config.OIDCConfig{
+		IssuerURL:    p.server.URL,
+		ClientID:     "spacebook",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		GroupsClaim:  "groups",
+		GroupRoles:   groupRoles,
+		DefaultRole:  "user",
+	}
+	t.Cleanup(func() { cfg.OIDC = previous })
+}
+
+// oidcLogin runs GET /auth/oidc/login and returns the authorization URL and
+// the flow cookie.
+func oidcLogin(t *testing.T, e *echo.Echo) (*url.URL, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+	rec := httptest.NewRecorder()
+	call(e.NewContext(req, rec), handlers.OIDCLogin)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Login: expected status %d, got %d: %s", http.StatusFound, rec.Code, rec.Body.String())
+	}
+
+	authURL, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("Login: expected one HttpOnly flow cookie, got %v", cookies)
+	}
+	return authURL, cookies[0]
+}
+
+func oidcCallback(e *echo.Echo, cookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	call(e.NewContext(req, rec), handlers.OIDCCallback)
+	return rec
+}
+
+func TestOIDCFlowChecks(t *testing.T) {
+	e := newTestEcho()
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := config.Get()
+		previous := cfg.OIDC
+		cfg.OIDC = config.OIDCConfig{}
+		defer func() { cfg.OIDC = previous }()
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+		rec := httptest.NewRecorder()
+		call(e.NewContext(req, rec), handlers.OIDCLogin)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+		}
+	})
+
+	p := newMockProvider(t)
+	useOIDC(t, p, nil)
+
+	t.Run("authorization request", func(t *testing.T) {
+		authURL, cookie := oidcLogin(t, e)
+		query := authURL.Query()
+
+		if !strings.HasPrefix(authURL.String(), p.server.URL+"/authorize") {
+			t.Errorf("Expected a redirection to the provider, got %s", authURL)
+		}
+		for _, param := range []string{"state", "nonce", "code_challenge"} {
+			if query.Get(param) == "" {
+				t.Errorf("Expected the %s parameter", param)
+			}
+		}
+		if query.Get("client_id") != "spacebook" || query.Get("response_type") != "code" {
+			t.Errorf("Unexpected authorization parameters: %s", authURL.RawQuery)
+		}
+		if cookie.Path != "/auth/oidc" || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("Unexpected cookie attributes: %+v", cookie)
+		}
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		_, cookie := oidcLogin(t, e)
+		rec := oidcCallback(e, cookie, url.Values{"code": {"x"}, "state": {"forged"}})
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_oidc_state") {
+			t.Errorf("Expected invalid_oidc_state, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("missing cookie", func(t *testing.T) {
+		authURL, _ := oidcLogin(t, e)
+		rec := oidcCallback(e, nil, url.Values{"code": {"x"}, "state": {authURL.Query().Get("state")}})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		rec := oidcCallback(e, nil, url.Values{"error": {"access_denied"}})
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "access_denied") {
+			t.Errorf("Expected oidc_login_failed with the provider error, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		authURL, cookie := oidcLogin(t, e)
+		code := p.authorize(t, authURL, "spacebook", jwt.MapClaims{"sub": "pkce"})
+
+		// A flow cookie from another login carries another verifier
+		_, otherCookie := oidcLogin(t, e)
+		rec := oidcCallback(e, otherCookie, url.Values{"code": {code}, "state": {authURL.Query().Get("state")}})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected the state of another flow to be refused, got %d", rec.Code)
+		}
+
+		p.mu.Lock()
+		grant := p.codes[code]
+		grant.challenge = "tampered"
+		p.codes[code] = grant
+		p.mu.Unlock()
+		rec = oidcCallback(e, cookie, url.Values{"code": {code}, "state": {authURL.Query().Get("state")}})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the exchange to fail, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		authURL, cookie := oidcLogin(t, e)
+		code := p.authorize(t, authURL, "another-client", jwt.MapClaims{"sub": "audience"})
+		rec := oidcCallback(e, cookie, url.Values{"code": {code}, "state": {authURL.Query().Get("state")}})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected an ID token for another client to be refused, got %d", rec.Code)
+		}
+	})
+}
+
+func TestOIDCProvisioning(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+	p := newMockProvider(t)
+	useOIDC(t, p, map[string]string{"spacebook-admins": "admin"})
+
+	login := func(claims jwt.MapClaims) *httptest.ResponseRecorder {
+		authURL, cookie := oidcLogin(t, e)
+		code := p.authorize(t, authURL, "spacebook", claims)
+		return oidcCallback(e, cookie, url.Values{"code": {code}, "state": {authURL.Query().Get("state")}})
+	}
+
+	defer config.DB.Where("email IN ?", []string{"sso@test.com", "local-sso@test.com"}).Delete(&models.User{})
+
+	var first handlers.AuthResponse
+	t.Run("just-in-time provisioning", func(t *testing.T) {
+		rec := login(jwt.MapClaims{
+			"sub":                "subject-1",
+			"email":              "SSO@test.com",
+			"email_verified":     true,
+			"preferred_username": "sso user",
+			"groups":             []string{"staff"},
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		json.Unmarshal(rec.Body.Bytes(), &first)
+		if first.Token == "" || first.User.Email != "sso@test.com" || first.User.Role != "user" {
+			t.Errorf("Unexpected provisioned user: %+v", first.User)
+		}
+	})
+
+	t.Run("group mapping updates the role", func(t *testing.T) {
+		rec := login(jwt.MapClaims{
+			"sub":    "subject-1",
+			"email":  "sso@test.com",
+			"groups": []string{"staff", "spacebook-admins"},
+		})
+		var resp handlers.AuthResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if resp.User.ID != first.User.ID || resp.User.Role != "admin" {
+			t.Errorf("Expected the same user promoted to admin, got %+v", resp.User)
+		}
+	})
+
+	t.Run("links a verified email", func(t *testing.T) {
+		local := models.User{Email: "local-sso@test.com", Username: "local", Role: "user"}
+		config.DB.Create(&local)
+
+		rec := login(jwt.MapClaims{"sub": "subject-2", "email": "local-sso@test.com", "email_verified": false})
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Expected an unverified email not to be linked, got %d", rec.Code)
+		}
+
+		rec = login(jwt.MapClaims{"sub": "subject-2", "email": "local-sso@test.com", "email_verified": "true"})
+		var resp handlers.AuthResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if resp.User.ID != local.ID {
+			t.Errorf("Expected the existing account to be linked, got %+v", resp.User)
+		}
+	})
+}
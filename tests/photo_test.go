@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spacebook/blob"
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/imaging"
+	"spacebook/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// testPNG encodes a width x height image, red on the left half.
+func testPNG(width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func useBlobStore(t *testing.T) blob.Store {
+	store, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := blob.Current()
+	blob.Use(store)
+	t.Cleanup(func() { blob.Use(previous) })
+	return store
+}
+
+func TestImaging(t *testing.T) {
+	img, err := imaging.Decode(testPNG(800, 400))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Format != "png" || img.ContentType != "image/png" {
+		t.Errorf("Unexpected format %q (%s)", img.Format, img.ContentType)
+	}
+
+	thumbnail := imaging.Thumbnail(img, 320)
+	if b := thumbnail.Bounds(); b.Dx() != 320 || b.Dy() != 160 {
+		t.Errorf("Expected a 320x160 thumbnail, got %dx%d", b.Dx(), b.Dy())
+	}
+	if r, _, b, _ := thumbnail.At(10, 80).RGBA(); r>>8 != 255 || b != 0 {
+		t.Error("Expected the thumbnail to keep the colours")
+	}
+
+	if small := imaging.Thumbnail(img, 1000); small.Bounds().Dx() != 800 {
+		t.Error("Expected smaller images not to be upscaled")
+	}
+
+	if _, err := imaging.Decode([]byte("<svg></svg>")); err != imaging.ErrUnsupported {
+		t.Errorf("Expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestBlobLocalStore(t *testing.T) {
+	store := useBlobStore(t)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "resources/a/photos/b", strings.NewReader("content")); err != nil {
+		t.Fatal(err)
+	}
+	file, err := store.Open(ctx, "resources/a/photos/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+	if string(content) != "content" {
+		t.Errorf("Unexpected content %q", content)
+	}
+
+	if err := store.Delete(ctx, "resources/a/photos/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(ctx, "resources/a/photos/b"); err != blob.ErrNotFound {
+		t.Errorf("Expected ErrNotFound after deletion, got %v", err)
+	}
+	if err := store.Delete(ctx, "resources/a/photos/b"); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, got %v", err)
+	}
+
+	for _, key := range []string{"", "../escape", "a//b", "a/./b", "/absolute"} {
+		if err := store.Put(ctx, key, strings.NewReader("x")); err != blob.ErrInvalidKey {
+			t.Errorf("Expected key %q to be refused, got %v", key, err)
+		}
+	}
+}
+
+func TestResourcePhotos(t *testing.T) {
+	setupTestDB()
+	useBlobStore(t)
+
+	e := newTestEcho()
+	resource := createTestResource(t, 1)
+	defer func() {
+		config.DB.Where("resource_id = ?", resource.ID).Delete(&models.ResourcePhoto{})
+		config.DB.Delete(&models.Resource{}, "id = ?", resource.ID)
+	}()
+
+	upload := func(data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("photo", "photo.png")
+		part.Write(data)
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("role", "admin")
+		c.SetParamNames("id")
+		c.SetParamValues(resource.ID)
+		call(c, handlers.UploadResourcePhoto)
+		return rec
+	}
+
+	get := func(photo models.ResourcePhoto, h echo.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.SetParamNames("id", "photo_id")
+		c.SetParamValues(photo.ResourceID, photo.ID.String())
+		call(c, h)
+		return rec
+	}
+
+	rec := upload(testPNG(1000, 500))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	var photo models.ResourcePhoto
+	json.Unmarshal(rec.Body.Bytes(), &photo)
+	if photo.Width != 1000 || photo.Height != 500 || !strings.Contains(rec.Body.String(), `"thumbnail_url":"/resources/`) {
+		t.Errorf("Unexpected photo: %s", rec.Body.String())
+	}
+
+	t.Run("served with its thumbnail", func(t *testing.T) {
+		if rec := get(photo, handlers.GetResourcePhoto); rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "image/png" {
+			t.Errorf("Expected the photo, got %d", rec.Code)
+		}
+
+		rec := get(photo, handlers.GetResourcePhotoThumbnail)
+		thumbnail, _, err := image.DecodeConfig(rec.Body)
+		if err != nil || thumbnail.Width != 320 || thumbnail.Height != 160 {
+			t.Errorf("Expected a 320x160 thumbnail, got %+v (%v)", thumbnail, err)
+		}
+	})
+
+	t.Run("refused uploads", func(t *testing.T) {
+		if rec := upload([]byte("not an image")); rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected an unsupported format to be refused, got %d", rec.Code)
+		}
+
+		cfg := config.Get()
+		previous := cfg.Storage.MaxUploadSize
+		cfg.Storage.MaxUploadSize = 100
+		defer func() { cfg.Storage.MaxUploadSize = previous }()
+		if rec := upload(testPNG(200, 200)); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected a large upload to be refused, got %d", rec.Code)
+		}
+	})
+
+	t.Run("deleted with its files", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+		c.Set("role", "admin")
+		c.SetParamNames("id", "photo_id")
+		c.SetParamValues(resource.ID, photo.ID.String())
+		call(c, handlers.DeleteResourcePhoto)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+		}
+		if _, err := blob.Current().Open(context.Background(), photo.Key()); err != blob.ErrNotFound {
+			t.Errorf("Expected the file to be deleted, got %v", err)
+		}
+	})
+}
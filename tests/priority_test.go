@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPriorityReservations(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	admin := models.User{ID: uuid.New(), Email: "prioritytest@test.com", Username: "prioritytest", Role: "admin"}
+	config.DB.Create(&admin)
+	room := models.Resource{ID: uuid.New().String(), Name: "Priority Room A", Type: "room", Capacity: 1, Status: "available"}
+	spare := models.Resource{ID: uuid.New().String(), Name: "Priority Room B", Type: "room", Capacity: 1, Status: "available"}
+	pool := models.Resource{ID: uuid.New().String(), Name: "Priority Pool", Type: "equipment", Capacity: 2, Status: "available"}
+	config.DB.Create(&room)
+	config.DB.Create(&spare)
+	config.DB.Create(&pool)
+	defer func() {
+		config.DB.Where("user_id IN ?", []uuid.UUID{user.ID, admin.ID}).Delete(&models.Notification{})
+		cleanupTestData(user.Email, pool.Name)
+		cleanupTestData(user.Email, room.Name)
+		cleanupTestData(admin.Email, spare.Name)
+		config.DB.Where("user_id = ?", admin.ID).Delete(&models.Reservation{})
+		config.DB.Delete(&admin)
+	}()
+
+	startAt := time.Now().Add(72 * time.Hour).Truncate(time.Hour)
+	booking := models.Reservation{ID: uuid.New(), UserID: user.ID, ResourceID: uuid.MustParse(room.ID),
+		StartAt: startAt, EndAt: startAt.Add(time.Hour), Status: models.StatusApproved, Quantity: 1}
+	config.DB.Create(&booking)
+
+	// bookFor makes a priority reservation as the admin
+	bookFor := func(resource models.Resource, start, end time.Time, priority int, reason string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"resource_id": resource.ID,
+			"start_at":    start,
+			"end_at":      end,
+			"priority":    priority,
+			"reason":      reason,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", admin.ID)
+		c.Set("role", "admin")
+		call(c, handlers.CreatePriorityReservation)
+		return rec
+	}
+	book := func(priority int, reason string) *httptest.ResponseRecorder {
+		return bookFor(room, startAt, startAt.Add(time.Hour), priority, reason)
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		if rec := book(5, " "); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected a reason to be required, got %d", rec.Code)
+		}
+		if rec := book(models.MaxPriority+1, "Comité"); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected the priority to be bounded, got %d", rec.Code)
+		}
+	})
+
+	t.Run("lower priorities are bumped", func(t *testing.T) {
+		rec := book(5, "Comité de direction")
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), spare.Name) {
+			t.Errorf("Expected the spare room among the alternatives, got %s", rec.Body.String())
+		}
+
+		var bumped models.Reservation
+		config.DB.First(&bumped, "id = ?", booking.ID)
+		if bumped.Status != models.StatusBumped || bumped.BumpedByID == nil {
+			t.Fatalf("Expected the reservation to be bumped, got %+v", bumped)
+		}
+
+		var notification models.Notification
+		config.DB.Where("user_id = ? AND code = ?", user.ID, "reservation_bumped").First(&notification)
+		if !strings.Contains(notification.Message, spare.Name) || !strings.Contains(notification.Message, "Comité de direction") {
+			t.Errorf("Expected the owner to be offered the spare room, got %q", notification.Message)
+		}
+
+		var audits int64
+		config.DB.Model(&models.AuditEvent{}).
+			Where("action = ? AND entity_id = ? AND actor_id = ?", "reservation.bump", booking.ID.String(), admin.ID).
+			Count(&audits)
+		if audits != 1 {
+			t.Errorf("Expected the bump to be audited as the admin, got %d events", audits)
+		}
+	})
+
+	t.Run("equal or higher priorities are kept", func(t *testing.T) {
+		rec := book(5, "Autre réunion")
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "priority_conflict") {
+			t.Errorf("Expected priority_conflict, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("only the reservations held at the busiest moment are bumped", func(t *testing.T) {
+		// Both units in the first hour, then one unit booked later on
+		first := models.Reservation{ID: uuid.New(), UserID: user.ID, ResourceID: uuid.MustParse(pool.ID),
+			StartAt: startAt, EndAt: startAt.Add(time.Hour), Status: models.StatusApproved, Quantity: 2}
+		config.DB.Create(&first)
+		second := models.Reservation{ID: uuid.New(), UserID: user.ID, ResourceID: uuid.MustParse(pool.ID),
+			StartAt: startAt.Add(time.Hour), EndAt: startAt.Add(2 * time.Hour), Status: models.StatusApproved, Quantity: 1}
+		config.DB.Create(&second)
+
+		rec := bookFor(pool, startAt, startAt.Add(2*time.Hour), 5, "Formation")
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+
+		config.DB.First(&first, "id = ?", first.ID)
+		config.DB.First(&second, "id = ?", second.ID)
+		if first.Status != models.StatusBumped || second.Status != models.StatusApproved {
+			t.Errorf("Expected only the first reservation to be bumped, got %s and %s", first.Status, second.Status)
+		}
+	})
+}
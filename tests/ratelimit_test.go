@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/middleware"
+	"spacebook/ratelimit"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeClock is a manually advanced clock for the memory store.
+type fakeClock struct{ now time.Time }
+
+func (f *fakeClock) Now() time.Time          { return f.now }
+func (f *fakeClock) Advance(d time.Duration) { f.now = f.now.Add(d) }
+func newFakeClock() *fakeClock               { return &fakeClock{now: time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)} }
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	store := ratelimit.NewMemoryStore()
+	store.Clock = clock.Now
+
+	limit := ratelimit.PerMinute(60, 3) // one token per second, burst of 3
+
+	for i := 0; i < 3; i++ {
+		if d, _ := store.Allow(ctx, "k", limit); !d.Allowed {
+			t.Fatalf("Request %d within the burst was refused", i)
+		}
+	}
+
+	d, _ := store.Allow(ctx, "k", limit)
+	if d.Allowed {
+		t.Fatal("Expected the request beyond the burst to be refused")
+	}
+	if d.RetryAfter <= 0 || d.RetryAfter > time.Second {
+		t.Errorf("Expected a retry delay of at most one second, got %v", d.RetryAfter)
+	}
+
+	if d, _ := store.Allow(ctx, "other", limit); !d.Allowed {
+		t.Error("Expected buckets to be independent per key")
+	}
+
+	clock.Advance(time.Second)
+	if d, _ := store.Allow(ctx, "k", limit); !d.Allowed {
+		t.Error("Expected a token to be refilled after one second")
+	}
+
+	// Refill is capped at the burst
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		store.Allow(ctx, "k", limit)
+	}
+	if d, _ := store.Allow(ctx, "k", limit); d.Allowed {
+		t.Error("Expected the bucket to hold at most the burst")
+	}
+}
+
+func TestRateLimitLockout(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	store := ratelimit.NewMemoryStore()
+	store.Clock = clock.Now
+
+	policy := ratelimit.LockoutPolicy{
+		MaxFailures: 3,
+		Base:        30 * time.Second,
+		Max:         2 * time.Minute,
+		Window:      15 * time.Minute,
+	}
+
+	for i := 0; i < 2; i++ {
+		if until, _ := store.RecordFailure(ctx, "acct", policy); !until.IsZero() {
+			t.Fatalf("Failure %d should not lock the key", i+1)
+		}
+	}
+
+	// Lockout doubles on each failure past the threshold, up to Max
+	for _, want := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute} {
+		until, _ := store.RecordFailure(ctx, "acct", policy)
+		if got := until.Sub(clock.Now()); got != want {
+			t.Errorf("Expected a lockout of %v, got %v", want, got)
+		}
+	}
+
+	if until, _ := store.LockedUntil(ctx, "acct"); until.IsZero() {
+		t.Error("Expected the key to be locked")
+	}
+
+	clock.Advance(2*time.Minute + time.Second)
+	if until, _ := store.LockedUntil(ctx, "acct"); !until.IsZero() {
+		t.Error("Expected the lockout to expire")
+	}
+
+	t.Run("failures outside the window are forgotten", func(t *testing.T) {
+		store.RecordFailure(ctx, "slow", policy)
+		store.RecordFailure(ctx, "slow", policy)
+		clock.Advance(16 * time.Minute)
+		if until, _ := store.RecordFailure(ctx, "slow", policy); !until.IsZero() {
+			t.Error("Expected old failures not to count")
+		}
+	})
+
+	t.Run("reset clears the failures", func(t *testing.T) {
+		store.RecordFailure(ctx, "reset", policy)
+		store.RecordFailure(ctx, "reset", policy)
+		store.Reset(ctx, "reset")
+		if until, _ := store.RecordFailure(ctx, "reset", policy); !until.IsZero() {
+			t.Error("Expected the counter to restart after a reset")
+		}
+	})
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := config.Get()
+	previousConfig := cfg.RateLimit
+	previousStore := ratelimit.Current()
+	cfg.RateLimit.APIRequestsPerMinute = 1
+	cfg.RateLimit.APIBurst = 2
+	ratelimit.Use(ratelimit.NewMemoryStore())
+	defer func() {
+		cfg.RateLimit = previousConfig
+		ratelimit.Use(previousStore)
+	}()
+
+	userID := uuid.New()
+	e := newTestEcho()
+	e.GET("/limited", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("X-User") != "" {
+				c.Set("user_id", userID)
+			}
+			return next(c)
+		}
+	}, middleware.RateLimit)
+
+	serve := func(user bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		if user {
+			req.Header.Set("X-User", "1")
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(true); rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status %d, got %d", i, http.StatusOK, rec.Code)
+		}
+	}
+
+	rec := serve(true)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// Anonymous requests are limited per IP, separately from the user
+	if rec := serve(false); rec.Code != http.StatusOK {
+		t.Errorf("Expected the anonymous bucket to be separate, got status %d", rec.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -52,7 +53,7 @@ func cleanupTestData(userEmail string, resourceName string) {
 func TestCreateReservation(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	user := createTestUser(t)
 	resource := createTestResource(t, 2)
@@ -76,6 +77,7 @@ func TestCreateReservation(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
 
 		err := handlers.CreateReservation(c)
 		if err != nil {
@@ -111,8 +113,9 @@ func TestCreateReservation(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
 
-		handlers.CreateReservation(c)
+		call(c, handlers.CreateReservation)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
@@ -136,19 +139,44 @@ func TestCreateReservation(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
 
-		handlers.CreateReservation(c)
+		call(c, handlers.CreateReservation)
 
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
 		}
 	})
+
+	t.Run("users only book for themselves", func(t *testing.T) {
+		startAt := time.Now().Add(24 * time.Hour)
+		payload := map[string]interface{}{
+			"user_id":     user.ID.String(),
+			"resource_id": resource.ID,
+			"start_at":    startAt.Format(time.RFC3339),
+			"end_at":      startAt.Add(time.Hour).Format(time.RFC3339),
+		}
+		body, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest(http.MethodPost, "/reservations", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", uuid.New())
+		c.Set("role", "user")
+
+		call(c, handlers.CreateReservation)
+
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "book_on_behalf_not_allowed") {
+			t.Errorf("Expected book_on_behalf_not_allowed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
 }
 
 func TestCapacityCheck(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	user := createTestUser(t)
 	// Resource with capacity of 2
@@ -173,8 +201,9 @@ func TestCapacityCheck(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
 
-		handlers.CreateReservation(c)
+		call(c, handlers.CreateReservation)
 
 		if rec.Code != http.StatusCreated {
 			t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
@@ -195,8 +224,9 @@ func TestCapacityCheck(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
 
-		handlers.CreateReservation(c)
+		call(c, handlers.CreateReservation)
 
 		if rec.Code != http.StatusCreated {
 			t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
@@ -217,8 +247,9 @@ func TestCapacityCheck(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
 
-		handlers.CreateReservation(c)
+		call(c, handlers.CreateReservation)
 
 		if rec.Code != http.StatusConflict {
 			t.Errorf("Expected status %d, got %d. Body: %s", http.StatusConflict, rec.Code, rec.Body.String())
@@ -227,8 +258,13 @@ func TestCapacityCheck(t *testing.T) {
 		var response map[string]interface{}
 		json.Unmarshal(rec.Body.Bytes(), &response)
 
-		if response["error"] != "Ressource complète pour ce créneau horaire" {
-			t.Errorf("Expected capacity error message, got: %v", response["error"])
+		if response["code"] != "resource_full" {
+			t.Errorf("Expected capacity error code, got: %v", response["code"])
+		}
+
+		details, _ := response["details"].(map[string]interface{})
+		if details["available"] != float64(0) {
+			t.Errorf("Expected no available unit in details, got: %v", details)
 		}
 	})
 
@@ -249,11 +285,408 @@ func TestCapacityCheck(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
 
-		handlers.CreateReservation(c)
+		call(c, handlers.CreateReservation)
 
 		if rec.Code != http.StatusCreated {
 			t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
 		}
 	})
 }
+
+func TestReservationQuantity(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	resource := createTestResource(t, 5)
+	defer cleanupTestData("reservationtest@test.com", "Test Resource")
+
+	startAt := time.Now().Add(72 * time.Hour).Truncate(time.Hour)
+	reserve := func(quantity int, start time.Time) *httptest.ResponseRecorder {
+		payload := map[string]interface{}{
+			"user_id":     user.ID.String(),
+			"resource_id": resource.ID,
+			"start_at":    start.Format(time.RFC3339),
+			"end_at":      start.Add(2 * time.Hour).Format(time.RFC3339),
+		}
+		if quantity != 0 {
+			payload["quantity"] = quantity
+		}
+		body, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest(http.MethodPost, "/reservations", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
+		call(c, handlers.CreateReservation)
+		return rec
+	}
+
+	t.Run("quantity validation", func(t *testing.T) {
+		if rec := reserve(6, startAt); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "quantity_exceeds_capacity") {
+			t.Errorf("Expected quantity_exceeds_capacity, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := reserve(-1, startAt); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected a negative quantity to be refused, got %d", rec.Code)
+		}
+	})
+
+	t.Run("overlapping quantities are summed", func(t *testing.T) {
+		if rec := reserve(3, startAt); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+
+		// Defaults to one unit
+		rec := reserve(0, startAt.Add(time.Hour))
+		var reservation models.Reservation
+		json.Unmarshal(rec.Body.Bytes(), &reservation)
+		if rec.Code != http.StatusCreated || reservation.Quantity != 1 {
+			t.Fatalf("Expected one unit to be booked, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		// 4 of 5 units held: 2 more do not fit, the error tells what is left
+		rec = reserve(2, startAt)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+		}
+		var body struct {
+			Error struct {
+				Details map[string]int `json:"details"`
+			} `json:"error"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if details := body.Error.Details; details["booked"] != 4 || details["available"] != 1 {
+			t.Errorf("Expected 4 booked and 1 available, got %v", details)
+		}
+
+		if rec := reserve(1, startAt); rec.Code != http.StatusCreated {
+			t.Errorf("Expected the last unit to be booked, got %d", rec.Code)
+		}
+	})
+
+	t.Run("back-to-back reservations do not add up", func(t *testing.T) {
+		later := startAt.Add(4 * time.Hour)
+		for _, start := range []time.Time{later, later.Add(2 * time.Hour)} {
+			if rec := reserve(3, start); rec.Code != http.StatusCreated {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+			}
+		}
+
+		// Overlaps both, but at most 3 units are held at once
+		if rec := reserve(2, later.Add(time.Hour)); rec.Code != http.StatusCreated {
+			t.Errorf("Expected the 2 units left to be booked, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := reserve(1, later.Add(time.Hour)); rec.Code != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+		}
+	})
+
+	t.Run("partial availability", func(t *testing.T) {
+		query := "/resources/availability?type=equipment&from=" + startAt.Format(time.RFC3339) +
+			"&to=" + startAt.Add(30*time.Minute).Format(time.RFC3339)
+		req := httptest.NewRequest(http.MethodGet, query, nil)
+		rec := httptest.NewRecorder()
+		call(e.NewContext(req, rec), handlers.GetResourceAvailability)
+
+		var resp struct {
+			Resources []handlers.ResourceAvailability `json:"resources"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		for _, entry := range resp.Resources {
+			if entry.Resource.ID == resource.ID && (entry.Booked != 4 || entry.Available != 1 || entry.State != handlers.AvailabilityPartial) {
+				t.Errorf("Expected 4 units booked out of 5, got %+v", entry)
+			}
+		}
+	})
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	resource := createTestResource(t, 2)
+
+	defer func() {
+		config.DB.Where("resource_id = ?", resource.ID).Delete(&models.ResourceApprover{})
+		cleanupTestData("reservationtest@test.com", "Test Resource")
+	}()
+
+	startAt := time.Now().Add(96 * time.Hour)
+	endAt := startAt.Add(1 * time.Hour)
+
+	t.Run("auto-approve resource - reservation approved immediately", func(t *testing.T) {
+		config.DB.Model(&resource).Update("approval_policy", models.ApprovalAuto)
+
+		payload := map[string]interface{}{
+			"user_id":     user.ID.String(),
+			"resource_id": resource.ID,
+			"start_at":    startAt.Format(time.RFC3339),
+			"end_at":      endAt.Format(time.RFC3339),
+		}
+		body, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest(http.MethodPost, "/reservations", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
+
+		call(c, handlers.CreateReservation)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+
+		var response models.Reservation
+		json.Unmarshal(rec.Body.Bytes(), &response)
+
+		if response.Status != models.StatusApproved {
+			t.Errorf("Expected status 'approved', got '%s'", response.Status)
+		}
+	})
+
+	t.Run("delegated resource - only designated approvers can decide", func(t *testing.T) {
+		config.DB.Model(&resource).Update("approval_policy", models.ApprovalDelegated)
+
+		reservation := models.Reservation{
+			ID:         uuid.New(),
+			UserID:     user.ID,
+			ResourceID: uuid.MustParse(resource.ID),
+			StartAt:    startAt.Add(2 * time.Hour),
+			EndAt:      endAt.Add(2 * time.Hour),
+			Status:     models.StatusPending,
+		}
+		config.DB.Create(&reservation)
+
+		approve := func(userID uuid.UUID) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/reservations/"+reservation.ID.String()+"/approve", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(reservation.ID.String())
+			c.Set("user_id", userID)
+			c.Set("role", "user")
+
+			call(c, handlers.ApproveReservation)
+			return rec
+		}
+
+		if rec := approve(user.ID); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d for non-approver, got %d", http.StatusForbidden, rec.Code)
+		}
+
+		config.DB.Create(&models.ResourceApprover{ResourceID: resource.ID, UserID: user.ID})
+
+		if rec := approve(user.ID); rec.Code != http.StatusOK {
+			t.Errorf("Expected status %d for approver, got %d. Body: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("released reservations - approval cannot overbook", func(t *testing.T) {
+		slotStart, slotEnd := startAt.Add(10*time.Hour), endAt.Add(10*time.Hour)
+		newReservation := func(status string, quantity int) models.Reservation {
+			reservation := models.Reservation{
+				ID:         uuid.New(),
+				UserID:     user.ID,
+				ResourceID: uuid.MustParse(resource.ID),
+				StartAt:    slotStart,
+				EndAt:      slotEnd,
+				Status:     status,
+				Quantity:   quantity,
+			}
+			config.DB.Create(&reservation)
+			return reservation
+		}
+		approve := func(reservation models.Reservation) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/admin/reservations/"+reservation.ID.String()+"/approve", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(reservation.ID.String())
+			c.Set("user_id", user.ID)
+			c.Set("role", "admin")
+
+			call(c, handlers.ApproveReservation)
+			return rec
+		}
+
+		rejected := newReservation(models.StatusRejected, 1)
+		taken := newReservation(models.StatusApproved, 2)
+
+		if rec := approve(rejected); rec.Code != http.StatusConflict {
+			t.Errorf("Expected status %d when the capacity was taken, got %d. Body: %s", http.StatusConflict, rec.Code, rec.Body.String())
+		}
+
+		config.DB.Model(&taken).Update("status", models.StatusCancelled)
+		if rec := approve(rejected); rec.Code != http.StatusOK {
+			t.Errorf("Expected status %d once the capacity is free, got %d. Body: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		noShow := newReservation(models.StatusNoShow, 1)
+		if rec := approve(noShow); rec.Code != http.StatusConflict {
+			t.Errorf("Expected status %d for a no-show, got %d", http.StatusConflict, rec.Code)
+		}
+	})
+}
+
+func TestReservationSuggestions(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	resource := createTestResource(t, 1)
+	similar := models.Resource{ID: uuid.New().String(), Name: "Suggestion Printer", Type: "equipment", Category: "printer", Capacity: 2, Status: "available"}
+	other := models.Resource{ID: uuid.New().String(), Name: "Suggestion Scanner", Type: "equipment", Category: "scanner", Capacity: 2, Status: "available"}
+	config.DB.Create(&similar)
+	config.DB.Create(&other)
+	defer func() {
+		cleanupTestData("reservationtest@test.com", "Test Resource")
+		config.DB.Where("name IN ?", []string{similar.Name, other.Name}).Delete(&models.Resource{})
+	}()
+
+	startAt := time.Now().Add(96 * time.Hour).Truncate(time.Hour)
+	reserve := func(start time.Time) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"user_id":     user.ID.String(),
+			"resource_id": resource.ID,
+			"start_at":    start.Format(time.RFC3339),
+			"end_at":      start.Add(2 * time.Hour).Format(time.RFC3339),
+		})
+		req := httptest.NewRequest(http.MethodPost, "/reservations", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
+		call(c, handlers.CreateReservation)
+		return rec
+	}
+
+	if rec := reserve(startAt); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	rec := reserve(startAt.Add(time.Hour))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+	}
+	var body struct {
+		Error struct {
+			Details struct {
+				Suggestions handlers.Suggestions `json:"suggestions"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	suggestions := body.Error.Details.Suggestions
+
+	// The nearest free slot starts when the first reservation ends
+	if len(suggestions.Slots) == 0 || !suggestions.Slots[0].StartAt.Equal(startAt.Add(2*time.Hour)) {
+		t.Errorf("Expected the nearest slot at %s, got %+v", startAt.Add(2*time.Hour), suggestions.Slots)
+	}
+
+	found := false
+	for _, suggestion := range suggestions.Resources {
+		if suggestion.Resource.ID == other.ID {
+			t.Errorf("Expected resources of another category not to be suggested")
+		}
+		found = found || suggestion.Resource.ID == similar.ID
+	}
+	if !found {
+		t.Errorf("Expected the similar printer to be suggested, got %+v", suggestions.Resources)
+	}
+}
+
+func TestReservationBuffers(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	resource := createTestResource(t, 1)
+	config.DB.Model(&resource).Updates(map[string]interface{}{"setup_minutes": 10, "teardown_minutes": 20})
+	defer cleanupTestData("reservationtest@test.com", "Test Resource")
+
+	startAt := time.Now().Add(120 * time.Hour).Truncate(time.Hour)
+	reserve := func(start time.Time) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"user_id":     user.ID.String(),
+			"resource_id": resource.ID,
+			"start_at":    start.Format(time.RFC3339),
+			"end_at":      start.Add(time.Hour).Format(time.RFC3339),
+		})
+		req := httptest.NewRequest(http.MethodPost, "/reservations", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user_id", user.ID)
+		call(c, handlers.CreateReservation)
+		return rec
+	}
+
+	rec := reserve(startAt)
+	var reservation models.Reservation
+	json.Unmarshal(rec.Body.Bytes(), &reservation)
+	if rec.Code != http.StatusCreated || !reservation.EndAt.Equal(startAt.Add(time.Hour)) {
+		t.Fatalf("Expected the booked time not to include the buffers, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 20 minutes of teardown, then 10 of setup
+	if rec := reserve(startAt.Add(time.Hour + 20*time.Minute)); rec.Code != http.StatusConflict {
+		t.Errorf("Expected the turnaround after the reservation to be kept free, got %d", rec.Code)
+	}
+	if rec := reserve(startAt.Add(-time.Hour - 20*time.Minute)); rec.Code != http.StatusConflict {
+		t.Errorf("Expected the turnaround before the reservation to be kept free, got %d", rec.Code)
+	}
+	if rec := reserve(startAt.Add(time.Hour + 30*time.Minute)); rec.Code != http.StatusCreated {
+		t.Errorf("Expected a reservation after the turnaround to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	query := "/resources/availability?type=equipment&from=" + startAt.Add(-30*time.Minute).Format(time.RFC3339) +
+		"&to=" + startAt.Add(-10*time.Minute).Format(time.RFC3339)
+	req := httptest.NewRequest(http.MethodGet, query, nil)
+	rec = httptest.NewRecorder()
+	call(e.NewContext(req, rec), handlers.GetResourceAvailability)
+	var resp struct {
+		Resources []handlers.ResourceAvailability `json:"resources"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	for _, entry := range resp.Resources {
+		if entry.Resource.ID == resource.ID && entry.State != handlers.AvailabilityFull {
+			t.Errorf("Expected the resource to be unavailable during the setup, got %+v", entry)
+		}
+	}
+}
+
+func TestPeakQuantity(t *testing.T) {
+	start := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	at := func(hours float64) time.Time { return start.Add(time.Duration(hours * float64(time.Hour))) }
+	held := func(from, to float64, quantity int) models.Reservation {
+		return models.Reservation{StartAt: at(from), EndAt: at(to), Quantity: quantity}
+	}
+
+	cases := []struct {
+		name         string
+		reservations []models.Reservation
+		turnaround   time.Duration
+		want         int
+	}{
+		{"none", nil, 0, 0},
+		{"back to back", []models.Reservation{held(0, 1, 2), held(1, 2, 3)}, 0, 3},
+		{"back to back with turnaround", []models.Reservation{held(0, 1, 2), held(1, 2, 3)}, 30 * time.Minute, 5},
+		{"nested", []models.Reservation{held(0, 4, 1), held(1, 2, 2), held(3, 4, 2)}, 0, 3},
+		{"outside the period", []models.Reservation{held(-2, -1, 4), held(4, 5, 4), held(1, 3, 1)}, 0, 1},
+		{"turnaround reaching into the period", []models.Reservation{held(-2, -1, 4)}, 90 * time.Minute, 4},
+	}
+	for _, tc := range cases {
+		if got := models.PeakQuantity(tc.reservations, tc.turnaround, at(0), at(4)); got != tc.want {
+			t.Errorf("%s: expected a peak of %d units, got %d", tc.name, tc.want, got)
+		}
+	}
+}
@@ -17,7 +17,7 @@ import (
 func TestGetResources(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	// Create test resource
 	resource := models.Resource{
@@ -57,7 +57,7 @@ func TestGetResources(t *testing.T) {
 func TestCreateResource(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	defer config.DB.Where("name = ?", "New Test Resource").Delete(&models.Resource{})
 
@@ -108,7 +108,7 @@ func TestCreateResource(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		handlers.CreateResource(c)
+		call(c, handlers.CreateResource)
 
 		var resource models.Resource
 		json.Unmarshal(rec.Body.Bytes(), &resource)
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spacebook/middleware"
+	"spacebook/schedule"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Reservations have no recurrence: each occurrence is booked on its own, with
+// instants in UTC, so the DST cases below cover local days and opening hours.
+func TestSchedule(t *testing.T) {
+	paris, err := schedule.Location("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := schedule.Location("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc, _ := schedule.Location(""); loc != time.UTC {
+		t.Errorf("Expected no timezone to mean UTC, got %s", loc)
+	}
+
+	t.Run("days across DST transitions", func(t *testing.T) {
+		cases := []struct {
+			loc    *time.Location
+			day    string
+			length time.Duration
+		}{
+			{paris, "2025-03-30", 23 * time.Hour},
+			{paris, "2025-10-26", 25 * time.Hour},
+			{newYork, "2025-03-09", 23 * time.Hour},
+			{newYork, "2025-11-02", 25 * time.Hour},
+			{paris, "2025-06-15", 24 * time.Hour},
+		}
+		for _, tc := range cases {
+			start, err := schedule.ParseDate(tc.day, tc.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			end := start.AddDate(0, 0, 1)
+			if got := end.Sub(start); got != tc.length {
+				t.Errorf("Expected %s in %s to last %s, got %s", tc.day, tc.loc, tc.length, got)
+			}
+			if local := start.In(tc.loc); local.Hour() != 0 || local.Format("2006-01-02") != tc.day {
+				t.Errorf("Expected %s to start at local midnight, got %s", tc.day, local)
+			}
+		}
+
+		// RFC 3339 instants keep their own offset
+		instant, _ := schedule.ParseDate("2025-03-30T08:00:00+02:00", time.UTC)
+		if !instant.Equal(time.Date(2025, 3, 30, 6, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected the offset to be honoured, got %s", instant.UTC())
+		}
+	})
+
+	t.Run("opening hours keep their wall-clock times", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			from, to time.Time
+			want     time.Duration
+		}{
+			// The clocks jump from 02:00 to 03:00: opening is still 08:00
+			{"spring forward morning", time.Date(2025, 3, 30, 0, 0, 0, 0, paris), time.Date(2025, 3, 30, 12, 0, 0, 0, paris), 4 * time.Hour},
+			// The clocks go back from 03:00 to 02:00
+			{"fall back morning", time.Date(2025, 10, 26, 0, 0, 0, 0, paris), time.Date(2025, 10, 26, 12, 0, 0, 0, paris), 4 * time.Hour},
+			{"spring forward day", time.Date(2025, 3, 30, 0, 0, 0, 0, paris), time.Date(2025, 3, 31, 0, 0, 0, 0, paris), 10 * time.Hour},
+			// Two weeks spanning the change: 14 days of 10 hours
+			{"week", time.Date(2025, 10, 20, 0, 0, 0, 0, newYork), time.Date(2025, 10, 27, 0, 0, 0, 0, newYork).AddDate(0, 0, 7), 14 * 10 * time.Hour},
+		}
+		for _, tc := range cases {
+			if got := schedule.OpenDuration(tc.from, tc.to, tc.from.Location(), 8*time.Hour, 18*time.Hour, true); got != tc.want {
+				t.Errorf("%s: expected %s open, got %s", tc.name, tc.want, got)
+			}
+		}
+
+		// Weekdays only: the DST Sunday is skipped
+		week := schedule.OpenDuration(time.Date(2025, 3, 24, 0, 0, 0, 0, paris), time.Date(2025, 3, 31, 0, 0, 0, 0, paris), paris, 8*time.Hour, 18*time.Hour, false)
+		if week != 50*time.Hour {
+			t.Errorf("Expected 5 days of 10 hours, got %s", week)
+		}
+	})
+
+	t.Run("bookings across a day boundary", func(t *testing.T) {
+		// 22:00 CEST to 02:00 CET in Paris on the night the clocks go back:
+		// 5 hours, split over two local days. The end is given in UTC as
+		// 02:00 happens twice that night.
+		start := time.Date(2025, 10, 25, 22, 0, 0, 0, paris)
+		end := time.Date(2025, 10, 26, 1, 0, 0, 0, time.UTC)
+		if got := end.Sub(start); got != 5*time.Hour {
+			t.Fatalf("Expected 5 hours, got %s", got)
+		}
+		evening := schedule.OpenDuration(start, end, paris, 20*time.Hour, 24*time.Hour, true)
+		night := schedule.OpenDuration(start, end, paris, 0, 4*time.Hour, true)
+		if evening != 2*time.Hour || night != 3*time.Hour {
+			t.Errorf("Expected 2 hours on the first day and 3 on the second, got %s and %s", evening, night)
+		}
+
+		// The same booking read from New York stays the same instants
+		if got := schedule.Format(start, newYork); got != "2025-10-25 16:00 EDT" {
+			t.Errorf("Expected the start in New York time, got %q", got)
+		}
+	})
+
+	t.Run("stored times are rendered in the reader's zone", func(t *testing.T) {
+		stored := schedule.Format(time.Date(2025, 3, 30, 0, 30, 0, 0, time.UTC), time.UTC)
+		if stored != "2025-03-30 00:30 UTC" {
+			t.Fatalf("Expected times to be stored in UTC, got %q", stored)
+		}
+
+		cases := map[string]string{
+			"2025-03-30 00:30 UTC": "2025-03-30 01:30 CET",
+			"2025-03-30 01:30 UTC": "2025-03-30 03:30 CEST",
+			"2025-10-26 00:30 UTC": "2025-10-26 02:30 CEST",
+			"2025-10-26 01:30 UTC": "2025-10-26 02:30 CET",
+		}
+		for value, want := range cases {
+			if got, ok := schedule.Localize(value, paris); !ok || got != want {
+				t.Errorf("Expected %q to be rendered %q, got %q", value, want, got)
+			}
+		}
+
+		if got, ok := schedule.Localize("Salle A", paris); ok || got != "Salle A" {
+			t.Errorf("Expected other values to be left unchanged, got %q", got)
+		}
+	})
+}
+
+func TestTimezoneParam(t *testing.T) {
+	e := newTestEcho()
+	handler := middleware.Timezone(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	for query, want := range map[string]int{
+		"":                     http.StatusNoContent,
+		"?tz=Europe/Paris":     http.StatusNoContent,
+		"?tz=UTC":              http.StatusNoContent,
+		"?tz=Mars/Olympus":     http.StatusBadRequest,
+		"?tz=Local":            http.StatusBadRequest,
+		"?tz=America/New_York": http.StatusNoContent,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/"+query, nil)
+		rec := httptest.NewRecorder()
+		call(e.NewContext(req, rec), handler)
+		if rec.Code != want {
+			t.Errorf("%q: expected status %d, got %d", query, want, rec.Code)
+		}
+	}
+}
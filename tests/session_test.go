@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/middleware"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeUserStates replaces the database lookup of JWTAuth with users kept in
+// memory, which tests modify to simulate deletions, role and site changes.
+type fakeUserStates struct {
+	users map[uuid.UUID]*models.User
+	sites map[uuid.UUID][]uuid.UUID
+	loads int
+}
+
+func stubUserStates(t *testing.T, users ...models.User) *fakeUserStates {
+	states := &fakeUserStates{users: map[uuid.UUID]*models.User{}, sites: map[uuid.UUID][]uuid.UUID{}}
+	for i := range users {
+		states.users[users[i].ID] = &users[i]
+	}
+
+	previous := middleware.UseUserStateLoader(func(ctx context.Context, id uuid.UUID) (middleware.UserState, bool, error) {
+		states.loads++
+		user, ok := states.users[id]
+		if !ok {
+			return middleware.UserState{}, false, nil
+		}
+		return middleware.UserState{
+			Role:         user.Role,
+			TokenVersion: user.TokenVersion,
+			Deleted:      user.DeletedAt != nil,
+			Sites:        states.sites[id],
+		}, true, nil
+	})
+	t.Cleanup(func() { middleware.UseUserStateLoader(previous) })
+	return states
+}
+
+func TestSessionRevocation(t *testing.T) {
+	user := models.User{ID: uuid.New(), Email: "session@test.com", Role: "admin"}
+	states := stubUserStates(t, user)
+	live := states.users[user.ID]
+
+	cfg := config.Get()
+	previousTTL := cfg.JWT.UserStateCacheTTL
+	cfg.JWT.UserStateCacheTTL = time.Minute
+	defer func() { cfg.JWT.UserStateCacheTTL = previousTTL }()
+
+	token, _ := middleware.GenerateToken(user)
+
+	t.Run("valid session", func(t *testing.T) {
+		if code := authenticate(token); code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+		}
+		loads := states.loads
+		authenticate(token)
+		if states.loads != loads {
+			t.Error("Expected the user state to be cached")
+		}
+	})
+
+	t.Run("token version bumped", func(t *testing.T) {
+		live.TokenVersion++
+		middleware.ForgetUser(user.ID)
+		if code := authenticate(token); code != http.StatusUnauthorized {
+			t.Errorf("Expected the old token to be revoked, got %d", code)
+		}
+
+		fresh, _ := middleware.GenerateToken(*live)
+		if code := authenticate(fresh); code != http.StatusOK {
+			t.Errorf("Expected a token of the new version to be accepted, got %d", code)
+		}
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		fresh, _ := middleware.GenerateToken(*live)
+		now := time.Now()
+		live.DeletedAt = &now
+		middleware.ForgetUser(user.ID)
+		if code := authenticate(fresh); code != http.StatusUnauthorized {
+			t.Errorf("Expected the token of a deleted user to be refused, got %d", code)
+		}
+
+		delete(states.users, user.ID)
+		middleware.ForgetUser(user.ID)
+		if code := authenticate(fresh); code != http.StatusUnauthorized {
+			t.Errorf("Expected the token of a removed user to be refused, got %d", code)
+		}
+	})
+}
+
+func TestSessionAuthTime(t *testing.T) {
+	user := models.User{ID: uuid.New(), Email: "authtime@test.com", Role: "user"}
+	stubUserStates(t, user)
+
+	// authTime runs JWTAuth and returns the authentication time it found
+	authTime := func(token string) (time.Time, echo.Context) {
+		e := newTestEcho()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		c := e.NewContext(req, httptest.NewRecorder())
+		var found time.Time
+		call(c, middleware.JWTAuth(func(c echo.Context) error {
+			found, _ = middleware.AuthTime(c)
+			return c.NoContent(http.StatusOK)
+		}))
+		return found, c
+	}
+
+	login, _ := middleware.GenerateToken(user)
+	loggedInAt, c := authTime(login)
+	if time.Since(loggedInAt) > time.Minute {
+		t.Fatalf("Expected a login to be a fresh authentication, got %v", loggedInAt)
+	}
+
+	// A token renewed later keeps the time of the login
+	c.Set(middleware.AuthTimeContextKey, loggedInAt.Add(-time.Hour))
+	renewed, _ := middleware.RenewToken(c, user)
+	if got, _ := authTime(renewed); !got.Equal(loggedInAt.Add(-time.Hour)) {
+		t.Errorf("Expected the renewed token to keep the login time, got %v", got)
+	}
+
+	// and a second factor checked by the identity provider
+	sso, _ := middleware.GenerateSSOToken(user, true)
+	_, c = authTime(sso)
+	renewed, _ = middleware.RenewToken(c, user)
+	if _, c := authTime(renewed); c.Get("mfa") != true {
+		t.Errorf("Expected the renewed token to keep the SSO second factor, got %v", c.Get("mfa"))
+	}
+}
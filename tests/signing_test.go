@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/signing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// useKeyring switches the configuration to algorithm with a fresh keyring
+// for the test duration.
+func useKeyring(t *testing.T, algorithm string, clock *fakeClock) *signing.Keyring {
+	cfg := config.Get()
+	previousJWT := cfg.JWT
+	previousKeyring := signing.Current()
+	t.Cleanup(func() {
+		cfg.JWT = previousJWT
+		signing.Use(previousKeyring)
+	})
+	cfg.JWT.Algorithm = algorithm
+
+	keyring := signing.NewKeyring(signing.NewMemoryStore(), signing.Policy{
+		Algorithm:    algorithm,
+		RotateEvery:  30 * 24 * time.Hour,
+		PublishAhead: time.Hour,
+		Retain:       24 * time.Hour,
+	})
+	if clock != nil {
+		keyring.Clock = clock.Now
+	}
+	if err := keyring.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	signing.Use(keyring)
+	return keyring
+}
+
+func fetchJWKS(t *testing.T) signing.JWKSet {
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	if err := handlers.GetJWKS(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	var set signing.JWKSet
+	json.Unmarshal(rec.Body.Bytes(), &set)
+	return set
+}
+
+func authenticate(token string) int {
+	e := newTestEcho()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	call(e.NewContext(req, rec), middleware.JWTAuth(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}))
+	return rec.Code
+}
+
+func TestSigningRotation(t *testing.T) {
+	clock := newFakeClock()
+	keyring := useKeyring(t, signing.RS256, clock)
+
+	first, err := keyring.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := fetchJWKS(t).Keys; len(keys) != 1 || keys[0].Kid != first.ID || keys[0].Kty != "RSA" {
+		t.Fatalf("Expected the first key to be published, got %+v", keys)
+	}
+
+	// Not due yet
+	clock.Advance(28 * 24 * time.Hour)
+	keyring.Rotate(context.Background())
+	if keys := fetchJWKS(t).Keys; len(keys) != 1 {
+		t.Errorf("Expected no new key before the rotation is due, got %d keys", len(keys))
+	}
+
+	// Due: the next key is published ahead, the first one still signs
+	clock.Advance(2 * 24 * time.Hour)
+	keyring.Rotate(context.Background())
+	if keys := fetchJWKS(t).Keys; len(keys) != 2 {
+		t.Fatalf("Expected the next key to be published, got %d keys", len(keys))
+	}
+	if key, _ := keyring.SigningKey(); key.ID != first.ID {
+		t.Error("Expected the first key to sign until the next one is active")
+	}
+
+	clock.Advance(time.Hour)
+	second, _ := keyring.SigningKey()
+	if second.ID == first.ID {
+		t.Fatal("Expected the next key to sign once active")
+	}
+
+	// The superseded key stays published while its tokens are valid
+	clock.Advance(23 * time.Hour)
+	keyring.Rotate(context.Background())
+	if _, ok := keyring.Lookup(context.Background(), first.ID); !ok {
+		t.Error("Expected the superseded key to be retained")
+	}
+
+	clock.Advance(2 * time.Hour)
+	keyring.Rotate(context.Background())
+	if keys := fetchJWKS(t).Keys; len(keys) != 1 || keys[0].Kid != second.ID {
+		t.Errorf("Expected only the current key to remain, got %+v", keys)
+	}
+}
+
+func TestSigningTokens(t *testing.T) {
+	user := models.User{ID: uuid.New(), Email: "signing@test.com", Role: "user"}
+	stubUserStates(t, user)
+
+	t.Run("RS256 verifiable with the JWKS", func(t *testing.T) {
+		useKeyring(t, signing.RS256, nil)
+
+		token, err := middleware.GenerateToken(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := authenticate(token); code != http.StatusOK {
+			t.Errorf("Expected the token to be accepted, got %d", code)
+		}
+
+		// What another service does: pick the JWK by kid and verify
+		jwks := fetchJWKS(t)
+		claims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+			for _, key := range jwks.Keys {
+				if key.Kid == token.Header["kid"] {
+					n, _ := base64.RawURLEncoding.DecodeString(key.N)
+					e, _ := base64.RawURLEncoding.DecodeString(key.E)
+					return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+				}
+			}
+			return nil, jwt.ErrTokenUnverifiable
+		}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer("spacebook"), jwt.WithAudience("spacebook"))
+		if err != nil {
+			t.Errorf("Expected the token to verify with the JWKS: %v", err)
+		}
+	})
+
+	t.Run("EdDSA", func(t *testing.T) {
+		useKeyring(t, signing.EdDSA, nil)
+
+		token, _ := middleware.GenerateToken(user)
+		if code := authenticate(token); code != http.StatusOK {
+			t.Errorf("Expected the token to be accepted, got %d", code)
+		}
+		if keys := fetchJWKS(t).Keys; len(keys) != 1 || keys[0].Kty != "OKP" || keys[0].Crv != "Ed25519" {
+			t.Errorf("Unexpected JWKS: %+v", keys)
+		}
+	})
+
+	t.Run("HS256 refused when asymmetric", func(t *testing.T) {
+		useKeyring(t, signing.RS256, nil)
+
+		// Algorithm confusion: a token signed with the shared secret
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.JWTClaims{
+			UserID: user.ID,
+			Role:   "admin",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "spacebook",
+				Audience:  jwt.ClaimStrings{"spacebook"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+		signed, _ := forged.SignedString([]byte(config.Get().JWT.Secret))
+		if code := authenticate(signed); code != http.StatusUnauthorized {
+			t.Errorf("Expected an HS256 token to be refused, got %d", code)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		useKeyring(t, signing.EdDSA, nil)
+		token, _ := middleware.GenerateToken(user)
+
+		// Another keyring signs with keys SpaceBook never published
+		_, private, _ := ed25519.GenerateKey(nil)
+		parsed, _, _ := jwt.NewParser().ParseUnverified(token, &middleware.JWTClaims{})
+		parsed.Header["kid"] = "unknown"
+		forged, _ := parsed.SignedString(private)
+		if code := authenticate(forged); code != http.StatusUnauthorized {
+			t.Errorf("Expected a token of an unknown key to be refused, got %d", code)
+		}
+	})
+
+	t.Run("issuer and audience", func(t *testing.T) {
+		cfg := config.Get()
+		previous := cfg.JWT
+		defer func() { cfg.JWT = previous }()
+
+		token, _ := middleware.GenerateToken(user)
+		if code := authenticate(token); code != http.StatusOK {
+			t.Fatalf("Expected the token to be accepted, got %d", code)
+		}
+
+		cfg.JWT.Audience = "another-service"
+		if code := authenticate(token); code != http.StatusUnauthorized {
+			t.Errorf("Expected a token for another audience to be refused, got %d", code)
+		}
+
+		cfg.JWT.Audience = previous.Audience
+		cfg.JWT.Issuer = "https://other.example"
+		if code := authenticate(token); code != http.StatusUnauthorized {
+			t.Errorf("Expected a token of another issuer to be refused, got %d", code)
+		}
+	})
+
+	t.Run("empty JWKS with a shared secret", func(t *testing.T) {
+		previous := signing.Current()
+		signing.Use(nil)
+		defer signing.Use(previous)
+
+		if keys := fetchJWKS(t).Keys; keys == nil || len(keys) != 0 {
+			t.Errorf("Expected an empty key list, got %+v", keys)
+		}
+	})
+}
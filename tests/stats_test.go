@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+
+	"github.com/google/uuid"
+)
+
+func TestGetUtilisationStats(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := createTestUser(t)
+	resource := createTestResource(t, 1)
+
+	defer cleanupTestData("reservationtest@test.com", "Test Resource")
+
+	// Monday 10:00-12:00, inside the default 08:00-18:00 opening hours
+	startAt := time.Date(2031, time.March, 3, 10, 0, 0, 0, time.UTC)
+	reservation := models.Reservation{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		ResourceID: uuid.MustParse(resource.ID),
+		StartAt:    startAt,
+		EndAt:      startAt.Add(2 * time.Hour),
+		Status:     models.StatusApproved,
+	}
+	config.DB.Create(&reservation)
+
+	t.Run("booked hours vs open hours per resource", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats/utilisation?from=2031-03-03&to=2031-03-04", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handlers.GetUtilisationStats(c)
+		if err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var response struct {
+			Rows []handlers.UtilisationRow `json:"rows"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+
+		for _, row := range response.Rows {
+			if row.Key != resource.ID {
+				continue
+			}
+			if row.BookedHours != 2 || row.OpenHours != 10 {
+				t.Errorf("Expected 2 booked hours out of 10, got %v out of %v", row.BookedHours, row.OpenHours)
+			}
+			return
+		}
+		t.Error("Expected a row for the test resource")
+	})
+
+	t.Run("booked hours outside opening hours are not counted", func(t *testing.T) {
+		// Tuesday 17:00-20:00 (1 hour open) and Saturday 10:00-12:00 (closed)
+		for _, slot := range [][2]time.Time{
+			{time.Date(2031, time.March, 4, 17, 0, 0, 0, time.UTC), time.Date(2031, time.March, 4, 20, 0, 0, 0, time.UTC)},
+			{time.Date(2031, time.March, 8, 10, 0, 0, 0, time.UTC), time.Date(2031, time.March, 8, 12, 0, 0, 0, time.UTC)},
+		} {
+			config.DB.Create(&models.Reservation{
+				ID:         uuid.New(),
+				UserID:     user.ID,
+				ResourceID: uuid.MustParse(resource.ID),
+				StartAt:    slot[0],
+				EndAt:      slot[1],
+				Status:     models.StatusApproved,
+			})
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats/utilisation?from=2031-03-04&to=2031-03-10", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		call(c, handlers.GetUtilisationStats)
+
+		var response struct {
+			Rows []handlers.UtilisationRow `json:"rows"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+
+		for _, row := range response.Rows {
+			if row.Key != resource.ID {
+				continue
+			}
+			if row.Reservations != 2 || row.BookedHours != 1 || row.OpenHours != 40 {
+				t.Errorf("Expected 1 booked hour out of 40 over 2 reservations, got %v out of %v over %d",
+					row.BookedHours, row.OpenHours, row.Reservations)
+			}
+			return
+		}
+		t.Error("Expected a row for the test resource")
+	})
+
+	t.Run("opening hours follow the site timezone", func(t *testing.T) {
+		site := models.Location{ID: uuid.New(), Name: "Stats Tokyo", Kind: models.LocationSite, Timezone: "Asia/Tokyo"}
+		config.DB.Create(&site)
+		tokyo, _ := time.LoadLocation("Asia/Tokyo")
+		resource := models.Resource{ID: uuid.New().String(), Name: "Stats Tokyo Room", Type: "room", Capacity: 1,
+			Status: "available", LocationID: &site.ID}
+		config.DB.Create(&resource)
+		defer func() {
+			config.DB.Where("resource_id = ?", resource.ID).Delete(&models.Reservation{})
+			config.DB.Delete(&resource)
+			config.DB.Delete(&site)
+		}()
+
+		// Monday 09:00-11:00 in Tokyo, 01:00-03:00 in Paris
+		startAt := time.Date(2031, time.March, 3, 9, 0, 0, 0, tokyo)
+		config.DB.Create(&models.Reservation{
+			ID:         uuid.New(),
+			UserID:     user.ID,
+			ResourceID: uuid.MustParse(resource.ID),
+			StartAt:    startAt,
+			EndAt:      startAt.Add(2 * time.Hour),
+			Status:     models.StatusApproved,
+		})
+
+		// The same figures whatever the zone of the caller
+		for _, tz := range []string{"UTC", "Europe/Paris", "America/New_York"} {
+			req := httptest.NewRequest(http.MethodGet, "/admin/stats/utilisation?from=2031-03-03&to=2031-03-04&tz="+tz, nil)
+			rec := httptest.NewRecorder()
+			call(e.NewContext(req, rec), handlers.GetUtilisationStats)
+
+			var response struct {
+				Rows []handlers.UtilisationRow `json:"rows"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &response)
+
+			found := false
+			for _, row := range response.Rows {
+				if row.Key == resource.ID {
+					found = true
+					if row.BookedHours != 2 || row.OpenHours != 10 {
+						t.Errorf("%s: expected 2 booked hours out of 10, got %v out of %v", tz, row.BookedHours, row.OpenHours)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("%s: expected a row for the Tokyo resource, got %d: %s", tz, rec.Code, rec.Body.String())
+			}
+		}
+	})
+
+	t.Run("invalid group_by", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats/utilisation?group_by=color", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		call(c, handlers.GetUtilisationStats)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spacebook/middleware"
+	"spacebook/routes"
+	"spacebook/telemetry"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTelemetryMiddleware(t *testing.T) {
+	e := newTestEcho()
+	e.Use(middleware.Telemetry)
+	e.GET("/telemetry-test/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.GET("/metrics", echo.WrapHandler(telemetry.MetricsHandler("")))
+
+	t.Run("requests are counted per route and status", func(t *testing.T) {
+		counter := telemetry.HTTPRequests.WithLabelValues(http.MethodGet, "/telemetry-test/:id", "204")
+		before := testutil.ToFloat64(counter)
+
+		req := httptest.NewRequest(http.MethodGet, "/telemetry-test/42", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if got := testutil.ToFloat64(counter); got != before+1 {
+			t.Errorf("Expected counter to be incremented, got %v (before %v)", got, before)
+		}
+	})
+
+	t.Run("errors are recorded with their status", func(t *testing.T) {
+		counter := telemetry.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")
+		before := testutil.ToFloat64(counter)
+
+		req := httptest.NewRequest(http.MethodGet, "/does-not-exist", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+		}
+		if got := testutil.ToFloat64(counter); got != before+1 {
+			t.Errorf("Expected 404 to be counted, got %v (before %v)", got, before)
+		}
+	})
+
+	t.Run("metrics endpoint", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if !strings.Contains(rec.Body.String(), "spacebook_http_requests_total") {
+			t.Error("Expected request metrics in the exposition output")
+		}
+	})
+
+	t.Run("metrics listener requires its token", func(t *testing.T) {
+		metrics := newTestEcho()
+		routes.SetupMetricsRoutes(metrics, "scraper-secret")
+
+		for header, want := range map[string]int{
+			"":                      http.StatusUnauthorized,
+			"Bearer wrong":          http.StatusUnauthorized,
+			"Bearer scraper-secret": http.StatusOK,
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			rec := httptest.NewRecorder()
+			metrics.ServeHTTP(rec, req)
+
+			if rec.Code != want {
+				t.Errorf("%q: expected status %d, got %d", header, want, rec.Code)
+			}
+		}
+	})
+
+	t.Run("metrics are not served with the API", func(t *testing.T) {
+		api := newTestEcho()
+		routes.SetupRoutes(api)
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+
+		// Unknown paths fall under the authenticated group
+		if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), "spacebook_http_requests_total") {
+			t.Errorf("Expected no metrics on the API, got status %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/middleware"
+	"spacebook/models"
+	"spacebook/totp"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// RFC 6238 appendix B, SHA1 secret "12345678901234567890", truncated to 6 digits
+func TestTOTPVectors(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		got, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("Code returned error: %v", err)
+		}
+		if got != want {
+			t.Errorf("Code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestTOTPValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, _ := totp.Code(secret, totp.Step(now))
+
+	if step, ok := totp.Validate(secret, code, now); !ok || step != totp.Step(now) {
+		t.Error("Expected the current code to be valid")
+	}
+	if _, ok := totp.Validate(secret, code, now.Add(totp.Period)); !ok {
+		t.Error("Expected the previous step to be tolerated")
+	}
+	if _, ok := totp.Validate(secret, code, now.Add(3*totp.Period)); ok {
+		t.Error("Expected an old code to be refused")
+	}
+	if _, ok := totp.Validate(secret, "12345", now); ok {
+		t.Error("Expected a short code to be refused")
+	}
+
+	uri := totp.URI("SpaceBook", "alice@test.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/SpaceBook:alice@test.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected otpauth URI %q", uri)
+	}
+}
+
+func TestTwoFactorTokens(t *testing.T) {
+	user := models.User{ID: uuid.New(), Email: "2fa@test.com", Role: "admin"}
+	stubUserStates(t, user)
+
+	e := newTestEcho()
+	e.GET("/admin", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, middleware.JWTAuth, middleware.AdminOnly)
+
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("challenge token is not a session", func(t *testing.T) {
+		challenge, _ := middleware.GenerateChallengeToken(user)
+		if code := serve(challenge); code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+
+		userID, err := middleware.ParseChallengeToken(challenge)
+		if err != nil || userID != user.ID {
+			t.Errorf("Expected the challenge to identify the user, got %v, %v", userID, err)
+		}
+
+		session, _ := middleware.GenerateToken(user)
+		if _, err := middleware.ParseChallengeToken(session); err == nil {
+			t.Error("Expected a session token to be refused as a challenge")
+		}
+	})
+
+	t.Run("admin policy requires a second factor", func(t *testing.T) {
+		cfg := config.Get()
+		previous := cfg.TwoFactor.RequireForAdmins
+		cfg.TwoFactor.RequireForAdmins = true
+		defer func() { cfg.TwoFactor.RequireForAdmins = previous }()
+
+		withoutMFA, _ := middleware.GenerateToken(user)
+		if code := serve(withoutMFA); code != http.StatusForbidden {
+			t.Errorf("Expected status %d without a second factor, got %d", http.StatusForbidden, code)
+		}
+
+		enrolled := user
+		enrolled.TOTPEnabled = true
+		withMFA, _ := middleware.GenerateToken(enrolled)
+		if code := serve(withMFA); code != http.StatusOK {
+			t.Errorf("Expected status %d with a second factor, got %d", http.StatusOK, code)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spacebook/config"
+	"spacebook/handlers"
+	"spacebook/models"
+	"spacebook/ratelimit"
+	"spacebook/totp"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTwoFactorFlow(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("Correct-Horse-42"), bcrypt.DefaultCost)
+	user := models.User{
+		ID:       uuid.New(),
+		Email:    "twofactor@test.com",
+		Username: "twofactor",
+		Password: hashedPassword,
+		Role:     "user",
+	}
+	config.DB.Create(&user)
+
+	defer func() {
+		config.DB.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+		config.DB.Where("id = ?", user.ID).Delete(&models.User{})
+	}()
+
+	// Fresh limiter and one IP per request: the login throttling is not under test
+	previous := ratelimit.Current()
+	ratelimit.Use(ratelimit.NewMemoryStore())
+	defer ratelimit.Use(previous)
+	requests := 0
+
+	send := func(handler echo.HandlerFunc, payload interface{}, authenticated bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		requests++
+		req.RemoteAddr = fmt.Sprintf("203.0.113.%d:1234", requests)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if authenticated {
+			c.Set("user_id", user.ID)
+			c.Set("role", user.Role)
+		}
+		call(c, handler)
+		return rec
+	}
+
+	// Enrolment
+	rec := send(handlers.EnrollTwoFactor, map[string]string{"password": "Correct-Horse-42"}, true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Enrol: expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var enrolment handlers.EnrolmentResponse
+	json.Unmarshal(rec.Body.Bytes(), &enrolment)
+
+	if rec := send(handlers.VerifyTwoFactor, map[string]string{"code": "000000"}, true); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Verify: expected a wrong code to be refused, got %d", rec.Code)
+	}
+
+	now := time.Now()
+	code, _ := totp.Code(enrolment.Secret, totp.Step(now))
+	rec = send(handlers.VerifyTwoFactor, map[string]string{"code": code}, true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Verify: expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var verified struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &verified)
+	if len(verified.RecoveryCodes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(verified.RecoveryCodes))
+	}
+
+	// Login now requires a second step
+	rec = send(handlers.Login, map[string]string{"email": user.Email, "password": "Correct-Horse-42"}, false)
+	var challenge handlers.TwoFactorChallenge
+	json.Unmarshal(rec.Body.Bytes(), &challenge)
+	if rec.Code != http.StatusOK || !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("Expected a two-factor challenge, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	t.Run("a TOTP step cannot be replayed", func(t *testing.T) {
+		rec := send(handlers.LoginTwoFactor, map[string]string{
+			"challenge_token": challenge.ChallengeToken,
+			"code":            code,
+		}, false)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("recovery codes are single-use", func(t *testing.T) {
+		payload := map[string]string{
+			"challenge_token": challenge.ChallengeToken,
+			"recovery_code":   verified.RecoveryCodes[0],
+		}
+		rec := send(handlers.LoginTwoFactor, payload, false)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var response handlers.AuthResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if response.Token == "" {
+			t.Error("Expected a session token")
+		}
+
+		if rec := send(handlers.LoginTwoFactor, payload, false); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a used recovery code to be refused, got %d", rec.Code)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		next, _ := totp.Code(enrolment.Secret, totp.Step(now)+1)
+		rec := send(handlers.DisableTwoFactor, map[string]string{
+			"password": "Correct-Horse-42",
+			"code":     next,
+		}, true)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var count int64
+		config.DB.Model(&models.RecoveryCode{}).Where("user_id = ?", user.ID).Count(&count)
+		if count != 0 {
+			t.Error("Expected the recovery codes to be deleted")
+		}
+	})
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"spacebook/config"
 	"spacebook/handlers"
+	"spacebook/middleware"
 	"spacebook/models"
 
 	"github.com/google/uuid"
@@ -17,7 +19,7 @@ import (
 func TestGetUsers(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	// Create test user
 	user := models.User{
@@ -57,7 +59,7 @@ func TestGetUsers(t *testing.T) {
 func TestDeleteUser(t *testing.T) {
 	setupTestDB()
 
-	e := echo.New()
+	e := newTestEcho()
 
 	t.Run("delete user without reservations", func(t *testing.T) {
 		// Create test user
@@ -137,10 +139,50 @@ func TestDeleteUser(t *testing.T) {
 		c.SetParamNames("id")
 		c.SetParamValues(userID.String())
 
-		handlers.DeleteUser(c)
+		call(c, handlers.DeleteUser)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
 		}
 	})
 }
+
+func TestUpdateUserRole(t *testing.T) {
+	setupTestDB()
+
+	e := newTestEcho()
+
+	user := models.User{
+		ID:       uuid.New(),
+		Email:    "roletest@test.com",
+		Username: "roletest",
+		Role:     "admin",
+	}
+	config.DB.Create(&user)
+	defer config.DB.Where("id = ?", user.ID).Delete(&models.User{})
+
+	// Another admin, so that the user is not the last one
+	other := models.User{ID: uuid.New(), Email: "roletest-admin@test.com", Username: "roletest-admin", Role: "admin"}
+	config.DB.Create(&other)
+	defer config.DB.Where("id = ?", other.ID).Delete(&models.User{})
+
+	token, _ := middleware.GenerateToken(user)
+	if code := authenticate(token); code != http.StatusOK {
+		t.Fatalf("Expected the admin session to be valid, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"role":"user"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(user.ID.String())
+	call(c, handlers.UpdateUserRole)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if code := authenticate(token); code != http.StatusUnauthorized {
+		t.Errorf("Expected the demoted admin's session to be revoked, got %d", code)
+	}
+}